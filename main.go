@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
@@ -11,13 +18,83 @@ import (
 	"github.com/Financial-Times/kafka-client-go/v4"
 	"github.com/Financial-Times/smartlogic-notifier/notifier"
 	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
 	"github.com/gorilla/mux"
 	cli "github.com/jawher/mow.cli"
-	"github.com/sethgrid/pester"
+	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel"
 )
 
 const appDescription = "Entrypoint for concept publish notifications from the Smartlogic Semaphore system"
 
+// modelConfig is the configuration of one of the Smartlogic models served by the notifier.
+type modelConfig struct {
+	Model              string `json:"model"`
+	ConceptURIPrefix   string `json:"conceptUriPrefix"`
+	HealthcheckConcept string `json:"healthcheckConcept"`
+	KafkaTopic         string `json:"kafkaTopic"`
+	// UPPConceptTopic is the topic the concepts in the UPP concept model are sent to, the concepts are not transformed if it is empty.
+	UPPConceptTopic string `json:"uppConceptTopic"`
+	// URINamespaces are the namespaces of the concept URIs which are published, they default to the conceptUriNamespaces option.
+	URINamespaces []smartlogic.URINamespace `json:"uriNamespaces"`
+	// ConceptProperties are the properties of the concepts requested from Smartlogic, they default to the smartlogicConceptProperties option.
+	ConceptProperties []string `json:"conceptProperties"`
+	// dataDir is where the state of the model is kept, it is not configurable on its own.
+	dataDir string
+}
+
+// parseModelConfigs reads the json list of model configs. The concept URI prefix, the URI namespaces and the Kafka topics default
+// to the ones in the given defaults. If the list is empty the defaults are the only model, which keeps its state
+// in the data directory itself, so that the single model deployments keep their state. Otherwise every model
+// keeps its state in its own subdirectory.
+func parseModelConfigs(raw string, defaults modelConfig, dataDir string) ([]modelConfig, error) {
+	if raw == "" {
+		defaults.dataDir = dataDir
+		return []modelConfig{defaults}, nil
+	}
+
+	var configs []modelConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("failed to decode the model configs: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no models are configured")
+	}
+
+	seen := map[string]bool{}
+	for i := range configs {
+		c := &configs[i]
+		if c.Model == "" {
+			return nil, fmt.Errorf("model config %d has no model", i)
+		}
+		if c.HealthcheckConcept == "" {
+			return nil, fmt.Errorf("model %s has no healthcheckConcept", c.Model)
+		}
+		if seen[c.Model] {
+			return nil, fmt.Errorf("model %s is configured more than once", c.Model)
+		}
+		seen[c.Model] = true
+
+		if c.ConceptURIPrefix == "" {
+			c.ConceptURIPrefix = defaults.ConceptURIPrefix
+		}
+		if c.KafkaTopic == "" {
+			c.KafkaTopic = defaults.KafkaTopic
+		}
+		if c.UPPConceptTopic == "" {
+			c.UPPConceptTopic = defaults.UPPConceptTopic
+		}
+		if len(c.URINamespaces) == 0 {
+			c.URINamespaces = defaults.URINamespaces
+		}
+		if len(c.ConceptProperties) == 0 {
+			c.ConceptProperties = defaults.ConceptProperties
+		}
+		c.dataDir = filepath.Join(dataDir, c.Model)
+	}
+	return configs, nil
+}
+
 func main() {
 
 	app := cli.App("smartlogic-notifier", appDescription)
@@ -50,6 +127,13 @@ func main() {
 		EnvVar: "KAFKA_TOPIC",
 	})
 
+	kafkaUPPConceptTopic := app.String(cli.StringOpt{
+		Name:   "kafkaUPPConceptTopic",
+		Value:  "",
+		Desc:   "Kafka topic to send the concepts transformed into the UPP concept model to, the concepts are not transformed if it is empty",
+		EnvVar: "KAFKA_UPP_CONCEPT_TOPIC",
+	})
+
 	kafkaClusterArn := app.String(cli.StringOpt{
 		Name:   "kafkaClusterArn",
 		Desc:   "Kafka cluster ARN used by the producer for maintenance monitoring",
@@ -69,12 +153,56 @@ func main() {
 		EnvVar: "SMARTLOGIC_MODEL",
 	})
 
+	smartlogicModels := app.String(cli.StringOpt{
+		Name:   "smartlogicModels",
+		Desc:   `Json list of the Smartlogic models to read from, e.g. [{"model": "FTModel", "healthcheckConcept": "uuid", "kafkaTopic": "topic", "conceptUriPrefix": "prefix"}], overrides smartlogicModel and smartlogicHealthcheckConcept`,
+		EnvVar: "SMARTLOGIC_MODELS",
+	})
+
 	smartlogicAPIKey := app.String(cli.StringOpt{
 		Name:   "smartlogicAPIKey",
 		Desc:   "Smartlogic API key",
 		EnvVar: "SMARTLOGIC_API_KEY",
 	})
 
+	smartlogicAuthMode := app.String(cli.StringOpt{
+		Name:   "smartlogicAuthMode",
+		Value:  smartlogic.AuthModeAPIKey,
+		Desc:   "How to authenticate to Smartlogic: apikey to exchange the API key for a token, token to use a static bearer token, client-credentials for the OAuth client credentials grant",
+		EnvVar: "SMARTLOGIC_AUTH_MODE",
+	})
+
+	smartlogicTokenURL := app.String(cli.StringOpt{
+		Name:   "smartlogicTokenURL",
+		Value:  smartlogic.DefaultTokenURL,
+		Desc:   "URL of the endpoint issuing the Smartlogic access tokens, used by the apikey and client-credentials modes",
+		EnvVar: "SMARTLOGIC_TOKEN_URL",
+	})
+
+	smartlogicToken := app.String(cli.StringOpt{
+		Name:   "smartlogicToken",
+		Desc:   "Static Smartlogic bearer token, used by the token mode",
+		EnvVar: "SMARTLOGIC_TOKEN",
+	})
+
+	smartlogicClientID := app.String(cli.StringOpt{
+		Name:   "smartlogicClientID",
+		Desc:   "OAuth client id, used by the client-credentials mode",
+		EnvVar: "SMARTLOGIC_CLIENT_ID",
+	})
+
+	smartlogicClientSecret := app.String(cli.StringOpt{
+		Name:   "smartlogicClientSecret",
+		Desc:   "OAuth client secret, used by the client-credentials mode",
+		EnvVar: "SMARTLOGIC_CLIENT_SECRET",
+	})
+
+	smartlogicScope := app.String(cli.StringOpt{
+		Name:   "smartlogicScope",
+		Desc:   "OAuth scope requested by the client-credentials mode",
+		EnvVar: "SMARTLOGIC_SCOPE",
+	})
+
 	smartlogicTimeout := app.String(cli.StringOpt{
 		Name:   "smartlogicTimeout",
 		Desc:   "Number of seconds to wait for smartlogic to respond to our requests",
@@ -82,6 +210,20 @@ func main() {
 		Value:  "30s",
 	})
 
+	smartlogicTokenRefreshAhead := app.String(cli.StringOpt{
+		Name:   "smartlogicTokenRefreshAhead",
+		Value:  "1m",
+		Desc:   "How long before its expiry the Smartlogic access token is refreshed",
+		EnvVar: "SMARTLOGIC_TOKEN_REFRESH_AHEAD",
+	})
+
+	smartlogicAuthCooldown := app.String(cli.StringOpt{
+		Name:   "smartlogicAuthCooldown",
+		Value:  "1m",
+		Desc:   "How long to stop the requests to Smartlogic for after it rejected the access token 5 times in a row",
+		EnvVar: "SMARTLOGIC_AUTH_COOLDOWN",
+	})
+
 	smartlogicHealthcheckConcept := app.String(cli.StringOpt{
 		Name:   "smartlogicHealthcheckConcept",
 		Desc:   "Concept uuid existing in the Smartlogic model to be used for healthcheck",
@@ -116,6 +258,145 @@ func main() {
 		EnvVar: "CONCEPT_URI_PREFIX",
 	})
 
+	conceptUriNamespaces := app.String(cli.StringOpt{
+		Name:   "conceptUriNamespaces",
+		Desc:   `Json list of the namespaces of the concept URIs which are published, e.g. [{"prefix": "http://www.ft.com/thing/", "idType": "uuid"}, {"pattern": "^http://www\.ft\.com/ontology/[a-z]+/([^/]+)$", "idType": "string"}], the FT things and managed locations by default`,
+		EnvVar: "CONCEPT_URI_NAMESPACES",
+	})
+
+	smartlogicConceptProperties := app.String(cli.StringOpt{
+		Name:   "smartlogicConceptProperties",
+		Value:  strings.Join(smartlogic.DefaultConceptProperties(), ","),
+		Desc:   "Comma separated list of the properties of the concepts requested from Smartlogic, [] stands for all the direct properties and * requests all the properties",
+		EnvVar: "SMARTLOGIC_CONCEPT_PROPERTIES",
+	})
+
+	conceptValidationRules := app.String(cli.StringOpt{
+		Name:   "conceptValidationRules",
+		Value:  strings.Join([]string{notifier.PrefLabelRule, notifier.TypeRule, notifier.URIRule}, ","),
+		Desc:   "Comma separated list of the rules the concepts are validated with before being published, the invalid ones are quarantined",
+		EnvVar: "CONCEPT_VALIDATION_RULES",
+	})
+
+	conceptKnownTypes := app.String(cli.StringOpt{
+		Name:   "conceptKnownTypes",
+		Value:  "",
+		Desc:   "Comma separated list of the types accepted by the type validation rule, as URIs or names like Organisation, any type by default",
+		EnvVar: "CONCEPT_KNOWN_TYPES",
+	})
+
+	dataDir := app.String(cli.StringOpt{
+		Name:   "dataDir",
+		Value:  "data",
+		Desc:   "Directory where the service keeps its state, like the notifications waiting to be processed",
+		EnvVar: "DATA_DIR",
+	})
+
+	catchUpInterval := app.String(cli.StringOpt{
+		Name:   "catchUpInterval",
+		Value:  "5m",
+		Desc:   "How often to check Smartlogic for changes made since the last processed one, 0 means only on startup",
+		EnvVar: "CATCH_UP_INTERVAL",
+	})
+
+	conceptRetryMaxAttempts := app.Int(cli.IntOpt{
+		Name:   "conceptRetryMaxAttempts",
+		Value:  3,
+		Desc:   "How many times to try getting a changed concept from Smartlogic before giving up, 1 disables retrying, the concepts which are not found or not authorized are not retried",
+		EnvVar: "CONCEPT_RETRY_MAX_ATTEMPTS",
+	})
+
+	conceptRetryInitialBackoff := app.String(cli.StringOpt{
+		Name:   "conceptRetryInitialBackoff",
+		Value:  "2s",
+		Desc:   "How long to wait before the first retry of getting a concept, the wait is doubled on every following retry",
+		EnvVar: "CONCEPT_RETRY_INITIAL_BACKOFF",
+	})
+
+	conceptRetryMaxBackoff := app.String(cli.StringOpt{
+		Name:   "conceptRetryMaxBackoff",
+		Value:  "30s",
+		Desc:   "The longest wait between the retries of getting a concept",
+		EnvVar: "CONCEPT_RETRY_MAX_BACKOFF",
+	})
+
+	conceptRetryJitter := app.Int(cli.IntOpt{
+		Name:   "conceptRetryJitter",
+		Value:  20,
+		Desc:   "Percentage of the wait between the retries of getting a concept which is randomised",
+		EnvVar: "CONCEPT_RETRY_JITTER",
+	})
+
+	conceptConcurrency := app.Int(cli.IntOpt{
+		Name:   "conceptConcurrency",
+		Value:  4,
+		Desc:   "How many concepts to fetch from Smartlogic and send to Kafka in parallel",
+		EnvVar: "CONCEPT_CONCURRENCY",
+	})
+
+	smartlogicRateLimit := app.Int(cli.IntOpt{
+		Name:   "smartlogicRateLimit",
+		Value:  10,
+		Desc:   "Maximum number of requests per second sent to Smartlogic by all the models together, 0 means unlimited",
+		EnvVar: "SMARTLOGIC_RATE_LIMIT",
+	})
+
+	smartlogicRateBurst := app.Int(cli.IntOpt{
+		Name:   "smartlogicRateBurst",
+		Value:  0,
+		Desc:   "Maximum number of requests sent to Smartlogic at once when none were sent for a while, 0 means the same as smartlogicRateLimit",
+		EnvVar: "SMARTLOGIC_RATE_BURST",
+	})
+
+	smartlogicMaxRetries := app.Int(cli.IntOpt{
+		Name:   "smartlogicMaxRetries",
+		Value:  5,
+		Desc:   "How many times a request to Smartlogic which failed with a network error or a 5xx or 429 status is retried",
+		EnvVar: "SMARTLOGIC_MAX_RETRIES",
+	})
+
+	smartlogicMaxRetryAfter := app.String(cli.StringOpt{
+		Name:   "smartlogicMaxRetryAfter",
+		Value:  "1m",
+		Desc:   "Longest Retry-After asked by Smartlogic which is waited for before retrying, the requests asked to wait longer fail",
+		EnvVar: "SMARTLOGIC_MAX_RETRY_AFTER",
+	})
+
+	smartlogicChangesPageSize := app.Int(cli.IntOpt{
+		Name:   "smartlogicChangesPageSize",
+		Value:  500,
+		Desc:   "How many changesets to request from Smartlogic at once when getting the changed concepts, 0 means all of them at once",
+		EnvVar: "SMARTLOGIC_CHANGES_PAGE_SIZE",
+	})
+
+	reindexPageSize := app.Int(cli.IntOpt{
+		Name:   "reindexPageSize",
+		Value:  100,
+		Desc:   "How many concepts to request from Smartlogic at once when reindexing the model",
+		EnvVar: "REINDEX_PAGE_SIZE",
+	})
+
+	reindexThrottle := app.Int(cli.IntOpt{
+		Name:   "reindexThrottle",
+		Value:  20,
+		Desc:   "Maximum number of concepts per second published when reindexing the model, 0 means unlimited",
+		EnvVar: "REINDEX_THROTTLE",
+	})
+
+	tracingExporter := app.String(cli.StringOpt{
+		Name:   "tracingExporter",
+		Value:  "",
+		Desc:   "Where to export the traces of the notifications to, otlp or stdout, no traces are exported by default",
+		EnvVar: "TRACING_EXPORTER",
+	})
+
+	otlpEndpoint := app.String(cli.StringOpt{
+		Name:   "otlpEndpoint",
+		Value:  "",
+		Desc:   "URL of the OTLP http endpoint the traces are exported to by the otlp exporter, e.g. http://otel-collector:4318",
+		EnvVar: "OTEL_EXPORTER_OTLP_ENDPOINT",
+	})
+
 	log := logger.NewUPPLogger(*appName, *logLevel)
 	log.Infof("[Startup] %s is starting", *appSystemCode)
 
@@ -130,57 +411,305 @@ func main() {
 		log.WithError(err).Fatalf("Smartlogic timeout duration %s could not be parsed", *smartlogicTimeout)
 	}
 
+	smartlogicTokenRefreshAheadDuration, err := time.ParseDuration(*smartlogicTokenRefreshAhead)
+	if err != nil {
+		log.WithError(err).Fatalf("Smartlogic token refresh ahead duration %s could not be parsed", *smartlogicTokenRefreshAhead)
+	}
+
+	smartlogicAuthCooldownDuration, err := time.ParseDuration(*smartlogicAuthCooldown)
+	if err != nil {
+		log.WithError(err).Fatalf("Smartlogic auth cooldown %s could not be parsed", *smartlogicAuthCooldown)
+	}
+
+	smartlogicMaxRetryAfterDuration, err := time.ParseDuration(*smartlogicMaxRetryAfter)
+	if err != nil {
+		log.WithError(err).Fatalf("Smartlogic max retry after %s could not be parsed", *smartlogicMaxRetryAfter)
+	}
+
+	catchUpIntervalDuration, err := time.ParseDuration(*catchUpInterval)
+	if err != nil {
+		log.WithError(err).Fatalf("Catch up interval %s could not be parsed", *catchUpInterval)
+	}
+
+	conceptRetryInitialBackoffDuration, err := time.ParseDuration(*conceptRetryInitialBackoff)
+	if err != nil {
+		log.WithError(err).Fatalf("Concept retry initial backoff %s could not be parsed", *conceptRetryInitialBackoff)
+	}
+
+	conceptRetryMaxBackoffDuration, err := time.ParseDuration(*conceptRetryMaxBackoff)
+	if err != nil {
+		log.WithError(err).Fatalf("Concept retry max backoff %s could not be parsed", *conceptRetryMaxBackoff)
+	}
+
+	if *conceptRetryJitter < 0 || *conceptRetryJitter > 100 {
+		log.Fatalf("Concept retry jitter %d should be a percentage between 0 and 100", *conceptRetryJitter)
+	}
+
+	if *conceptConcurrency < 1 {
+		log.Fatalf("Concept concurrency %d should be at least 1", *conceptConcurrency)
+	}
+
+	tracerProvider, err := newTracerProvider(*tracingExporter, *otlpEndpoint, *appSystemCode)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to start the service, the tracing is not configured correctly.")
+	}
+	if tracerProvider != nil {
+		otel.SetTracerProvider(tracerProvider)
+	}
+
 	if *smartlogicBaseURL == "" {
 		log.Fatalf("Failed to start the service, smartlogicBaseURL is required.")
 	}
-	if *smartlogicModel == "" {
-		log.Fatalf("Failed to start the service, smartlogicModel is required.")
+	if *smartlogicModels == "" && *smartlogicModel == "" {
+		log.Fatalf("Failed to start the service, smartlogicModel or smartlogicModels is required.")
 	}
-	if *smartlogicAPIKey == "" {
-		log.Fatalf("Failed to start the service, smartlogicAPIKey is required.")
+	smartlogicAuth, err := smartlogic.NewAuthenticator(smartlogic.AuthConfig{
+		Mode:         *smartlogicAuthMode,
+		TokenURL:     *smartlogicTokenURL,
+		APIKey:       *smartlogicAPIKey,
+		Token:        *smartlogicToken,
+		ClientID:     *smartlogicClientID,
+		ClientSecret: *smartlogicClientSecret,
+		Scope:        *smartlogicScope,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Failed to start the service, the Smartlogic authentication is not configured correctly.")
 	}
-	if *smartlogicHealthcheckConcept == "" {
+	if *smartlogicModels == "" && *smartlogicHealthcheckConcept == "" {
 		log.Fatalf("Failed to start the service, smartlogicHealthcheckConcept is required.")
 	}
 
-	log.Infof("Caching successful health for %s", smartlogicHealthCacheDuration)
-	log.Infof("Checking Smartlogic health via getting concept %s of model %s", *smartlogicHealthcheckConcept, *smartlogicModel)
+	uriNamespaces := smartlogic.DefaultURINamespaces()
+	if *conceptUriNamespaces != "" {
+		if err = json.Unmarshal([]byte(*conceptUriNamespaces), &uriNamespaces); err != nil {
+			log.WithError(err).Fatal("Failed to start the service, conceptUriNamespaces is invalid.")
+		}
+	}
 
-	app.Action = func() {
-		log.Infof("System code: %s, App Name: %s, Port: %s", *appSystemCode, *appName, *port)
+	conceptProperties, err := smartlogic.ParseConceptProperties(*smartlogicConceptProperties)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to start the service, smartlogicConceptProperties is invalid.")
+	}
 
-		router := mux.NewRouter()
+	validationRules, err := notifier.NewValidationRules(strings.Split(*conceptValidationRules, ","), strings.Split(*conceptKnownTypes, ","))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to start the service, conceptValidationRules is invalid.")
+	}
 
+	models, err := parseModelConfigs(*smartlogicModels, modelConfig{
+		Model:              *smartlogicModel,
+		ConceptURIPrefix:   *conceptUriPrefix,
+		HealthcheckConcept: *smartlogicHealthcheckConcept,
+		KafkaTopic:         *kafkaTopic,
+		UPPConceptTopic:    *kafkaUPPConceptTopic,
+		URINamespaces:      uriNamespaces,
+		ConceptProperties:  conceptProperties,
+	}, *dataDir)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to start the service, smartlogicModels is invalid.")
+	}
+
+	log.Infof("Caching successful health for %s", smartlogicHealthCacheDuration)
+	for _, mc := range models {
+		log.Infof("Checking Smartlogic health via getting concept %s of model %s", mc.HealthcheckConcept, mc.Model)
+		if _, err = smartlogic.NewURIRegistry(mc.URINamespaces, log); err != nil {
+			log.WithError(err).Fatalf("Failed to start the service, the URI namespaces of model %s are invalid.", mc.Model)
+		}
+		if err = smartlogic.ValidateConceptProperties(mc.ConceptProperties); err != nil {
+			log.WithError(err).Fatalf("Failed to start the service, the concept properties of model %s are invalid.", mc.Model)
+		}
+	}
+
+	// the models which publish to the same topic share a producer
+	producers := map[string]*notifier.KafkaProducer{}
+	producerFor := func(topic string) *notifier.KafkaProducer {
+		if producer, ok := producers[topic]; ok {
+			return producer
+		}
 		producerConfig := kafka.ProducerConfig{
-			Topic:                   *kafkaTopic,
+			Topic:                   topic,
 			BrokersConnectionString: *kafkaAddresses,
 			Options:                 kafka.DefaultProducerOptions(),
 			ClusterArn:              kafkaClusterArn,
 		}
-		producer, innerErr := kafka.NewProducer(producerConfig)
-		if innerErr != nil {
-			log.WithError(innerErr).Fatal("Unable to create kafka producer")
+		producer, err := notifier.NewKafkaProducer(producerConfig)
+		if err != nil {
+			log.WithError(err).Fatal("Unable to create kafka producer")
+		}
+		producers[topic] = producer
+		return producer
+	}
+	// the messages being sent are flushed before the connections to Kafka are closed
+	closeProducers := func() {
+		for topic, producer := range producers {
+			if closeErr := producer.Close(); closeErr != nil {
+				log.WithError(closeErr).Errorf("Failed to close the kafka producer of topic %s", topic)
+			}
 		}
-		httpClient := getResilientClient(smartlogicTimeoutDuration)
-		slClient, err := smartlogic.NewSmartlogicClient(httpClient, *smartlogicBaseURL, *smartlogicModel, *smartlogicAPIKey, *conceptUriPrefix, log)
+	}
+
+	// all the models are read from the same Smartlogic instance, so their requests are limited together
+	rateLimiter := smartlogic.NewRateLimiter(*smartlogicRateLimit, *smartlogicRateBurst)
+
+	var dataDirLocks []*notifier.DataDirLock
+	newService := func(mc modelConfig) (*notifier.Service, smartlogic.Clienter) {
+		// the stores of the model are owned by a single process until it exits, e.g. a reindex is not run
+		// from the command line against the data directory of a running service
+		lock, err := notifier.LockDataDir(mc.dataDir)
+		if errors.Is(err, notifier.ErrDataDirLocked) {
+			log.Fatalf("The data directory %s of model %s is used by another process, e.g. a running service", mc.dataDir, mc.Model)
+		} else if err != nil {
+			log.WithError(err).Fatalf("Unable to lock the data directory of model %s", mc.Model)
+		}
+		dataDirLocks = append(dataDirLocks, lock)
+
+		// the namespaces were validated on startup
+		uris, _ := smartlogic.NewURIRegistry(mc.URINamespaces, log)
+		httpClient := getHTTPClient(smartlogicTimeoutDuration)
+		slClient, err := smartlogic.NewSmartlogicClient(httpClient, *smartlogicBaseURL, mc.Model, *smartlogicAPIKey, mc.ConceptURIPrefix, log,
+			smartlogic.WithSharedRateLimit(rateLimiter),
+			smartlogic.WithRetries(*smartlogicMaxRetries, smartlogicMaxRetryAfterDuration),
+			smartlogic.WithMetrics(metrics.DefaultRegistry),
+			smartlogic.WithChangesPageSize(*smartlogicChangesPageSize),
+			smartlogic.WithURIRegistry(uris),
+			smartlogic.WithConceptProperties(mc.ConceptProperties),
+			smartlogic.WithAuthenticator(smartlogicAuth),
+			smartlogic.WithTokenRefreshAhead(smartlogicTokenRefreshAheadDuration),
+			smartlogic.WithAuthCooldown(smartlogicAuthCooldownDuration),
+		)
+		if err != nil {
+			log.Errorf("Error generating access token when connecting to Smartlogic model %s.  If this continues to fail, please check the configuration.", mc.Model)
+		}
+
+		checkpoint, err := notifier.NewFileCheckpoint(mc.dataDir)
+		if err != nil {
+			log.WithError(err).Fatal("Unable to open the checkpoint store")
+		}
+
+		deadLetters, err := notifier.NewFileDeadLetterStore(mc.dataDir)
+		if err != nil {
+			log.WithError(err).Fatal("Unable to open the dead letter store")
+		}
+
+		hashes, err := notifier.NewFileHashStore(mc.dataDir)
 		if err != nil {
-			log.Error("Error generating access token when connecting to Smartlogic.  If this continues to fail, please check the configuration.")
+			log.WithError(err).Fatal("Unable to open the concept hash store")
 		}
 
-		service := notifier.NewNotifierService(producer, slClient, log)
+		serviceOpts := []func(*notifier.Service){
+			notifier.WithSmartlogicModel(mc.Model),
+			notifier.WithCheckpoint(checkpoint),
+			notifier.WithDeadLetters(deadLetters),
+			notifier.WithHashStore(hashes),
+			notifier.WithRetryPolicy(notifier.RetryPolicy{
+				MaxAttempts:    *conceptRetryMaxAttempts,
+				InitialBackoff: conceptRetryInitialBackoffDuration,
+				MaxBackoff:     conceptRetryMaxBackoffDuration,
+				Jitter:         float64(*conceptRetryJitter) / 100,
+			}),
+			notifier.WithConcurrency(*conceptConcurrency),
+			notifier.WithValidationRules(validationRules...),
+			notifier.WithMetrics(metrics.DefaultRegistry),
+		}
+		if mc.UPPConceptTopic != "" {
+			serviceOpts = append(serviceOpts, notifier.WithConceptTransform(producerFor(mc.UPPConceptTopic), uris))
+		}
+		service := notifier.NewNotifierService(producerFor(mc.KafkaTopic), slClient, log, serviceOpts...)
+		return service, slClient
+	}
+
+	newReindexer := func(mc modelConfig, service notifier.Servicer, slClient smartlogic.Clienter) *notifier.Reindexer {
+		store, err := notifier.NewFileReindexStore(mc.dataDir)
+		if err != nil {
+			log.WithError(err).Fatal("Unable to open the reindex progress store")
+		}
+		return notifier.NewReindexer(service, slClient, log,
+			notifier.WithReindexStore(store),
+			notifier.WithReindexPageSize(*reindexPageSize),
+			notifier.WithReindexThrottle(*reindexThrottle),
+		)
+	}
+
+	app.Command("reindex", "Republish every concept in the Smartlogic model", func(cmd *cli.Cmd) {
+		restart := cmd.BoolOpt("restart", false, "Start from the beginning of the model instead of resuming an unfinished reindex")
+		model := cmd.StringOpt("model", "", "The model to reindex, required when several models are configured")
+
+		cmd.Action = func() {
+			var mc modelConfig
+			for _, c := range models {
+				if c.Model == *model || (*model == "" && len(models) == 1) {
+					mc = c
+				}
+			}
+			if mc.Model == "" {
+				log.Fatalf("Unknown model %q, the model to reindex should be one of the configured models", *model)
+			}
 
-		handler := notifier.NewNotifierHandler(service, *smartlogicModel, log)
-		handler.RegisterEndpoints(router)
+			service, slClient := newService(mc)
+			reindexer := newReindexer(mc, service, slClient)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				waitForSignal()
+				log.Info("Stopping the reindex, it will be resumed from the last completed page on the next run")
+				cancel()
+			}()
+
+			progress, err := reindexer.Run(ctx, transactionidutils.NewTransactionID(), *restart)
+			if err != nil {
+				closeProducers()
+				log.WithError(err).Fatalf("Reindex stopped at offset %d", progress.Offset)
+			}
+		}
+	})
+
+	app.Action = func() {
+		log.Infof("System code: %s, App Name: %s, Port: %s", *appSystemCode, *appName, *port)
+
+		router := mux.NewRouter()
+
+		var handlers []*notifier.Handler
+		var services []*notifier.Service
+		for _, mc := range models {
+			service, slClient := newService(mc)
+			service.StartCatchUp(catchUpIntervalDuration)
+
+			queue, err := notifier.NewFileQueue(mc.dataDir)
+			if err != nil {
+				log.WithError(err).Fatalf("Unable to open the notification queue of model %s", mc.Model)
+			}
+
+			handlers = append(handlers, notifier.NewNotifierHandler(service, mc.Model, log,
+				notifier.WithQueue(queue),
+				notifier.WithReindexer(newReindexer(mc, service, slClient)),
+				notifier.WithHandlerMetrics(metrics.DefaultRegistry),
+			))
+			services = append(services, service)
+		}
+		notifier.NewModelRouter(handlers...).RegisterEndpoints(router)
 
 		healthServiceConfig := &notifier.HealthServiceConfig{
 			AppSystemCode:          *appSystemCode,
 			AppName:                *appName,
 			Description:            appDescription,
-			SmartlogicModel:        *smartlogicModel,
-			SmartlogicModelConcept: *smartlogicHealthcheckConcept,
+			SmartlogicModel:        models[0].Model,
+			SmartlogicModelConcept: models[0].HealthcheckConcept,
 			SuccessCacheTime:       smartlogicHealthCacheDuration,
 		}
-		healthService, err := notifier.NewHealthService(service, healthServiceConfig, log)
+		var healthOpts []func(*notifier.HealthService)
+		for i, mc := range models[1:] {
+			healthOpts = append(healthOpts, notifier.WithModelHealthCheck(services[i+1], mc.Model, mc.HealthcheckConcept))
+		}
+		// every producer is checked, as the models may publish to different topics
+		topics := make([]string, 0, len(producers))
+		for topic := range producers {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		for _, topic := range topics {
+			healthOpts = append(healthOpts, notifier.WithKafkaHealthCheck(topic, producers[topic].ConnectivityCheck))
+		}
+		healthService, err := notifier.NewHealthService(services[0], healthServiceConfig, log, healthOpts...)
 		if err != nil {
 			log.Fatalf("Failed to initialize health check service: %v", err)
 		}
@@ -196,6 +725,18 @@ func main() {
 		waitForSignal()
 	}
 	err = app.Run(os.Args)
+	closeProducers()
+	for _, lock := range dataDirLocks {
+		_ = lock.Release()
+	}
+	if tracerProvider != nil {
+		// the spans which were not exported yet are flushed
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if shutdownErr := tracerProvider.Shutdown(ctx); shutdownErr != nil {
+			log.WithError(shutdownErr).Error("Failed to export the remaining traces")
+		}
+		cancel()
+	}
 	if err != nil {
 		log.Errorf("App could not start, error=[%s]\n", err)
 		return
@@ -208,18 +749,14 @@ func waitForSignal() {
 	<-ch
 }
 
-func getResilientClient(timeout time.Duration) *pester.Client {
-	c := &http.Client{
+// getHTTPClient returns the client of the requests to Smartlogic. The Smartlogic client retries the failed requests itself,
+// so that it can honor the Retry-After of Smartlogic.
+func getHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
 		Transport: &http.Transport{
 			MaxIdleConnsPerHost: 10,
 			MaxIdleConns:        10,
 		},
 		Timeout: timeout,
 	}
-	client := pester.NewExtendedClient(c)
-	client.Backoff = pester.ExponentialBackoff
-	client.MaxRetries = 5
-	client.Concurrency = 1
-
-	return client
 }
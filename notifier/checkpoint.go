@@ -0,0 +1,105 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const checkpointFileName = "checkpoint.json"
+
+// CheckpointStore keeps the sem:committed time of the last Smartlogic change which was fully processed.
+type CheckpointStore interface {
+	Load() (time.Time, error)
+	Save(lastCommitted time.Time) error
+}
+
+type checkpoint struct {
+	LastCommitted time.Time `json:"lastCommitted"`
+}
+
+// FileCheckpoint is a CheckpointStore which keeps the high-water mark in a file.
+type FileCheckpoint struct {
+	path string
+}
+
+// NewFileCheckpoint returns a CheckpointStore which keeps the high-water mark in the given directory.
+func NewFileCheckpoint(dir string) (*FileCheckpoint, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	return &FileCheckpoint{path: filepath.Join(dir, checkpointFileName)}, nil
+}
+
+// Load returns the stored high-water mark or the zero time if none was stored yet.
+func (c *FileCheckpoint) Load() (time.Time, error) {
+	b, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err = json.Unmarshal(b, &cp); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+	return cp.LastCommitted, nil
+}
+
+// Save replaces the stored high-water mark.
+func (c *FileCheckpoint) Save(lastCommitted time.Time) error {
+	b, err := json.Marshal(checkpoint{LastCommitted: lastCommitted})
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	return writeFileAtomic(c.path, b)
+}
+
+// memoryCheckpoint is a CheckpointStore which does not survive restarts. It is used when no durable store is configured.
+type memoryCheckpoint struct {
+	mu            sync.Mutex
+	lastCommitted time.Time
+}
+
+func (c *memoryCheckpoint) Load() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastCommitted, nil
+}
+
+func (c *memoryCheckpoint) Save(lastCommitted time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCommitted = lastCommitted
+	return nil
+}
+
+// writeFileAtomic writes the data to a temporary file and renames it over the given path,
+// so that a crash never leaves a partially written file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmpPath, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmpPath, err)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
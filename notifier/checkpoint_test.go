@@ -0,0 +1,30 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	cp, err := NewFileCheckpoint(dir)
+	require.NoError(t, err)
+
+	stored, err := cp.Load()
+	require.NoError(t, err)
+	assert.True(t, stored.IsZero())
+
+	lastCommitted := time.Date(2020, 4, 5, 10, 0, 0, 990000000, time.UTC)
+	require.NoError(t, cp.Save(lastCommitted))
+
+	cp, err = NewFileCheckpoint(dir)
+	require.NoError(t, err)
+
+	stored, err = cp.Load()
+	require.NoError(t, err)
+	assert.True(t, lastCommitted.Equal(stored))
+}
@@ -0,0 +1,51 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kafka"
+	"github.com/aws/aws-sdk-go-v2/service/kafka/types"
+)
+
+const (
+	clusterConfigTimeout      = 5 * time.Second
+	clusterDescriptionTimeout = 2 * time.Second
+)
+
+// clusterStateFunc returns the state of the Kafka cluster.
+type clusterStateFunc func() (types.ClusterState, error)
+
+// newMSKClusterState returns a clusterStateFunc describing the MSK cluster with the given ARN with the AWS API.
+// The cluster is described once, so that a wrong ARN or missing credentials are reported straight away.
+func newMSKClusterState(clusterArn string) (clusterStateFunc, error) {
+	parsedARN, err := arn.Parse(clusterArn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing cluster ARN: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterConfigTimeout)
+	defer cancel()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(parsedARN.Region))
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+
+	client := kafka.NewFromConfig(cfg)
+	state := func() (types.ClusterState, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), clusterDescriptionTimeout)
+		defer cancel()
+		cluster, err := client.DescribeClusterV2(ctx, &kafka.DescribeClusterV2Input{ClusterArn: &clusterArn})
+		if err != nil {
+			return "", err
+		}
+		return cluster.ClusterInfo.State, nil
+	}
+	if _, err = state(); err != nil {
+		return nil, fmt.Errorf("retrieving cluster state: %w", err)
+	}
+	return state, nil
+}
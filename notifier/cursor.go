@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+)
+
+const (
+	// maxChangesPageSize is the largest page of changes which can be requested on /concepts.
+	maxChangesPageSize = 1000
+)
+
+// changesCursor points at the next page of the changes made since a point in time. It is handed to the clients
+// of /concepts as an opaque string, so that they can page through the changes without keeping track of where they are.
+// The cursor holds the key of the changes after the last one read, so the changes committed while paging are not skipped.
+type changesCursor struct {
+	Since time.Time `json:"since"`
+	Seen  []string  `json:"seen,omitempty"`
+	Limit int       `json:"limit"`
+}
+
+func (c changesCursor) key() smartlogic.ChangesKey {
+	return smartlogic.ChangesKey{Since: c.Since, Seen: c.Seen}
+}
+
+func (c changesCursor) encode() string {
+	cursorJSON, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+func decodeChangesCursor(s string) (changesCursor, error) {
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return changesCursor{}, err
+	}
+	var c changesCursor
+	if err = json.Unmarshal(cursorJSON, &c); err != nil {
+		return changesCursor{}, err
+	}
+	if c.Since.IsZero() || c.Limit <= 0 || c.Limit > maxChangesPageSize {
+		return changesCursor{}, errors.New("invalid cursor")
+	}
+	return c, nil
+}
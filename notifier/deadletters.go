@@ -0,0 +1,316 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	deadLettersFileName = "dead-letters.log"
+	// legacyDeadLettersFileName is the file the dead letters were kept in as a whole, it is moved to the log on opening.
+	legacyDeadLettersFileName = "dead-letters.json"
+	// deadLettersCompactAfter is how many records the log can hold on top of the dead letters before it is compacted.
+	deadLettersCompactAfter = 1000
+)
+
+// DeadLetterStore keeps the concepts which failed to be published, so that they can be replayed later.
+type DeadLetterStore interface {
+	Add(d DeadLetter) error
+	Remove(uuid string) error
+	List() ([]DeadLetter, error)
+}
+
+// DeadLetter is a concept which failed to be published.
+// TransactionID is the transaction id of the request which tried to publish the concept for the last time.
+type DeadLetter struct {
+	UUID          string        `json:"uuid"`
+	Status        ConceptStatus `json:"status"`
+	Error         string        `json:"error"`
+	TransactionID string        `json:"transactionId"`
+	FirstFailedAt time.Time     `json:"firstFailedAt"`
+	LastFailedAt  time.Time     `json:"lastFailedAt"`
+	Attempts      int           `json:"attempts"`
+}
+
+type deadLetterRecord struct {
+	Op     string      `json:"op"`
+	UUID   string      `json:"uuid,omitempty"`
+	Letter *DeadLetter `json:"letter,omitempty"`
+}
+
+const (
+	deadLetterOpAdd    = "add"
+	deadLetterOpRemove = "remove"
+)
+
+// FileDeadLetterStore is a DeadLetterStore backed by an append-only log file, like FileQueue.
+// Every change is synced to disk before the call returns.
+type FileDeadLetterStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	letters map[string]DeadLetter
+	// records is the number of records in the log
+	records int
+}
+
+// NewFileDeadLetterStore opens the dead letters log in the given directory, creating it if needed.
+// The log is compacted on opening, so that it only contains the dead letters.
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dead letters directory: %w", err)
+	}
+
+	s := &FileDeadLetterStore{
+		path:    filepath.Join(dir, deadLettersFileName),
+		letters: map[string]DeadLetter{},
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	legacyPath := filepath.Join(dir, legacyDeadLettersFileName)
+	if err := s.loadLegacy(legacyPath); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(legacyPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove the previous dead letters file: %w", err)
+	}
+	return s, nil
+}
+
+func (s *FileDeadLetterStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open dead letters log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// a partially written record is expected if the service was stopped in the middle of a write
+			continue
+		}
+		switch rec.Op {
+		case deadLetterOpAdd:
+			if rec.Letter != nil {
+				s.letters[rec.Letter.UUID] = *rec.Letter
+			}
+		case deadLetterOpRemove:
+			delete(s.letters, rec.UUID)
+		}
+	}
+	return scanner.Err()
+}
+
+// loadLegacy loads the dead letters from the file they were kept in before the log, unless they are in the log already.
+func (s *FileDeadLetterStore) loadLegacy(path string) error {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read dead letters: %w", err)
+	}
+
+	var letters []DeadLetter
+	if err = json.Unmarshal(b, &letters); err != nil {
+		return fmt.Errorf("failed to decode dead letters: %w", err)
+	}
+	for _, d := range letters {
+		if _, ok := s.letters[d.UUID]; !ok {
+			s.letters[d.UUID] = d
+		}
+	}
+	return nil
+}
+
+// compact rewrites the log so that it contains only the dead letters and reopens it for appending.
+func (s *FileDeadLetterStore) compact() error {
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	letters := sortDeadLetters(s.letters)
+	for i := range letters {
+		if err := writeDeadLetterRecord(w, deadLetterRecord{Op: deadLetterOpAdd, Letter: &letters[i]}); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write compacted dead letters log: %w", err)
+	}
+	if err := writeFileAtomic(s.path, buf.Bytes()); err != nil {
+		return err
+	}
+	s.records = len(letters)
+
+	var err error
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letters log: %w", err)
+	}
+	return nil
+}
+
+// Add stores the failure of the concept. If the concept already failed before, its attempts are increased.
+func (s *FileDeadLetterStore) Add(d DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d = mergeDeadLetter(s.letters[d.UUID], d)
+	if err := s.append(deadLetterRecord{Op: deadLetterOpAdd, Letter: &d}); err != nil {
+		return err
+	}
+	s.letters[d.UUID] = d
+	return s.compactIfNeeded()
+}
+
+// Remove forgets the failure of the concept, e.g. because it was published successfully.
+func (s *FileDeadLetterStore) Remove(uuid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.letters[uuid]; !ok {
+		return nil
+	}
+	if err := s.append(deadLetterRecord{Op: deadLetterOpRemove, UUID: uuid}); err != nil {
+		return err
+	}
+	delete(s.letters, uuid)
+	return s.compactIfNeeded()
+}
+
+// List returns the dead letters, the earliest failures first.
+func (s *FileDeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortDeadLetters(s.letters), nil
+}
+
+// Close closes the underlying log file.
+func (s *FileDeadLetterStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// compactIfNeeded compacts the log once it holds mostly the history of the dead letters rather than the dead letters.
+func (s *FileDeadLetterStore) compactIfNeeded() error {
+	if len(s.letters) > 0 && s.records < len(s.letters)+deadLettersCompactAfter {
+		return nil
+	}
+	return s.compact()
+}
+
+func (s *FileDeadLetterStore) append(rec deadLetterRecord) error {
+	if s.file == nil {
+		return fmt.Errorf("dead letters log %s is closed", s.path)
+	}
+	w := bufio.NewWriter(s.file)
+	if err := writeDeadLetterRecord(w, rec); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write to dead letters log: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync dead letters log: %w", err)
+	}
+	s.records++
+	return nil
+}
+
+func writeDeadLetterRecord(w *bufio.Writer, rec deadLetterRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter record: %w", err)
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("failed to write dead letter record: %w", err)
+	}
+	return nil
+}
+
+// memoryDeadLetterStore is a DeadLetterStore which does not survive restarts. It is used when no durable store is configured.
+type memoryDeadLetterStore struct {
+	mu      sync.Mutex
+	letters map[string]DeadLetter
+}
+
+func newMemoryDeadLetterStore() *memoryDeadLetterStore {
+	return &memoryDeadLetterStore{letters: map[string]DeadLetter{}}
+}
+
+func (s *memoryDeadLetterStore) Add(d DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters[d.UUID] = mergeDeadLetter(s.letters[d.UUID], d)
+	return nil
+}
+
+func (s *memoryDeadLetterStore) Remove(uuid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.letters, uuid)
+	return nil
+}
+
+func (s *memoryDeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortDeadLetters(s.letters), nil
+}
+
+// mergeDeadLetter records the latest failure of a concept on top of its previous one, if there was any.
+func mergeDeadLetter(previous, latest DeadLetter) DeadLetter {
+	if latest.LastFailedAt.IsZero() {
+		latest.LastFailedAt = time.Now()
+	}
+	latest.FirstFailedAt = latest.LastFailedAt
+	latest.Attempts = 1
+	if previous.UUID != "" {
+		latest.FirstFailedAt = previous.FirstFailedAt
+		latest.Attempts = previous.Attempts + 1
+	}
+	return latest
+}
+
+func sortDeadLetters(m map[string]DeadLetter) []DeadLetter {
+	out := make([]DeadLetter, 0, len(m))
+	for _, d := range m {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].FirstFailedAt.Equal(out[j].FirstFailedAt) {
+			return out[i].UUID < out[j].UUID
+		}
+		return out[i].FirstFailedAt.Before(out[j].FirstFailedAt)
+	})
+	return out
+}
@@ -0,0 +1,119 @@
+package notifier
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileDeadLetterStore(t *testing.T) {
+	dir := t.TempDir()
+	firstFailure := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	secondFailure := firstFailure.Add(time.Hour)
+
+	store, err := NewFileDeadLetterStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Add(DeadLetter{UUID: "uuid1", Status: ConceptNotFound, Error: "concept does not exist", TransactionID: "tid_1", LastFailedAt: firstFailure}))
+	require.NoError(t, store.Add(DeadLetter{UUID: "uuid2", Status: ConceptKafkaError, Error: "kafka is down", TransactionID: "tid_1", LastFailedAt: firstFailure}))
+	require.NoError(t, store.Add(DeadLetter{UUID: "uuid1", Status: ConceptSmartlogicError, Error: "timeout", TransactionID: "tid_2", LastFailedAt: secondFailure}))
+	require.NoError(t, store.Remove("uuid2"))
+
+	store, err = NewFileDeadLetterStore(dir)
+	require.NoError(t, err)
+
+	letters, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, []DeadLetter{
+		{
+			UUID:          "uuid1",
+			Status:        ConceptSmartlogicError,
+			Error:         "timeout",
+			TransactionID: "tid_2",
+			FirstFailedAt: firstFailure,
+			LastFailedAt:  secondFailure,
+			Attempts:      2,
+		},
+	}, letters)
+}
+
+func TestFileDeadLetterStore_AppendsToTheLog(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileDeadLetterStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for _, uuid := range []string{"uuid1", "uuid2", "uuid1"} {
+		require.NoError(t, store.Add(DeadLetter{UUID: uuid, Status: ConceptKafkaError}))
+	}
+	require.NoError(t, store.Remove("uuid2"))
+	assert.Equal(t, 4, countLines(t, filepath.Join(dir, deadLettersFileName)), "every change should be appended as a record")
+
+	// a record cut short by the service stopping is ignored
+	f, err := os.OpenFile(filepath.Join(dir, deadLettersFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"add","letter":{"uuid":"uu`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := NewFileDeadLetterStore(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	letters, err := reopened.List()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, "uuid1", letters[0].UUID)
+	assert.Equal(t, 2, letters[0].Attempts)
+	assert.Equal(t, 1, countLines(t, filepath.Join(dir, deadLettersFileName)), "the log should be compacted on opening")
+
+	// the log is emptied once there are no dead letters left
+	require.NoError(t, reopened.Remove("uuid1"))
+	assert.Equal(t, 0, countLines(t, filepath.Join(dir, deadLettersFileName)))
+}
+
+func TestFileDeadLetterStore_CompactsTheLog(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileDeadLetterStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for i := 0; i < deadLettersCompactAfter+1; i++ {
+		require.NoError(t, store.Add(DeadLetter{UUID: "uuid1", Status: ConceptKafkaError}))
+	}
+	assert.Equal(t, 1, countLines(t, filepath.Join(dir, deadLettersFileName)))
+
+	letters, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, deadLettersCompactAfter+1, letters[0].Attempts)
+}
+
+func TestFileDeadLetterStore_MovesTheLegacyFileToTheLog(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `[{"uuid":"uuid1","status":"kafka_error","error":"kafka is down","transactionId":"tid_1",` +
+		`"firstFailedAt":"2020-04-05T10:00:00Z","lastFailedAt":"2020-04-05T11:00:00Z","attempts":2}]`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, legacyDeadLettersFileName), []byte(legacy), 0o644))
+
+	store, err := NewFileDeadLetterStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	letters, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, "uuid1", letters[0].UUID)
+	assert.Equal(t, 2, letters[0].Attempts)
+	assert.NoFileExists(t, filepath.Join(dir, legacyDeadLettersFileName))
+	assert.Equal(t, 1, countLines(t, filepath.Join(dir, deadLettersFileName)))
+}
+
+func countLines(t *testing.T, path string) int {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return bytes.Count(b, []byte("\n"))
+}
@@ -1,19 +1,26 @@
 package notifier
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TimeFormat is the format used to read time values from request parameters
@@ -28,24 +35,48 @@ var LastChangeLimit = time.Hour * 168
 type Handler struct {
 	notifier  Servicer
 	ticker    Ticker
+	queue     NotificationQueue
+	jobs      *jobRegistry
+	reindexer *Reindexer
 	requestCh chan notificationRequest
-	model     string
-	log       *logger.UPPLogger
+	// retryPolicy is the backoff of retrying the failed notifications
+	retryPolicy RetryPolicy
+	model       string
+	metrics     metrics.Registry
+	// pending is the number of notifications accepted and not processed yet
+	pending atomic.Int64
+	tracer  trace.Tracer
+	log     *logger.UPPLogger
 }
 
 func NewNotifierHandler(notifier Servicer, smartlogicModel string, log *logger.UPPLogger, opts ...func(*Handler)) *Handler {
 	h := &Handler{
 		notifier:  notifier,
 		ticker:    &ticker{ticker: time.NewTicker(5 * time.Second)},
+		queue:     newMemoryQueue(),
+		jobs:      newJobRegistry(maxJobs),
 		requestCh: make(chan notificationRequest, 1),
-		model:     smartlogicModel,
-		log:       log,
+		retryPolicy: RetryPolicy{
+			MaxAttempts:    10,
+			InitialBackoff: 30 * time.Second,
+			MaxBackoff:     10 * time.Minute,
+			Jitter:         0.2,
+		},
+		model:   smartlogicModel,
+		metrics: metrics.NewRegistry(),
+		tracer:  otel.Tracer(tracerName),
+		log:     log,
 	}
 
 	for _, opt := range opts {
 		opt(h)
 	}
 
+	pendingGauge := metricName("notifications", h.model, "pending")
+	h.metrics.Unregister(pendingGauge)
+	_ = h.metrics.Register(pendingGauge, metrics.NewFunctionalGauge(h.pending.Load))
+
+	go h.replayPendingRequests()
 	go h.processNotifyRequests()
 
 	return h
@@ -63,6 +94,35 @@ func WithTicker(t Ticker) func(*Handler) {
 	}
 }
 
+// WithQueue sets the queue used to persist the accepted notifications until they are processed.
+func WithQueue(q NotificationQueue) func(*Handler) {
+	return func(h *Handler) {
+		h.queue = q
+	}
+}
+
+// WithNotifyRetryPolicy sets how the notifications which failed to be processed are retried. A notification which fails
+// MaxAttempts times, or fails in a way retrying does not change, is given up on and acknowledged.
+func WithNotifyRetryPolicy(p RetryPolicy) func(*Handler) {
+	return func(h *Handler) {
+		h.retryPolicy = p
+	}
+}
+
+// WithHandlerMetrics adds the metrics of the notifications to the given registry.
+func WithHandlerMetrics(r metrics.Registry) func(*Handler) {
+	return func(h *Handler) {
+		h.metrics = r
+	}
+}
+
+// WithReindexer enables the endpoints to reindex the whole model.
+func WithReindexer(r *Reindexer) func(*Handler) {
+	return func(h *Handler) {
+		h.reindexer = r
+	}
+}
+
 func (h *Handler) HandleNotify(resp http.ResponseWriter, req *http.Request) {
 	vars := req.URL.Query()
 	err := validateQueryParams(h.model, &vars)
@@ -75,18 +135,57 @@ func (h *Handler) HandleNotify(resp http.ResponseWriter, req *http.Request) {
 		writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: err.Error()})
 		return
 	}
-	go func() {
-		transactionID := req.Header.Get(transactionidutils.TransactionIDHeader)
-		h.requestCh <- notificationRequest{
-			notifySince:   lastChange,
-			transactionID: transactionID,
-		}
-	}()
-	writeJSONResponseMessage(resp, http.StatusOK, responseData{Msg: "Concepts successfully ingested"})
+
+	n := QueuedNotification{
+		ID:            newNotificationID(),
+		NotifySince:   lastChange,
+		TransactionID: req.Header.Get(transactionidutils.TransactionIDHeader),
+		ReceivedAt:    time.Now(),
+		TraceParent:   traceParent(req.Context()),
+	}
+	// The notification is persisted before we respond, so that it is not lost if the service restarts before processing it.
+	err = h.queue.Add(n)
+	if err != nil {
+		h.log.WithError(err).WithTransactionID(n.TransactionID).Error("Failed to persist the notification")
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error persisting the notification", Err: err})
+		return
+	}
+	metrics.GetOrRegisterCounter(metricName("notifications", h.model, "received"), h.metrics).Inc(1)
+	h.jobs.add(n)
+	go h.enqueue(n)
+	writeJSONResponseMessage(resp, http.StatusOK, responseData{Msg: "Notification accepted for processing", JobID: n.ID})
 }
 
+func (h *Handler) HandleGetJob(resp http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	job, ok := h.jobs.get(id)
+	if !ok {
+		writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: "Job not found"})
+		return
+	}
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
+		return
+	}
+	writeResponseData(resp, http.StatusOK, "application/json", string(jobJSON))
+}
+
+// HandleGetConcepts responds with the uuids of the concepts changed since the lastChangeDate. If a limit or a cursor is given,
+// it responds with a page of them instead, and with the cursor of the next page in the X-Next-Cursor header unless it is the last page.
 func (h *Handler) HandleGetConcepts(resp http.ResponseWriter, req *http.Request) {
 	vars := req.URL.Query()
+	if vars.Get("cursor") != "" {
+		cursor, err := decodeChangesCursor(vars.Get("cursor"))
+		if err != nil {
+			writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: "Query parameter cursor is not valid"})
+			return
+		}
+		h.getConceptsPage(resp, vars, cursor)
+		return
+	}
+
 	lastChangeDate := vars.Get("lastChangeDate")
 	if lastChangeDate == "" {
 		writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: "Query parameter lastChangeDate was not set."})
@@ -99,9 +198,14 @@ func (h *Handler) HandleGetConcepts(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if vars.Get("limit") != "" {
+		h.getConceptsPage(resp, vars, changesCursor{Since: lastChange})
+		return
+	}
+
 	uuids, err := h.notifier.GetChangedConceptList(lastChange)
 	if err != nil {
-		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error getting the changes", Err: err})
+		writeSmartlogicError(resp, "There was an error getting the changes", err)
 		return
 	}
 	uuidsJson, err := json.Marshal(uuids)
@@ -112,6 +216,39 @@ func (h *Handler) HandleGetConcepts(resp http.ResponseWriter, req *http.Request)
 	writeResponseData(resp, http.StatusOK, "application/json", string(uuidsJson))
 }
 
+// getConceptsPage responds with the page of the changed concepts the cursor points at. The limit query parameter
+// overrides the size of the page of the cursor.
+func (h *Handler) getConceptsPage(resp http.ResponseWriter, vars url.Values, cursor changesCursor) {
+	if vars.Get("limit") != "" {
+		limit, err := strconv.Atoi(vars.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxChangesPageSize {
+			writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: fmt.Sprintf("Query parameter limit should be a number between 1 and %d", maxChangesPageSize)})
+			return
+		}
+		cursor.Limit = limit
+	}
+
+	page, err := h.notifier.GetConceptChangesAfter(cursor.key(), cursor.Limit)
+	if err != nil {
+		writeSmartlogicError(resp, "There was an error getting the changes", err)
+		return
+	}
+	uuids := page.UUIDs
+	if uuids == nil {
+		uuids = []string{}
+	}
+	uuidsJSON, err := json.Marshal(uuids)
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
+		return
+	}
+	if page.More {
+		next := changesCursor{Since: page.Next.Since, Seen: page.Next.Seen, Limit: cursor.Limit}
+		resp.Header().Set("X-Next-Cursor", next.encode())
+	}
+	writeResponseData(resp, http.StatusOK, "application/json", string(uuidsJSON))
+}
+
 func (h *Handler) HandleForceNotify(resp http.ResponseWriter, req *http.Request) {
 	type payload struct {
 		UUIDs []string `json:"uuids,omitempty"`
@@ -129,12 +266,145 @@ func (h *Handler) HandleForceNotify(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	err = h.notifier.ForceNotify(pl.UUIDs, req.Header.Get(transactionidutils.TransactionIDHeader))
-	if err != nil {
+	// the concepts which did not change since they were last published are skipped, unless the publishing is forced
+	force := req.URL.Query().Get("force") == "true"
+
+	results, err := h.notifier.ForceNotifyContext(req.Context(), pl.UUIDs, req.Header.Get(transactionidutils.TransactionIDHeader), force)
+	if err != nil && len(results) == 0 {
 		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error completing the force notify"})
 		return
 	}
-	writeResponseData(resp, http.StatusOK, "text/plain", "Concept notification completed")
+	writeForceNotifyResults(resp, results)
+}
+
+type forceNotifyResponse struct {
+	Message  string          `json:"message"`
+	Concepts []ConceptResult `json:"concepts"`
+}
+
+// writeForceNotifyResults responds with the outcome for each concept. The status is 200 if all the concepts were published
+// or did not change, 207 if only some of them were and 500 if none of them were.
+func writeForceNotifyResults(resp http.ResponseWriter, results []ConceptResult) {
+	var published int
+	for _, r := range results {
+		if r.Status.succeeded() {
+			published++
+		}
+	}
+
+	body := forceNotifyResponse{Message: "Concept notification completed", Concepts: results}
+	status := http.StatusOK
+	switch {
+	case published == len(results):
+	case published > 0:
+		status = http.StatusMultiStatus
+		body.Message = "Concept notification partially completed"
+	default:
+		status = http.StatusInternalServerError
+		body.Message = "There was an error completing the force notify"
+	}
+	if body.Concepts == nil {
+		body.Concepts = []ConceptResult{}
+	}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
+		return
+	}
+	writeResponseData(resp, status, "application/json", string(bodyJSON))
+}
+
+func (h *Handler) HandleGetDeadLetters(resp http.ResponseWriter, req *http.Request) {
+	letters, err := h.notifier.DeadLetters()
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error getting the dead letters", Err: err})
+		return
+	}
+	lettersJSON, err := json.Marshal(letters)
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
+		return
+	}
+	writeResponseData(resp, http.StatusOK, "application/json", string(lettersJSON))
+}
+
+func (h *Handler) HandleReplayDeadLetters(resp http.ResponseWriter, req *http.Request) {
+	type payload struct {
+		UUIDs []string `json:"uuids,omitempty"`
+	}
+	var pl payload
+	// the payload is optional, without it all the dead letters are replayed
+	err := json.NewDecoder(req.Body).Decode(&pl)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: "There was an error decoding the payload", Err: err})
+		return
+	}
+
+	results, err := h.notifier.ReplayDeadLetters(pl.UUIDs, req.Header.Get(transactionidutils.TransactionIDHeader))
+	if err != nil && len(results) == 0 {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error replaying the dead letters", Err: err})
+		return
+	}
+	writeForceNotifyResults(resp, results)
+}
+
+func (h *Handler) HandleGetReindex(resp http.ResponseWriter, req *http.Request) {
+	if !h.reindexEnabled(resp) {
+		return
+	}
+	progress, err := h.reindexer.Progress()
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error getting the reindex progress", Err: err})
+		return
+	}
+	writeReindexProgress(resp, http.StatusOK, progress)
+}
+
+func (h *Handler) HandleStartReindex(resp http.ResponseWriter, req *http.Request) {
+	if !h.reindexEnabled(resp) {
+		return
+	}
+	restart := req.URL.Query().Get("restart") == "true"
+
+	progress, err := h.reindexer.Start(req.Header.Get(transactionidutils.TransactionIDHeader), restart)
+	if errors.Is(err, ErrReindexRunning) {
+		writeJSONResponseMessage(resp, http.StatusConflict, responseData{Msg: "A reindex is already in progress"})
+		return
+	}
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error starting the reindex", Err: err})
+		return
+	}
+	writeReindexProgress(resp, http.StatusAccepted, progress)
+}
+
+func (h *Handler) HandleStopReindex(resp http.ResponseWriter, req *http.Request) {
+	if !h.reindexEnabled(resp) {
+		return
+	}
+	if !h.reindexer.Stop() {
+		writeJSONResponseMessage(resp, http.StatusConflict, responseData{Msg: "There is no reindex in progress"})
+		return
+	}
+	writeJSONResponseMessage(resp, http.StatusOK, responseData{Msg: "Reindex stopped"})
+}
+
+func (h *Handler) reindexEnabled(resp http.ResponseWriter) bool {
+	if h.reindexer == nil {
+		writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: "Reindex is not enabled"})
+		return false
+	}
+	return true
+}
+
+func writeReindexProgress(resp http.ResponseWriter, status int, progress ReindexProgress) {
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
+		return
+	}
+	writeResponseData(resp, status, "application/json", string(progressJSON))
 }
 
 func (h *Handler) HandleGetConcept(resp http.ResponseWriter, req *http.Request) {
@@ -146,41 +416,75 @@ func (h *Handler) HandleGetConcept(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	concept, err := h.notifier.GetConcept(uuid)
-	if err != nil {
-		errStatus := http.StatusInternalServerError
-		if errors.Is(err, smartlogic.ErrorConceptDoesNotExist) {
-			errStatus = http.StatusNotFound
+	var concept []byte
+	var err error
+	if raw := req.URL.Query().Get("properties"); raw != "" {
+		properties, parseErr := smartlogic.ParseConceptProperties(raw)
+		if parseErr != nil {
+			writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: "Query parameter properties is not valid", Err: parseErr})
+			return
 		}
-		writeJSONResponseMessage(resp, errStatus, responseData{Msg: "There was an error retrieving the concept", Err: err})
+		concept, err = h.notifier.GetConceptWithProperties(uuid, properties)
+	} else {
+		concept, err = h.notifier.GetConcept(uuid)
+	}
+	if err != nil {
+		writeSmartlogicError(resp, "There was an error retrieving the concept", err)
 		return
 	}
 	writeResponseData(resp, http.StatusOK, "application/ld+json", string(concept))
 }
 
+// RegisterEndpoints adds the endpoints of the handler to the given router. See ModelRouter for serving several models.
 func (h *Handler) RegisterEndpoints(router *mux.Router) {
-	notifyHandler := handlers.MethodHandler{
-		"GET": http.HandlerFunc(h.HandleNotify),
-	}
-	forceNotifyHandler := handlers.MethodHandler{
-		"POST": http.HandlerFunc(h.HandleForceNotify),
-	}
-	getConceptHandler := handlers.MethodHandler{
-		"GET": http.HandlerFunc(h.HandleGetConcept),
-	}
-	getConceptsHandler := handlers.MethodHandler{
-		"GET": http.HandlerFunc(h.HandleGetConcepts),
-	}
-
-	router.Handle("/notify", notifyHandler)
-	router.Handle("/force-notify", forceNotifyHandler)
-	router.Handle("/concept/{uuid}", getConceptHandler)
-	router.Handle("/concepts", getConceptsHandler)
+	NewModelRouter(h).RegisterEndpoints(router)
 }
 
 type notificationRequest struct {
+	id            string
 	notifySince   time.Time
 	transactionID string
+	traceParent   string
+	// attempt is the number of times the notification failed to be processed
+	attempt int
+}
+
+func (h *Handler) enqueue(n QueuedNotification) {
+	h.pending.Add(1)
+	h.requestCh <- notificationRequest{
+		id:            n.ID,
+		notifySince:   n.NotifySince,
+		transactionID: n.TransactionID,
+		traceParent:   n.TraceParent,
+	}
+}
+
+// retryLater enqueues the failed notifications again after a backoff. They are not acknowledged meanwhile,
+// so that they are replayed after a restart too.
+func (h *Handler) retryLater(batch []notificationRequest) {
+	for _, req := range batch {
+		req := req
+		req.attempt++
+		time.AfterFunc(h.retryPolicy.backoff(req.attempt), func() {
+			h.requestCh <- req
+		})
+	}
+}
+
+// replayPendingRequests enqueues the notifications which were accepted but not processed before the last shutdown.
+func (h *Handler) replayPendingRequests() {
+	pending, err := h.queue.Pending()
+	if err != nil {
+		h.log.WithError(err).Error("Failed to read the pending notifications")
+		return
+	}
+	if len(pending) > 0 {
+		h.log.Infof("Replaying %d pending notifications", len(pending))
+	}
+	for _, n := range pending {
+		h.jobs.add(n)
+		h.enqueue(n)
+	}
 }
 
 type ticker struct {
@@ -203,10 +507,12 @@ func (h *Handler) processNotifyRequests() {
 			continue
 		}
 
-		n := notificationRequest{notifySince: maxTimeValue}
+		var fresh, retried []notificationRequest
 		for req := range h.requestCh {
-			if n.notifySince.After(req.notifySince) {
-				n = req
+			if req.attempt == 0 {
+				fresh = append(fresh, req)
+			} else {
+				retried = append(retried, req)
 			}
 
 			if len(h.requestCh) == 0 {
@@ -214,16 +520,144 @@ func (h *Handler) processNotifyRequests() {
 			}
 		}
 
-		err := h.notifier.Notify(n.notifySince, n.transactionID)
-		if err != nil {
-			h.log.WithError(err).Errorf("Failed to notify for a change with transaction id %s since %v", n.transactionID, n.notifySince)
+		// The notifications being retried are not coalesced with the new ones, so that a notification which keeps failing
+		// does not hold back the changes made since.
+		for _, batch := range [][]notificationRequest{fresh, retried} {
+			if len(batch) > 0 {
+				h.processBatch(batch)
+			}
 		}
 	}
 }
 
+// processBatch publishes the changes of the coalesced notifications, i.e. the changes since the earliest of them.
+func (h *Handler) processBatch(batch []notificationRequest) {
+	n := notificationRequest{notifySince: maxTimeValue}
+	var ids []string
+	for _, req := range batch {
+		ids = append(ids, req.id)
+		if n.notifySince.After(req.notifySince) {
+			n = req
+		}
+	}
+
+	metrics.GetOrRegisterCounter(metricName("notifications", h.model, "coalesced"), h.metrics).Inc(int64(len(ids) - 1))
+
+	ctx, span := h.startNotifySpan(n, batch)
+	err := h.notifier.NotifyContext(ctx, n.notifySince, n.transactionID, h.jobs.progress(ids))
+	endSpan(span, err)
+	if err == nil {
+		h.jobs.finish(ids, nil)
+		h.recordPublished(n.notifySince)
+		h.acknowledge(ids)
+		return
+	}
+
+	metrics.GetOrRegisterCounter(metricName("notifications", h.model, "failed"), h.metrics).Inc(1)
+	var retry []notificationRequest
+	var retryIDs, givenUp []string
+	for _, req := range batch {
+		if permanentNotifyError(err) || req.attempt+1 >= h.retryPolicy.MaxAttempts {
+			givenUp = append(givenUp, req.id)
+		} else {
+			retry = append(retry, req)
+			retryIDs = append(retryIDs, req.id)
+		}
+	}
+	if len(retry) > 0 {
+		h.log.WithError(err).Errorf("Failed to notify for a change with transaction id %s since %v, retrying it later", n.transactionID, n.notifySince)
+		h.jobs.retrying(retryIDs, err)
+		// The notifications stay pending until they are processed.
+		h.retryLater(retry)
+	}
+	if len(givenUp) > 0 {
+		// the concepts which failed are kept in the dead letters, and the changes are caught up from the checkpoint
+		h.log.WithError(err).Errorf("Failed to notify for a change with transaction id %s since %v, giving up on it", n.transactionID, n.notifySince)
+		h.jobs.finish(givenUp, err)
+		h.acknowledge(givenUp)
+	}
+}
+
+// permanentNotifyError reports whether processing a notification failed in a way which retrying it does not change,
+// i.e. Smartlogic has no changes since its time or responds with invalid changes.
+func permanentNotifyError(err error) bool {
+	return errors.Is(err, ErrNoChangedConcepts) ||
+		errors.Is(err, smartlogic.ErrInvalidResponse) ||
+		errors.Is(err, smartlogic.ErrorConceptDoesNotExist)
+}
+
+// acknowledge removes the notifications with the given ids from the queue once they are processed or given up on.
+func (h *Handler) acknowledge(ids []string) {
+	h.pending.Add(-int64(len(ids)))
+	if err := h.queue.Ack(ids...); err != nil {
+		h.log.WithError(err).Error("Failed to acknowledge the processed notifications")
+	}
+}
+
+// startNotifySpan starts the span of processing the coalesced notifications. The span continues the trace of the notification
+// whose changes are published, the earliest one, and is linked to the traces of the rest of them.
+func (h *Handler) startNotifySpan(n notificationRequest, batch []notificationRequest) (context.Context, trace.Span) {
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), spanContextOf(n.traceParent))
+	var links []trace.Link
+	for _, req := range batch {
+		if sc := spanContextOf(req.traceParent); sc.IsValid() && req.id != n.id {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	return h.tracer.Start(ctx, "notifier.Notify",
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			modelAttribute.String(h.model),
+			transactionIDAttribute.String(n.transactionID),
+			notifySinceAttribute.String(n.notifySince.Format(time.RFC3339)),
+			notificationsAttribute.Int(len(batch)),
+		),
+	)
+}
+
+// recordPublished records when the changes made since the given time were published. The last published time
+// stops advancing while the notifications are stuck, e.g. because Smartlogic or Kafka keep failing.
+func (h *Handler) recordPublished(notifySince time.Time) {
+	now := time.Now()
+	metrics.GetOrRegisterGaugeFloat64(metricName("notifications", h.model, "lagSeconds"), h.metrics).Update(now.Sub(notifySince).Seconds())
+	metrics.GetOrRegisterGauge(metricName("notifications", h.model, "lastPublished"), h.metrics).Update(now.Unix())
+}
+
+// smartlogicErrorStatus returns the status of the response to a request which failed because of the given Smartlogic error.
+// Smartlogic rejecting the credentials of the service or the number of requests is reported as the service being unavailable,
+// as there is nothing wrong with the request. Smartlogic failing or responding with an invalid body is reported as a bad gateway.
+func smartlogicErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, smartlogic.ErrorConceptDoesNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, smartlogic.ErrUnauthorized),
+		errors.Is(err, smartlogic.ErrRateLimited),
+		errors.Is(err, smartlogic.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, smartlogic.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, smartlogic.ErrUpstream),
+		errors.Is(err, smartlogic.ErrInvalidResponse):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// writeSmartlogicError responds to a request which failed because of the given Smartlogic error.
+// If Smartlogic asked to wait before retrying, the client is asked the same with the Retry-After header.
+func writeSmartlogicError(resp http.ResponseWriter, msg string, err error) {
+	var slErr *smartlogic.Error
+	if errors.As(err, &slErr) && slErr.RetryAfter > 0 {
+		seconds := int(math.Ceil(slErr.RetryAfter.Seconds()))
+		resp.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	writeJSONResponseMessage(resp, smartlogicErrorStatus(err), responseData{Msg: msg, Err: err})
+}
+
 type responseData struct {
-	Msg string
-	Err error
+	Msg   string
+	Err   error
+	JobID string
 }
 
 func writeResponseData(w http.ResponseWriter, statusCode int, contentType string, msg string) {
@@ -236,13 +670,23 @@ func writeResponseData(w http.ResponseWriter, statusCode int, contentType string
 }
 
 func writeJSONResponseMessage(w http.ResponseWriter, statusCode int, resp responseData) {
-	msg := `{"message": "` + resp.Msg + `"}`
+	msg := `{"message": ` + jsonString(resp.Msg)
 	if resp.Err != nil {
-		msg = `{"message": "` + resp.Msg + `", "error": "` + resp.Err.Error() + `"}`
+		msg += `, "error": ` + jsonString(resp.Err.Error())
+	}
+	if resp.JobID != "" {
+		msg += `, "jobId": ` + jsonString(resp.JobID)
 	}
+	msg += `}`
 	writeResponseData(w, statusCode, "application/json", msg)
 }
 
+// jsonString returns the given string as a JSON string, escaping the quotes and the control characters in it.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
 func (h *Handler) validateLastChangeDate(change string) (time.Time, error) {
 	lastChange, err := time.Parse(TimeFormat, change)
 	if err != nil {
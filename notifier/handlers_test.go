@@ -2,22 +2,30 @@ package notifier
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	"github.com/gorilla/mux"
+	"github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-const smartlogicModel = "FTTestModel"
+const (
+	smartlogicModel       = "FTTestModel"
+	notifyAcceptedPattern = `^\{"message": "Notification accepted for processing", "jobId": "[0-9a-f-]{36}"\}$`
+)
 
 func TestHandlers(t *testing.T) {
 	t.Parallel()
@@ -31,16 +39,18 @@ func TestHandlers(t *testing.T) {
 		requestBody string
 		resultCode  int
 		resultBody  string
+		bodyPattern string
 		mockService *mockService
 	}{
 		{
-			name:       "Notify - Success",
-			method:     "GET",
-			url:        fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, today),
-			resultBody: "{\"message\": \"Concepts successfully ingested\"}",
-			resultCode: 200,
+			name:        "Notify - Success",
+			method:      "GET",
+			url:         fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, today),
+			resultBody:  "IGNORE",
+			bodyPattern: notifyAcceptedPattern,
+			resultCode:  200,
 			mockService: &mockService{
-				notify: func(i time.Time, s string) error {
+				notify: func(i time.Time, s string, p ProgressFunc) error {
 					return nil
 				},
 			},
@@ -86,13 +96,14 @@ func TestHandlers(t *testing.T) {
 			mockService: &mockService{},
 		},
 		{
-			name:       "Notify - Error",
-			method:     "GET",
-			url:        fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, today),
-			resultBody: "{\"message\": \"Concepts successfully ingested\"}",
-			resultCode: 200,
+			name:        "Notify - Error",
+			method:      "GET",
+			url:         fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, today),
+			resultBody:  "IGNORE",
+			bodyPattern: notifyAcceptedPattern,
+			resultCode:  200,
 			mockService: &mockService{
-				notify: func(i time.Time, s string) error {
+				notify: func(i time.Time, s string, p ProgressFunc) error {
 					return errors.New("anerror")
 				},
 			},
@@ -103,10 +114,80 @@ func TestHandlers(t *testing.T) {
 			url:         "/force-notify",
 			requestBody: `{"uuids": ["1","2","3"]}`,
 			resultCode:  200,
-			resultBody:  "Concept notification completed",
+			resultBody:  `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published","transactionId":"tid_1"},{"uuid":"2","status":"published","transactionId":"tid_2"}]}`,
 			mockService: &mockService{
-				forceNotify: func(strings []string, s string) error {
-					return nil
+				forceNotify: func(strings []string, s string, force bool) ([]ConceptResult, error) {
+					return []ConceptResult{
+						{UUID: "1", Status: ConceptPublished, TransactionID: "tid_1"},
+						{UUID: "2", Status: ConceptPublished, TransactionID: "tid_2"},
+					}, nil
+				},
+			},
+		},
+		{
+			name:        "Force Notify - Unchanged concepts are skipped unless forced",
+			method:      "POST",
+			url:         "/force-notify",
+			requestBody: `{"uuids": ["1","2"]}`,
+			resultCode:  200,
+			resultBody:  `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published","transactionId":"tid_1"},{"uuid":"2","status":"unchanged"}]}`,
+			mockService: &mockService{
+				forceNotify: func(strings []string, s string, force bool) ([]ConceptResult, error) {
+					if force {
+						return nil, errors.New("unexpected force")
+					}
+					return []ConceptResult{
+						{UUID: "1", Status: ConceptPublished, TransactionID: "tid_1"},
+						{UUID: "2", Status: ConceptUnchanged},
+					}, nil
+				},
+			},
+		},
+		{
+			name:        "Force Notify - Forced",
+			method:      "POST",
+			url:         "/force-notify?force=true",
+			requestBody: `{"uuids": ["1"]}`,
+			resultCode:  200,
+			resultBody:  `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published","transactionId":"tid_1"}]}`,
+			mockService: &mockService{
+				forceNotify: func(strings []string, s string, force bool) ([]ConceptResult, error) {
+					if !force {
+						return nil, errors.New("expected force")
+					}
+					return []ConceptResult{{UUID: "1", Status: ConceptPublished, TransactionID: "tid_1"}}, nil
+				},
+			},
+		},
+		{
+			name:        "Force Notify - Partial success",
+			method:      "POST",
+			url:         "/force-notify",
+			requestBody: `{"uuids": ["1","2","3"]}`,
+			resultCode:  207,
+			resultBody:  `{"message":"Concept notification partially completed","concepts":[{"uuid":"1","status":"published","transactionId":"tid_1"},{"uuid":"2","status":"not_found","error":"concept does not exist"},{"uuid":"3","status":"kafka_error","transactionId":"tid_3","error":"kafka is down"}]}`,
+			mockService: &mockService{
+				forceNotify: func(strings []string, s string, force bool) ([]ConceptResult, error) {
+					return []ConceptResult{
+						{UUID: "1", Status: ConceptPublished, TransactionID: "tid_1"},
+						{UUID: "2", Status: ConceptNotFound, Error: "concept does not exist"},
+						{UUID: "3", Status: ConceptKafkaError, TransactionID: "tid_3", Error: "kafka is down"},
+					}, ConceptErrors{"2": smartlogic.ErrorConceptDoesNotExist, "3": errors.New("kafka is down")}
+				},
+			},
+		},
+		{
+			name:        "Force Notify - All concepts failed",
+			method:      "POST",
+			url:         "/force-notify",
+			requestBody: `{"uuids": ["1"]}`,
+			resultCode:  500,
+			resultBody:  `{"message":"There was an error completing the force notify","concepts":[{"uuid":"1","status":"smartlogic_error","error":"smartlogic returned status 500"}]}`,
+			mockService: &mockService{
+				forceNotify: func(strings []string, s string, force bool) ([]ConceptResult, error) {
+					return []ConceptResult{
+						{UUID: "1", Status: ConceptSmartlogicError, Error: "smartlogic returned status 500"},
+					}, ConceptErrors{"1": errors.New("smartlogic returned status 500")}
 				},
 			},
 		},
@@ -127,8 +208,8 @@ func TestHandlers(t *testing.T) {
 			resultCode:  500,
 			resultBody:  "{\"message\": \"There was an error completing the force notify\"}",
 			mockService: &mockService{
-				forceNotify: func(strings []string, s string) error {
-					return errors.New("error in force notify")
+				forceNotify: func(strings []string, s string, force bool) ([]ConceptResult, error) {
+					return nil, errors.New("error in force notify")
 				},
 			},
 		},
@@ -144,6 +225,38 @@ func TestHandlers(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "Get Concept - Properties",
+			method:     "GET",
+			url:        "/concept/1?properties=sem:guid,%3Chttp://www.ft.com/ontology/imageURL%3E",
+			resultCode: 200,
+			resultBody: "1 sem:guid|<http://www.ft.com/ontology/imageURL>",
+			mockService: &mockService{
+				getConceptProperties: func(s string, properties []string) ([]byte, error) {
+					return []byte(s + " " + strings.Join(properties, "|")), nil
+				},
+			},
+		},
+		{
+			name:       "Get Concept - All properties",
+			method:     "GET",
+			url:        "/concept/1?properties=*",
+			resultCode: 200,
+			resultBody: "1 *",
+			mockService: &mockService{
+				getConceptProperties: func(s string, properties []string) ([]byte, error) {
+					return []byte(s + " " + strings.Join(properties, "|")), nil
+				},
+			},
+		},
+		{
+			name:        "Get Concept - Invalid properties",
+			method:      "GET",
+			url:         "/concept/1?properties=skosxl:prefLabel",
+			resultCode:  400,
+			resultBody:  "{\"message\": \"Query parameter properties is not valid\", \"error\": \"the concept properties should include [] or sem:guid\"}",
+			mockService: &mockService{},
+		},
 		{
 			name:       "Get Concept - Error",
 			method:     "GET",
@@ -168,6 +281,66 @@ func TestHandlers(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "Get Concept - Unauthorized",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 503,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"smartlogic rejected the access token after 2 attempts\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, fmt.Errorf("%w after 2 attempts", smartlogic.ErrUnauthorized)
+				},
+			},
+		},
+		{
+			name:       "Get Concept - Smartlogic failure",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 502,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"smartlogic returned status 500 getting concept with uuid 11\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.KindUpstream, Op: "getting concept with uuid 11", StatusCode: 500}
+				},
+			},
+		},
+		{
+			name:       "Get Concept - Invalid response",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 502,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"invalid concept representation returned for uuid 11\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.KindInvalidResponse, Msg: "invalid concept representation returned for uuid 11", StatusCode: 200}
+				},
+			},
+		},
+		{
+			name:       "Get Concept - Timeout",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 504,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"smartlogic timed out getting concept with uuid 11\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.KindTimeout, Op: "getting concept with uuid 11"}
+				},
+			},
+		},
+		{
+			name:       "Get Concept - Unavailable",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 503,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"smartlogic is unavailable getting concept with uuid 11\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.KindUnavailable, Op: "getting concept with uuid 11"}
+				},
+			},
+		},
 		{
 			name:       "Get Concepts - Success",
 			method:     "GET",
@@ -216,6 +389,78 @@ func TestHandlers(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "Get Concepts - Unauthorized",
+			method:     "GET",
+			url:        fmt.Sprintf("/concepts?lastChangeDate=%s", today),
+			resultCode: 503,
+			resultBody: "{\"message\": \"There was an error getting the changes\", \"error\": \"smartlogic rejected the access token after 2 attempts\"}",
+			mockService: &mockService{
+				getChangedConceptList: func(t time.Time) ([]string, error) {
+					return nil, fmt.Errorf("%w after 2 attempts", smartlogic.ErrUnauthorized)
+				},
+			},
+		},
+		{
+			name:        "Get Job - Not found",
+			method:      "GET",
+			url:         "/jobs/unknown",
+			resultCode:  404,
+			resultBody:  "{\"message\": \"Job not found\"}",
+			mockService: &mockService{},
+		},
+		{
+			name:       "Get Dead Letters - Success",
+			method:     "GET",
+			url:        "/dead-letters",
+			resultCode: 200,
+			resultBody: `[{"uuid":"1","status":"not_found","error":"concept does not exist","transactionId":"tid_1","firstFailedAt":"2020-04-05T10:00:00Z","lastFailedAt":"2020-04-05T10:00:00Z","attempts":1}]`,
+			mockService: &mockService{
+				deadLetters: func() ([]DeadLetter, error) {
+					failedAt := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+					return []DeadLetter{
+						{UUID: "1", Status: ConceptNotFound, Error: "concept does not exist", TransactionID: "tid_1", FirstFailedAt: failedAt, LastFailedAt: failedAt, Attempts: 1},
+					}, nil
+				},
+			},
+		},
+		{
+			name:       "Replay Dead Letters - All",
+			method:     "POST",
+			url:        "/dead-letters/replay",
+			resultCode: 200,
+			resultBody: `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published","transactionId":"tid_1"}]}`,
+			mockService: &mockService{
+				replayDeadLetters: func(uuids []string, s string) ([]ConceptResult, error) {
+					if len(uuids) != 0 {
+						return nil, errors.New("expected to replay all dead letters")
+					}
+					return []ConceptResult{{UUID: "1", Status: ConceptPublished, TransactionID: "tid_1"}}, nil
+				},
+			},
+		},
+		{
+			name:        "Replay Dead Letters - Selected",
+			method:      "POST",
+			url:         "/dead-letters/replay",
+			requestBody: `{"uuids": ["2"]}`,
+			resultCode:  500,
+			resultBody:  `{"message":"There was an error completing the force notify","concepts":[{"uuid":"2","status":"kafka_error","transactionId":"tid_2","error":"kafka is down"}]}`,
+			mockService: &mockService{
+				replayDeadLetters: func(uuids []string, s string) ([]ConceptResult, error) {
+					return []ConceptResult{{UUID: uuids[0], Status: ConceptKafkaError, TransactionID: "tid_2", Error: "kafka is down"}}, ConceptErrors{uuids[0]: errors.New("kafka is down")}
+				},
+			},
+		},
+		{
+			name:        "Replay Dead Letters - Bad Payload",
+			method:      "POST",
+			url:         "/dead-letters/replay",
+			requestBody: `{"uuids": "2"]}`,
+			resultCode:  400,
+			resultBody:  "{\"message\": \"There was an error decoding the payload\", \"error\": \"invalid character ']' after object key:value pair\"}",
+			mockService: &mockService{},
+		},
 		{
 			name:        "__health",
 			method:      "GET",
@@ -232,6 +477,15 @@ func TestHandlers(t *testing.T) {
 			resultBody:  "IGNORE",
 			mockService: &mockService{},
 		},
+		{
+			name:        "__metrics",
+			method:      "GET",
+			url:         "/__metrics",
+			resultCode:  200,
+			resultBody:  "IGNORE",
+			bodyPattern: `"cmdline"`,
+			mockService: &mockService{},
+		},
 		{
 			name:        "__gtg",
 			method:      "GET",
@@ -274,6 +528,9 @@ func TestHandlers(t *testing.T) {
 			if d.resultBody != "IGNORE" {
 				assert.Equal(t, d.resultBody, body, d.name)
 			}
+			if d.bodyPattern != "" {
+				assert.Regexp(t, d.bodyPattern, body, d.name)
+			}
 
 		})
 	}
@@ -555,3 +812,595 @@ func TestGettingSmartlogicChangesOneRequestAtATime(t *testing.T) {
 		})
 	}
 }
+
+func TestPendingNotificationsAreReplayedOnStartup(t *testing.T) {
+	t.Parallel()
+
+	notifySince := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	queue := newMemoryQueue()
+	assert.NoError(t, queue.Add(QueuedNotification{
+		ID:            "id1",
+		NotifySince:   notifySince,
+		TransactionID: "tid_replayed",
+		ReceivedAt:    time.Now(),
+	}))
+
+	type notifyCall struct {
+		since         time.Time
+		transactionID string
+	}
+	calls := make(chan notifyCall, 1)
+	svc := &mockService{
+		notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+			calls <- notifyCall{since: since, transactionID: transactionID}
+			return nil
+		},
+	}
+
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	_ = NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk), WithQueue(queue))
+
+	select {
+	case call := <-calls:
+		assert.Equal(t, notifySince, call.since)
+		assert.Equal(t, "tid_replayed", call.transactionID)
+	case <-time.After(time.Second):
+		t.Fatal("pending notification was not replayed")
+	}
+
+	assert.Eventually(t, func() bool {
+		pending, err := queue.Pending()
+		return err == nil && len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFailedNotificationsStayQueued(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	queue, err := NewFileQueue(dir)
+	require.NoError(t, err)
+
+	failed := make(chan struct{}, 1)
+	svc := &mockService{
+		notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+			select {
+			case failed <- struct{}{}:
+			default:
+			}
+			return errors.New("smartlogic is down")
+		},
+	}
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk), WithQueue(queue))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("X-Request-Id", "tid_failed")
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("notification was not processed")
+	}
+	require.NoError(t, queue.Close())
+
+	reopened, err := NewFileQueue(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	pending, err := reopened.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "tid_failed", pending[0].TransactionID)
+}
+
+func TestFailedNotificationsAreRetried(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var calls int
+	svc := &mockService{
+		notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			if calls == 1 {
+				return errors.New("smartlogic is down")
+			}
+			return nil
+		},
+	}
+	queue := replayedQueue{memoryQueue: newMemoryQueue(), replayed: make(chan struct{})}
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk), WithQueue(queue),
+		WithNotifyRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}))
+	<-queue.replayed
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var accepted struct {
+		JobID string `json:"jobId"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &accepted))
+
+	assert.Eventually(t, func() bool {
+		pending, err := queue.memoryQueue.Pending()
+		return err == nil && len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, 2, calls)
+	mu.Unlock()
+	job, ok := handler.jobs.get(accepted.JobID)
+	require.True(t, ok)
+	assert.Equal(t, JobDone, job.Status)
+	assert.Empty(t, job.Error)
+}
+
+func TestFailedNotificationsAreGivenUp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		err           error
+		expectedCalls int
+	}{
+		{name: "after the last attempt", err: errors.New("smartlogic is down"), expectedCalls: 3},
+		{name: "without changes", err: fmt.Errorf("%w since now", ErrNoChangedConcepts), expectedCalls: 1},
+		{name: "with invalid changes", err: fmt.Errorf("failed to fetch the list of changed concepts: %w", smartlogic.ErrInvalidResponse), expectedCalls: 1},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var calls int
+			svc := &mockService{
+				notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+					mu.Lock()
+					defer mu.Unlock()
+					calls++
+					return test.err
+				},
+			}
+			queue := replayedQueue{memoryQueue: newMemoryQueue(), replayed: make(chan struct{})}
+			tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+			handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk), WithQueue(queue),
+				WithNotifyRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}))
+			<-queue.replayed
+			m := mux.NewRouter()
+			handler.RegisterEndpoints(m)
+
+			url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, time.Now().Format(TimeFormat))
+			req, _ := http.NewRequest("GET", url, nil)
+			rr := httptest.NewRecorder()
+			m.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+			var accepted struct {
+				JobID string `json:"jobId"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &accepted))
+
+			assert.Eventually(t, func() bool {
+				pending, err := queue.memoryQueue.Pending()
+				return err == nil && len(pending) == 0
+			}, time.Second, 10*time.Millisecond)
+			// no retry is left once the notification is acknowledged
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			assert.Equal(t, test.expectedCalls, calls)
+			mu.Unlock()
+			job, ok := handler.jobs.get(accepted.JobID)
+			require.True(t, ok)
+			assert.Equal(t, JobFailed, job.Status)
+			assert.Equal(t, test.err.Error(), job.Error)
+		})
+	}
+}
+
+func TestRetriedNotificationsDoNotHoldBackNewOnes(t *testing.T) {
+	t.Parallel()
+
+	failing := time.Now().Add(-time.Hour)
+	var mu sync.Mutex
+	var published []time.Time
+	svc := &mockService{
+		notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+			if since.Before(failing.Add(time.Minute)) {
+				return errors.New("smartlogic is down")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			published = append(published, since)
+			return nil
+		},
+	}
+	queue := replayedQueue{memoryQueue: newMemoryQueue(), replayed: make(chan struct{})}
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk), WithQueue(queue),
+		WithNotifyRetryPolicy(RetryPolicy{MaxAttempts: 1000, InitialBackoff: 10 * time.Millisecond}))
+	<-queue.replayed
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	notify := func(lastChange time.Time, transactionID string) {
+		url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, lastChange.Format(TimeFormat))
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("X-Request-Id", transactionID)
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	notify(failing, "tid_failing")
+	// the new notification arrives while the failing one is being retried
+	time.Sleep(50 * time.Millisecond)
+	notify(time.Now(), "tid_new")
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		pending, err := queue.memoryQueue.Pending()
+		return err == nil && len(pending) == 1 && pending[0].TransactionID == "tid_failing"
+	}, time.Second, 10*time.Millisecond)
+}
+
+type failingQueue struct {
+	*memoryQueue
+}
+
+func (q failingQueue) Add(QueuedNotification) error {
+	return errors.New("disk full")
+}
+
+func TestNotifyFailsWhenNotificationCannotBePersisted(t *testing.T) {
+	t.Parallel()
+
+	svc := &mockService{}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithQueue(failingQueue{newMemoryQueue()}))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "{\"message\": \"There was an error persisting the notification\", \"error\": \"disk full\"}", rr.Body.String())
+}
+
+func TestGetConceptsRateLimited(t *testing.T) {
+	t.Parallel()
+
+	svc := &mockService{
+		getChangedConceptList: func(t time.Time) ([]string, error) {
+			return nil, &smartlogic.Error{Kind: smartlogic.KindRateLimited, StatusCode: 429, RetryAfter: 1500 * time.Millisecond}
+		},
+	}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger())
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	req, _ := http.NewRequest("GET", "/concepts?lastChangeDate="+time.Now().Format(TimeFormat), nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	assert.Equal(t, "{\"message\": \"There was an error getting the changes\", \"error\": \"smartlogic returned status 429\"}", rr.Body.String())
+}
+
+func TestGetConceptSmartlogicUnavailable(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"access_token": "token", "expires_in": 3600}`))
+			return
+		}
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	sl, err := smartlogic.NewSmartlogicClient(srv.Client(), srv.URL, smartlogicModel, "apiKey", "http://www.ft.com/thing/", logger.NewUnstructuredLogger(),
+		smartlogic.WithAuthenticator(&smartlogic.APIKeyAuth{TokenURL: srv.URL + "/token", APIKey: "apiKey"}),
+		smartlogic.WithRetries(0, time.Minute),
+	)
+	require.NoError(t, err)
+	handler := NewNotifierHandler(NewNotifierService(&mockKafkaClient{}, sl, logger.NewUnstructuredLogger()), smartlogicModel, logger.NewUnstructuredLogger())
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	req, _ := http.NewRequest("GET", "/concept/2d3e16e0-61cb-4322-8aff-3b01c59f4daa", nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+
+	// Smartlogic being down is passed on as such, with how long it asked to wait for
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "120", rr.Header().Get("Retry-After"))
+}
+
+func TestGetConceptsPages(t *testing.T) {
+	t.Parallel()
+
+	changed := []string{"1", "2", "3", "4", "5"}
+	start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	var requested []smartlogic.ChangesKey
+	svc := &mockService{
+		// the concept i is changed i seconds after the start
+		getConceptChangesAfter: func(key smartlogic.ChangesKey, limit int) (smartlogic.ConceptChanges, error) {
+			requested = append(requested, key)
+			page := smartlogic.ConceptChanges{UUIDs: []string{}, Next: key}
+			for i := int(key.Since.Sub(start) / time.Second); i < len(changed) && len(page.UUIDs) < limit; i++ {
+				page.UUIDs = append(page.UUIDs, changed[i])
+				page.Next = smartlogic.ChangesKey{Since: start.Add(time.Duration(i+1) * time.Second), Seen: []string{changed[i]}}
+			}
+			page.Size = len(page.UUIDs)
+			page.More = page.Size == limit
+			return page, nil
+		},
+	}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger())
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/concepts?limit=2&lastChangeDate=" + start.Format(TimeFormat))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `["1","2"]`, rr.Body.String())
+	cursor := rr.Header().Get("X-Next-Cursor")
+	require.NotEmpty(t, cursor)
+
+	rr = get("/concepts?cursor=" + cursor)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `["3","4"]`, rr.Body.String())
+	cursor = rr.Header().Get("X-Next-Cursor")
+	require.NotEmpty(t, cursor)
+
+	// the size of the page can be changed along the way
+	rr = get("/concepts?limit=3&cursor=" + cursor)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `["5"]`, rr.Body.String())
+	assert.Empty(t, rr.Header().Get("X-Next-Cursor"))
+
+	// every page is of the changes after the last one of the previous page
+	require.Len(t, requested, 3)
+	// the first one is of the changes since the lastChangeDate, less the wobble
+	assert.True(t, start.Add(-10*time.Millisecond).Equal(requested[0].Since))
+	assert.True(t, start.Add(2*time.Second).Equal(requested[1].Since))
+	assert.Equal(t, []string{"2"}, requested[1].Seen)
+	assert.True(t, start.Add(4*time.Second).Equal(requested[2].Since))
+}
+
+func TestGetConceptsPagesInvalidParameters(t *testing.T) {
+	t.Parallel()
+
+	handler := NewNotifierHandler(&mockService{}, smartlogicModel, logger.NewUnstructuredLogger())
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	tests := []struct {
+		url          string
+		expectedBody string
+	}{
+		{url: "/concepts?cursor=not-a-cursor", expectedBody: `{"message": "Query parameter cursor is not valid"}`},
+		{url: "/concepts?cursor=" + changesCursor{Since: time.Now(), Limit: 5000}.encode(), expectedBody: `{"message": "Query parameter cursor is not valid"}`},
+		{url: "/concepts?limit=0&lastChangeDate=" + time.Now().Format(TimeFormat), expectedBody: `{"message": "Query parameter limit should be a number between 1 and 1000"}`},
+		{url: "/concepts?limit=ten&lastChangeDate=" + time.Now().Format(TimeFormat), expectedBody: `{"message": "Query parameter limit should be a number between 1 and 1000"}`},
+		{url: "/concepts?limit=10", expectedBody: `{"message": "Query parameter lastChangeDate was not set."}`},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.url, nil)
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, test.url)
+		assert.Equal(t, test.expectedBody, rr.Body.String(), test.url)
+	}
+}
+
+func TestNotifyJobStatus(t *testing.T) {
+	t.Parallel()
+
+	svc := &mockService{
+		notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+			progress(JobFetching, nil)
+			progress(JobPublishing, []string{"uuid1", "uuid2"})
+			return ConceptErrors{"uuid2": errors.New("kafka is down")}
+		},
+	}
+
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("X-Request-Id", "tid_job")
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var accepted struct {
+		JobID string `json:"jobId"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &accepted))
+	assert.NotEmpty(t, accepted.JobID)
+
+	var job Job
+	assert.Eventually(t, func() bool {
+		req, _ := http.NewRequest("GET", "/jobs/"+accepted.JobID, nil)
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			return false
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			return false
+		}
+		// the notification is retried later, so the job is not failed yet
+		return job.Status == JobRetrying
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, accepted.JobID, job.ID)
+	assert.Equal(t, "tid_job", job.TransactionID)
+	assert.Equal(t, []string{"uuid1", "uuid2"}, job.UUIDs)
+	assert.Equal(t, map[string]string{"uuid2": "kafka is down"}, job.Errors)
+	assert.Equal(t, "There was an error with 1 concept ingestions", job.Error)
+}
+
+func TestReindexEndpoints(t *testing.T) {
+	t.Parallel()
+
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	svc := &mockService{
+		forceNotify: func(uuids []string, transactionID string, force bool) ([]ConceptResult, error) {
+			started <- struct{}{}
+			<-release
+			return nil, nil
+		},
+	}
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(10)}
+	reindexer := NewReindexer(svc, sl, logger.NewUnstructuredLogger())
+
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithReindexer(reindexer))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("X-Request-Id", "tid_reindex")
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("DELETE", "/reindex")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"message": "There is no reindex in progress"}`, rr.Body.String())
+
+	rr = serve("POST", "/reindex")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	var progress ReindexProgress
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &progress))
+	assert.Equal(t, ReindexRunning, progress.Status)
+	assert.Equal(t, "tid_reindex", progress.TransactionID)
+
+	rr = serve("POST", "/reindex?restart=true")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"message": "A reindex is already in progress"}`, rr.Body.String())
+
+	<-started
+	rr = serve("DELETE", "/reindex")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		rr := serve("GET", "/reindex")
+		return rr.Code == http.StatusOK && json.Unmarshal(rr.Body.Bytes(), &progress) == nil && progress.Status != ReindexRunning
+	}, time.Second, 10*time.Millisecond)
+	// the stop came in while the only page of the model was being published, so that page is completed
+	assert.Equal(t, ReindexDone, progress.Status)
+	assert.Equal(t, 10, progress.Offset)
+}
+
+// replayedQueue tells when the pending notifications were read on startup,
+// so that the notifications accepted afterwards are not replayed as well.
+type replayedQueue struct {
+	*memoryQueue
+	replayed chan struct{}
+}
+
+func (q replayedQueue) Pending() ([]QueuedNotification, error) {
+	defer close(q.replayed)
+	return q.memoryQueue.Pending()
+}
+
+func TestNotifyMetrics(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var calls int
+	svc := &mockService{
+		notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+			mu.Lock()
+			calls++
+			first := calls == 1
+			mu.Unlock()
+			if first {
+				close(started)
+				<-release
+				return errors.New("kafka is down")
+			}
+			return nil
+		},
+	}
+
+	registry := metrics.NewRegistry()
+	queue := replayedQueue{memoryQueue: newMemoryQueue(), replayed: make(chan struct{})}
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk), WithQueue(queue), WithHandlerMetrics(registry),
+		WithNotifyRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}))
+	<-queue.replayed
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	notify := func() {
+		url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, time.Now().Add(-time.Minute).Format(TimeFormat))
+		req, _ := http.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+	counter := func(name string) int64 {
+		c, ok := registry.Get("notifications." + smartlogicModel + "." + name).(metrics.Counter)
+		if !ok {
+			return 0
+		}
+		return c.Count()
+	}
+	pending := registry.Get("notifications." + smartlogicModel + ".pending").(metrics.Gauge)
+
+	notify()
+	<-started
+	notify()
+	notify()
+	assert.Eventually(t, func() bool { return pending.Value() == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(3), counter("received"))
+
+	close(release)
+	assert.Eventually(t, func() bool { return pending.Value() == 0 }, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	// the failed notification is processed twice
+	assert.Equal(t, int64(4-calls), counter("coalesced"))
+	mu.Unlock()
+	assert.Equal(t, int64(1), counter("failed"))
+
+	lag := registry.Get("notifications." + smartlogicModel + ".lagSeconds").(metrics.GaugeFloat64)
+	assert.GreaterOrEqual(t, lag.Value(), 60.0)
+	lastPublished := registry.Get("notifications." + smartlogicModel + ".lastPublished").(metrics.Gauge)
+	assert.InDelta(t, time.Now().Unix(), lastPublished.Value(), 5)
+}
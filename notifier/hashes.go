@@ -0,0 +1,225 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const hashesFileName = "concept-hashes.log"
+
+// HashStore keeps the hash of the last payload published for every concept,
+// so that concepts which did not change are not published again.
+type HashStore interface {
+	Get(uuid string) (string, bool, error)
+	Set(uuid, hash string) error
+}
+
+type hashRecord struct {
+	UUID string `json:"uuid"`
+	Hash string `json:"hash"`
+}
+
+// FileHashStore is a HashStore backed by an append-only log file, the latest record of a concept wins.
+// The writes are not synced to disk, losing the latest hashes only means that the concepts are published again.
+type FileHashStore struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	hashes map[string]string
+}
+
+// NewFileHashStore opens the hash log in the given directory, creating it if needed.
+// The log is compacted on opening, so that it only contains the latest hash of every concept.
+func NewFileHashStore(dir string) (*FileHashStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create hash store directory: %w", err)
+	}
+
+	s := &FileHashStore{
+		path:   filepath.Join(dir, hashesFileName),
+		hashes: map[string]string{},
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileHashStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open hash log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec hashRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// a partially written record is expected if the service was stopped in the middle of a write
+			continue
+		}
+		s.hashes[rec.UUID] = rec.Hash
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the log so that it contains only the latest hash of every concept and reopens it for appending.
+func (s *FileHashStore) compact() error {
+	uuids := make([]string, 0, len(s.hashes))
+	for uuid := range s.hashes {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	var buf bytes.Buffer
+	for _, uuid := range uuids {
+		b, err := json.Marshal(hashRecord{UUID: uuid, Hash: s.hashes[uuid]})
+		if err != nil {
+			return fmt.Errorf("failed to encode hash record: %w", err)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(s.path, buf.Bytes()); err != nil {
+		return err
+	}
+
+	var err error
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open hash log: %w", err)
+	}
+	return nil
+}
+
+// Get returns the hash of the last payload published for the concept.
+func (s *FileHashStore) Get(uuid string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, ok := s.hashes[uuid]
+	return hash, ok, nil
+}
+
+// Set records the hash of the payload published for the concept.
+func (s *FileHashStore) Set(uuid, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hashes[uuid] == hash {
+		return nil
+	}
+	if s.file == nil {
+		return fmt.Errorf("hash log %s is closed", s.path)
+	}
+	b, err := json.Marshal(hashRecord{UUID: uuid, Hash: hash})
+	if err != nil {
+		return fmt.Errorf("failed to encode hash record: %w", err)
+	}
+	if _, err = s.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write to hash log: %w", err)
+	}
+	s.hashes[uuid] = hash
+	return nil
+}
+
+// Close closes the underlying log file.
+func (s *FileHashStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// memoryHashStore is a HashStore which does not survive restarts. It is used when no durable store is configured.
+type memoryHashStore struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func newMemoryHashStore() *memoryHashStore {
+	return &memoryHashStore{hashes: map[string]string{}}
+}
+
+func (s *memoryHashStore) Get(uuid string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, ok := s.hashes[uuid]
+	return hash, ok, nil
+}
+
+func (s *memoryHashStore) Set(uuid, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[uuid] = hash
+	return nil
+}
+
+// conceptHash returns the hash of the json-ld representation of a concept. Representations which differ only
+// in formatting, in the order of the keys or in the order of the values of a property have the same hash.
+// A payload which is not valid json is hashed as it is.
+func conceptHash(concept []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(concept, &v); err == nil {
+		if canonical, err := json.Marshal(canonicalJSON(v, false)); err == nil {
+			concept = canonical
+		}
+	}
+	sum := sha256.Sum256(concept)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON sorts the arrays in the decoded json value, as the values of json-ld properties are unordered,
+// except for the values of @list. The keys of the objects are sorted by json.Marshal.
+func canonicalJSON(v interface{}, ordered bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = canonicalJSON(e, k == "@list")
+		}
+		return t
+	case []interface{}:
+		encoded := make([]string, len(t))
+		for i, e := range t {
+			t[i] = canonicalJSON(e, false)
+			b, _ := json.Marshal(t[i])
+			encoded[i] = string(b)
+		}
+		if !ordered {
+			sort.Sort(byEncoding{values: t, encoded: encoded})
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+type byEncoding struct {
+	values  []interface{}
+	encoded []string
+}
+
+func (b byEncoding) Len() int           { return len(b.values) }
+func (b byEncoding) Less(i, j int) bool { return b.encoded[i] < b.encoded[j] }
+func (b byEncoding) Swap(i, j int) {
+	b.values[i], b.values[j] = b.values[j], b.values[i]
+	b.encoded[i], b.encoded[j] = b.encoded[j], b.encoded[i]
+}
@@ -0,0 +1,89 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileHashStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewFileHashStore(dir)
+	require.NoError(t, err)
+
+	_, ok, err := s.Get("uuid1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, s.Set("uuid1", "hash1"))
+	require.NoError(t, s.Set("uuid2", "hash2"))
+	require.NoError(t, s.Set("uuid1", "hash3"))
+	require.NoError(t, s.Close())
+
+	s, err = NewFileHashStore(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	hash, ok, err := s.Get("uuid1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "hash3", hash)
+
+	hash, ok, err = s.Get("uuid2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "hash2", hash)
+
+	// the log was compacted on opening
+	b, err := os.ReadFile(filepath.Join(dir, hashesFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"uuid\":\"uuid1\",\"hash\":\"hash3\"}\n{\"uuid\":\"uuid2\",\"hash\":\"hash2\"}\n", string(b))
+}
+
+func TestConceptHash(t *testing.T) {
+	testCases := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{
+			name:  "formatting and key order",
+			a:     `{"@id":"1","sem:guid":[{"@value":"1"}]}`,
+			b:     "{\n  \"sem:guid\": [ {\"@value\": \"1\"} ],\n  \"@id\": \"1\"\n}",
+			equal: true,
+		},
+		{
+			name:  "order of property values",
+			a:     `{"skosxl:altLabel":[{"@value":"a"},{"@value":"b"}]}`,
+			b:     `{"skosxl:altLabel":[{"@value":"b"},{"@value":"a"}]}`,
+			equal: true,
+		},
+		{
+			name:  "order of list values",
+			a:     `{"ordered":{"@list":["a","b"]}}`,
+			b:     `{"ordered":{"@list":["b","a"]}}`,
+			equal: false,
+		},
+		{
+			name:  "different values",
+			a:     `{"@id":"1"}`,
+			b:     `{"@id":"2"}`,
+			equal: false,
+		},
+		{
+			name:  "invalid json",
+			a:     `not json`,
+			b:     `not  json`,
+			equal: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.equal, conceptHash([]byte(test.a)) == conceptHash([]byte(test.b)))
+		})
+	}
+}
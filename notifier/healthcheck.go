@@ -12,8 +12,10 @@ import (
 	"github.com/Financial-Times/http-handlers-go/v2/httphandlers"
 	"github.com/Financial-Times/service-status-go/gtg"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	"github.com/gorilla/mux"
 	"github.com/rcrowley/go-metrics"
+	"github.com/rcrowley/go-metrics/exp"
 )
 
 const (
@@ -23,12 +25,28 @@ const (
 
 // HealthService is responsible for gtg and health checks.
 type HealthService struct {
+	config   *HealthServiceConfig
+	notifier Servicer
+	models   []*modelHealth
+	kafka    []kafkaHealth
+	Checks   []fthealth.Check
+	log      *logger.UPPLogger
+}
+
+// modelHealth holds the cached result of the connectivity check of a Smartlogic model.
+type modelHealth struct {
 	sync.RWMutex
-	config            *HealthServiceConfig
 	notifier          Servicer
-	Checks            []fthealth.Check
+	model             string
+	concept           string
 	checkSuccessCache bool
-	log               *logger.UPPLogger
+	checkErr          error
+}
+
+// kafkaHealth checks the connectivity of the producer of a Kafka topic.
+type kafkaHealth struct {
+	topic string
+	check func() error
 }
 
 type HealthServiceConfig struct {
@@ -63,7 +81,9 @@ func (c *HealthServiceConfig) Validate() error {
 }
 
 // NewHealthService initialises the HealthCheck service but doesn't start the updating of the health check result.
-func NewHealthService(notifier Servicer, config *HealthServiceConfig, log *logger.UPPLogger) (*HealthService, error) {
+// The model in the config is checked with the given notifier, further models can be added with WithModelHealthCheck.
+// Kafka is checked with the given notifier too, unless the producers are checked with WithKafkaHealthCheck.
+func NewHealthService(notifier Servicer, config *HealthServiceConfig, log *logger.UPPLogger, opts ...func(*HealthService)) (*HealthService, error) {
 	err := config.Validate()
 	if err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
@@ -72,45 +92,80 @@ func NewHealthService(notifier Servicer, config *HealthServiceConfig, log *logge
 	service := &HealthService{
 		config:   config,
 		notifier: notifier,
-		log:      log,
+		models: []*modelHealth{{
+			notifier: notifier,
+			model:    config.SmartlogicModel,
+			concept:  config.SmartlogicModelConcept,
+		}},
+		log: log,
+	}
+
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	if len(service.kafka) == 0 {
+		service.Checks = []fthealth.Check{service.kafkaHealthCheck(kafkaHealth{check: notifier.CheckKafkaConnectivity})}
 	}
-	service.Checks = []fthealth.Check{
-		service.kafkaHealthCheck(),
-		service.smartlogicHealthCheck(),
+	for _, k := range service.kafka {
+		service.Checks = append(service.Checks, service.kafkaHealthCheck(k))
+	}
+	for _, m := range service.models {
+		service.Checks = append(service.Checks, service.smartlogicHealthCheck(m))
 	}
 	return service, nil
 }
 
+// WithModelHealthCheck adds the check of the connectivity to another Smartlogic model,
+// which is done by getting the given concept with the given notifier.
+func WithModelHealthCheck(notifier Servicer, model, concept string) func(*HealthService) {
+	return func(hs *HealthService) {
+		hs.models = append(hs.models, &modelHealth{
+			notifier: notifier,
+			model:    model,
+			concept:  concept,
+		})
+	}
+}
+
+// WithKafkaHealthCheck adds the check of the connectivity of the producer of the given Kafka topic,
+// so that every producer is checked when the models publish to different topics.
+func WithKafkaHealthCheck(topic string, check func() error) func(*HealthService) {
+	return func(hs *HealthService) {
+		hs.kafka = append(hs.kafka, kafkaHealth{topic: topic, check: check})
+	}
+}
+
 // Start starts separate go routine responsible for updating the cached result of the gtg/health check.
 func (hs *HealthService) Start() {
-	go func() {
-		// perform connectivity check and cache the result
-		err := hs.updateSmartlogicSuccessCache()
-		if err != nil {
-			hs.log.WithError(err).Error("could not perform Smartlogic connectivity check")
-		}
-		ticker := time.NewTicker(hs.config.SuccessCacheTime)
-		defer ticker.Stop()
-		for range ticker.C {
-			err := hs.updateSmartlogicSuccessCache()
+	for _, m := range hs.models {
+		go func(m *modelHealth) {
+			// perform connectivity check and cache the result
+			err := hs.updateSmartlogicSuccessCache(m)
 			if err != nil {
-				hs.log.WithError(err).Error("could not perform latest Smartlogic connectivity check")
+				hs.log.WithError(err).Errorf("could not perform Smartlogic connectivity check for model %s", m.model)
 			}
-		}
-	}()
+			ticker := time.NewTicker(hs.config.SuccessCacheTime)
+			defer ticker.Stop()
+			for range ticker.C {
+				err := hs.updateSmartlogicSuccessCache(m)
+				if err != nil {
+					hs.log.WithError(err).Errorf("could not perform latest Smartlogic connectivity check for model %s", m.model)
+				}
+			}
+		}(m)
+	}
 }
 
-// updateSmartlogicSuccessCache tries to get concept from the Smartlogic model, which uuid is given in the config
-// of the health check service, and based on the success of the check updates the HealthService cache.
-func (hs *HealthService) updateSmartlogicSuccessCache() error {
-	_, err := hs.notifier.GetConcept(hs.config.SmartlogicModelConcept)
+// updateSmartlogicSuccessCache tries to get the health check concept from the Smartlogic model
+// and based on the success of the check updates the cache of the model.
+func (hs *HealthService) updateSmartlogicSuccessCache(m *modelHealth) error {
+	_, err := m.notifier.GetConcept(m.concept)
 	if err != nil {
-		hs.log.WithError(err).Errorf("health check concept %s couldn't be retrieved", hs.config.SmartlogicModelConcept)
-		hs.setCheckSuccessCache(false)
-		return err
+		hs.log.WithError(err).Errorf("health check concept %s couldn't be retrieved", m.concept)
 	}
-	hs.setCheckSuccessCache(true)
-	return nil
+	m.setCheckResult(err)
+	return err
 }
 
 // RegisterAdminEndpoints adds the admin endpoints to the given router
@@ -118,6 +173,12 @@ func (hs *HealthService) RegisterAdminEndpoints(router *mux.Router) http.Handler
 	router.HandleFunc("/__health", fthealth.Handler(hs.HealthcheckHandler()))
 	router.HandleFunc(status.GTGPath, status.NewGoodToGoHandler(hs.GtgCheck()))
 	router.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
+	router.Handle("/__metrics", exp.ExpHandler(metrics.DefaultRegistry))
+	models := make([]string, 0, len(hs.models))
+	for _, m := range hs.models {
+		models = append(models, m.model)
+	}
+	router.Handle("/metrics", PrometheusHandler(metrics.DefaultRegistry, models...))
 
 	var monitoringRouter http.Handler = router
 	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(hs.log, monitoringRouter)
@@ -139,42 +200,72 @@ func (hs *HealthService) HealthcheckHandler() fthealth.TimedHealthCheck {
 	}
 }
 
-func (hs *HealthService) smartlogicHealthCheck() fthealth.Check {
+func (hs *HealthService) smartlogicHealthCheck(m *modelHealth) fthealth.Check {
 	return fthealth.Check{
 		BusinessImpact:   businessImpact,
-		Name:             fmt.Sprintf("Check connectivity to Smartlogic model %s", hs.config.SmartlogicModel),
+		Name:             fmt.Sprintf("Check connectivity to Smartlogic model %s", m.model),
 		PanicGuide:       panicGuideURL,
 		Severity:         3,
 		TechnicalSummary: `Check that Smartlogic is healthy and the API is accessible.  If it is, restart this service.`,
-		Checker:          hs.smartlogicConnectivityCheck,
+		Checker: func() (string, error) {
+			return hs.smartlogicConnectivityCheck(m)
+		},
 	}
 }
 
-func (hs *HealthService) kafkaHealthCheck() fthealth.Check {
+func (hs *HealthService) kafkaHealthCheck(k kafkaHealth) fthealth.Check {
+	name := "Check connectivity to Kafka"
+	if k.topic != "" {
+		name += fmt.Sprintf(" topic %s", k.topic)
+	}
 	return fthealth.Check{
 		BusinessImpact:   businessImpact,
-		Name:             "Check connectivity to Kafka",
+		Name:             name,
 		PanicGuide:       panicGuideURL,
 		Severity:         3,
 		TechnicalSummary: `Cannot connect to Kafka. Verify that Kafka is healthy in this cluster.`,
-		Checker:          hs.checkKafkaConnectivity,
+		Checker: func() (string, error) {
+			return hs.checkKafkaConnectivity(k)
+		},
 	}
 }
 
-// smartlogicConnectivityCheck always returns the cached result for the Smartlogic connectivity check.
-func (hs *HealthService) smartlogicConnectivityCheck() (string, error) {
-	if !hs.getCheckSuccessCache() {
-		msg := "latest Smartlogic connectivity check is unsuccessful"
+// smartlogicConnectivityCheck always returns the cached result for the Smartlogic connectivity check of the model.
+func (hs *HealthService) smartlogicConnectivityCheck(m *modelHealth) (string, error) {
+	if ok, err := m.getCheckResult(); !ok {
+		msg := fmt.Sprintf("latest Smartlogic connectivity check is unsuccessful for model %s", m.model)
+		if errors.Is(err, smartlogic.ErrUnauthorized) {
+			msg += ", Smartlogic rejects the credentials of the service"
+		}
 		hs.log.Error(msg)
 		return msg, errors.New(msg)
 	}
-	return "", nil
+	return tokenStatusMessage(m.notifier.SmartlogicTokenStatus(), time.Now()), nil
 }
 
-func (hs *HealthService) checkKafkaConnectivity() (string, error) {
-	err := hs.notifier.CheckKafkaConnectivity()
+// tokenStatusMessage describes the age and the expiry of the Smartlogic access token.
+func tokenStatusMessage(token smartlogic.TokenStatus, now time.Time) string {
+	if token.IssuedAt.IsZero() {
+		return "no Smartlogic access token was issued yet"
+	}
+	msg := fmt.Sprintf("Smartlogic access token issued %s ago", now.Sub(token.IssuedAt).Round(time.Second))
+	switch {
+	case token.ExpiresAt.IsZero():
+		return msg + ", its expiry is unknown"
+	case now.Before(token.ExpiresAt):
+		return msg + fmt.Sprintf(", expires in %s", token.ExpiresAt.Sub(now).Round(time.Second))
+	default:
+		return msg + fmt.Sprintf(", expired %s ago", now.Sub(token.ExpiresAt).Round(time.Second))
+	}
+}
+
+func (hs *HealthService) checkKafkaConnectivity(k kafkaHealth) (string, error) {
+	err := k.check()
 	if err != nil {
 		clientError := fmt.Sprint("Error verifying open connection to Kafka")
+		if k.topic != "" {
+			clientError += fmt.Sprintf(" topic %s", k.topic)
+		}
 		hs.log.WithError(err).Error(clientError)
 		return "Error connecting with Kafka", errors.New(clientError)
 	} else {
@@ -192,16 +283,17 @@ func (hs *HealthService) GtgCheck() gtg.StatusChecker {
 	return gtg.FailFastParallelCheck(sc)
 }
 
-func (hs *HealthService) getCheckSuccessCache() bool {
-	hs.RLock()
-	defer hs.RUnlock()
-	return hs.checkSuccessCache
+func (m *modelHealth) getCheckResult() (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return m.checkSuccessCache, m.checkErr
 }
 
-func (hs *HealthService) setCheckSuccessCache(val bool) {
-	hs.Lock()
-	defer hs.Unlock()
-	hs.checkSuccessCache = val
+func (m *modelHealth) setCheckResult(err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.checkSuccessCache = err == nil
+	m.checkErr = err
 }
 
 func gtgCheck(handler func() (string, error)) gtg.StatusChecker {
@@ -3,6 +3,7 @@ package notifier
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
@@ -339,3 +341,194 @@ func assertRequest(t *testing.T, m http.Handler, url string, expectedBody string
 	assert.Equal(t, expectedStatus, rr.Code, url)
 	assert.Contains(t, body, expectedBody, url)
 }
+
+func TestHealthServiceSeveralModels(t *testing.T) {
+	t.Parallel()
+
+	kafkaOK := func() error { return nil }
+	mainSvc := &mockService{
+		getConcept: func(s string) ([]byte, error) {
+			return []byte(""), nil
+		},
+		checkKafkaConnectivity: kafkaOK,
+	}
+	otherSvc := &mockService{
+		getConcept: func(s string) ([]byte, error) {
+			return nil, errors.New("couldn't retrieve concept from Smartlogic")
+		},
+		checkKafkaConnectivity: kafkaOK,
+	}
+
+	m := mux.NewRouter()
+	healthcheckCacheInterval := 10 * time.Millisecond
+	healthConfig := &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "testModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       healthcheckCacheInterval,
+	}
+	healthService, err := NewHealthService(mainSvc, healthConfig, logger.NewUnstructuredLogger(),
+		WithModelHealthCheck(otherSvc, "otherModel", "otherConcept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, healthService.Checks, 3)
+
+	healthService.Start()
+	_ = healthService.RegisterAdminEndpoints(m)
+
+	// give time the cache of the Healthcheck service to be updated (getConcept to be called)
+	time.Sleep(healthcheckCacheInterval)
+
+	assertRequest(t, m, "__gtg", "latest Smartlogic connectivity check is unsuccessful for model otherModel", 503)
+	assertRequest(t, m, "__health", "Check connectivity to Smartlogic model otherModel", 200)
+	assertRequest(t, m, "__health", "Check connectivity to Smartlogic model testModel", 200)
+}
+
+func TestHealthServiceKafkaTopics(t *testing.T) {
+	t.Parallel()
+
+	svc := &mockService{
+		getConcept: func(s string) ([]byte, error) {
+			return []byte(""), nil
+		},
+		checkKafkaConnectivity: func() error {
+			return errors.New("the producers should be checked instead")
+		},
+	}
+
+	m := mux.NewRouter()
+	healthcheckCacheInterval := 10 * time.Millisecond
+	healthConfig := &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "testModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       healthcheckCacheInterval,
+	}
+	healthService, err := NewHealthService(svc, healthConfig, logger.NewUnstructuredLogger(),
+		WithKafkaHealthCheck("SmartlogicConcept", func() error { return nil }),
+		WithKafkaHealthCheck("SmartlogicManagedLocation", func() error { return errors.New("no brokers") }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, healthService.Checks, 3)
+
+	healthService.Start()
+	_ = healthService.RegisterAdminEndpoints(m)
+
+	// give time the cache of the Healthcheck service to be updated (getConcept to be called)
+	time.Sleep(healthcheckCacheInterval)
+
+	assertRequest(t, m, "__gtg", "Error verifying open connection to Kafka topic SmartlogicManagedLocation", 503)
+	assertRequest(t, m, "__health", "Check connectivity to Kafka topic SmartlogicConcept", 200)
+	assertRequest(t, m, "__health", "Check connectivity to Kafka topic SmartlogicManagedLocation", 200)
+}
+
+func TestTokenStatusMessage(t *testing.T) {
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		token    smartlogic.TokenStatus
+		expected string
+	}{
+		{
+			name:     "no token",
+			expected: "no Smartlogic access token was issued yet",
+		},
+		{
+			name:     "valid token",
+			token:    smartlogic.TokenStatus{IssuedAt: now.Add(-5 * time.Minute), ExpiresAt: now.Add(55 * time.Minute)},
+			expected: "Smartlogic access token issued 5m0s ago, expires in 55m0s",
+		},
+		{
+			name:     "expired token",
+			token:    smartlogic.TokenStatus{IssuedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+			expected: "Smartlogic access token issued 2h0m0s ago, expired 1h0m0s ago",
+		},
+		{
+			name:     "unknown expiry",
+			token:    smartlogic.TokenStatus{IssuedAt: now.Add(-time.Minute)},
+			expected: "Smartlogic access token issued 1m0s ago, its expiry is unknown",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, tokenStatusMessage(test.token, now))
+		})
+	}
+}
+
+func TestHealthServiceReportsTokenStatus(t *testing.T) {
+	t.Parallel()
+
+	mockSvc := &mockService{
+		getConcept: func(s string) ([]byte, error) {
+			return []byte(""), nil
+		},
+		checkKafkaConnectivity: func() error {
+			return nil
+		},
+		tokenStatus: func() smartlogic.TokenStatus {
+			return smartlogic.TokenStatus{IssuedAt: time.Now().Add(-time.Minute), ExpiresAt: time.Now().Add(time.Hour)}
+		},
+	}
+	m := mux.NewRouter()
+	healthcheckCacheInterval := 10 * time.Millisecond
+	healthConfig := &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "testModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       healthcheckCacheInterval,
+	}
+	healthService, err := NewHealthService(mockSvc, healthConfig, logger.NewUnstructuredLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthService.Start()
+	_ = healthService.RegisterAdminEndpoints(m)
+
+	// give time the cache of the Healthcheck service to be updated (getConcept to be called)
+	time.Sleep(healthcheckCacheInterval)
+
+	assertRequest(t, m, "__health", `"checkOutput":"Smartlogic access token issued 1m0s ago, expires in`, 200)
+}
+
+func TestHealthServiceReportsRejectedCredentials(t *testing.T) {
+	t.Parallel()
+
+	mockSvc := &mockService{
+		getConcept: func(s string) ([]byte, error) {
+			return nil, fmt.Errorf("%w after 2 attempts", smartlogic.ErrUnauthorized)
+		},
+		checkKafkaConnectivity: func() error {
+			return nil
+		},
+	}
+	m := mux.NewRouter()
+	healthcheckCacheInterval := 10 * time.Millisecond
+	healthConfig := &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "testModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       healthcheckCacheInterval,
+	}
+	healthService, err := NewHealthService(mockSvc, healthConfig, logger.NewUnstructuredLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthService.Start()
+	_ = healthService.RegisterAdminEndpoints(m)
+
+	// give time the cache of the Healthcheck service to be updated (getConcept to be called)
+	time.Sleep(healthcheckCacheInterval)
+
+	assertRequest(t, m, "__gtg", "latest Smartlogic connectivity check is unsuccessful for model testModel, Smartlogic rejects the credentials of the service", 503)
+}
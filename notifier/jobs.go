@@ -0,0 +1,176 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStatus is the processing state of an accepted notification.
+type JobStatus string
+
+const (
+	JobQueued     JobStatus = "queued"
+	JobFetching   JobStatus = "fetching"
+	JobPublishing JobStatus = "publishing"
+	JobRetrying   JobStatus = "retrying"
+	JobDone       JobStatus = "done"
+	JobFailed     JobStatus = "failed"
+)
+
+// maxJobs is the number of jobs kept in memory, the oldest ones are forgotten first.
+const maxJobs = 1000
+
+// ProgressFunc is called when the processing of a notification moves to the next stage.
+type ProgressFunc func(status JobStatus, uuids []string)
+
+// ConceptErrors is returned when some of the concepts could not be published. It holds the error for every failed uuid.
+type ConceptErrors map[string]error
+
+func (e ConceptErrors) Error() string {
+	return fmt.Sprintf("There was an error with %d concept ingestions", len(e))
+}
+
+// Job is the status of an accepted notification.
+type Job struct {
+	ID            string            `json:"id"`
+	TransactionID string            `json:"transactionId,omitempty"`
+	NotifySince   time.Time         `json:"notifySince"`
+	Status        JobStatus         `json:"status"`
+	UUIDs         []string          `json:"uuids,omitempty"`
+	Errors        map[string]string `json:"errors,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+type jobRegistry struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+	max  int
+}
+
+func newJobRegistry(max int) *jobRegistry {
+	return &jobRegistry{
+		jobs: map[string]*Job{},
+		max:  max,
+	}
+}
+
+func (r *jobRegistry) add(n QueuedNotification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.jobs[n.ID] = &Job{
+		ID:            n.ID,
+		TransactionID: n.TransactionID,
+		NotifySince:   n.NotifySince,
+		Status:        JobQueued,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	r.evict()
+}
+
+// evict forgets the oldest jobs when there are more than the registry can keep.
+func (r *jobRegistry) evict() {
+	if len(r.jobs) <= r.max {
+		return
+	}
+	jobs := make([]*Job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	for _, j := range jobs[:len(jobs)-r.max] {
+		delete(r.jobs, j.ID)
+	}
+}
+
+func (r *jobRegistry) get(id string) (Job, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	j, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	job := *j
+	job.UUIDs = append([]string(nil), j.UUIDs...)
+	if j.Errors != nil {
+		job.Errors = make(map[string]string, len(j.Errors))
+		for k, v := range j.Errors {
+			job.Errors[k] = v
+		}
+	}
+	return job, true
+}
+
+func (r *jobRegistry) update(ids []string, fn func(j *Job)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		j, ok := r.jobs[id]
+		if !ok {
+			continue
+		}
+		fn(j)
+		j.UpdatedAt = now
+	}
+}
+
+// progress returns a ProgressFunc which updates all the jobs with the given ids.
+func (r *jobRegistry) progress(ids []string) ProgressFunc {
+	return func(status JobStatus, uuids []string) {
+		r.update(ids, func(j *Job) {
+			j.Status = status
+			if uuids != nil {
+				j.UUIDs = uuids
+			}
+		})
+	}
+}
+
+// finish marks the jobs with the given ids as done or failed depending on the given error.
+// A job is failed only once its notification is given up on.
+func (r *jobRegistry) finish(ids []string, err error) {
+	r.update(ids, func(j *Job) {
+		if err == nil {
+			// the errors of the earlier attempts do not matter once the notification is processed
+			j.Status = JobDone
+			j.Error = ""
+			j.Errors = nil
+			return
+		}
+		j.Status = JobFailed
+		j.setError(err)
+	})
+}
+
+// retrying marks the jobs with the given ids as retrying after an attempt failed with the given error.
+func (r *jobRegistry) retrying(ids []string, err error) {
+	r.update(ids, func(j *Job) {
+		j.Status = JobRetrying
+		j.setError(err)
+	})
+}
+
+// setError records the given error of the job, with the error of every concept which failed.
+func (j *Job) setError(err error) {
+	j.Error = err.Error()
+	j.Errors = nil
+	var conceptErrors ConceptErrors
+	if errors.As(err, &conceptErrors) {
+		j.Errors = make(map[string]string, len(conceptErrors))
+		for uuid, conceptErr := range conceptErrors {
+			j.Errors[uuid] = conceptErr.Error()
+		}
+	}
+}
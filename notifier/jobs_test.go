@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobRegistry_Lifecycle(t *testing.T) {
+	r := newJobRegistry(10)
+	r.add(QueuedNotification{ID: "job1", TransactionID: "tid_1"})
+	r.add(QueuedNotification{ID: "job2", TransactionID: "tid_2"})
+
+	job, ok := r.get("job1")
+	assert.True(t, ok)
+	assert.Equal(t, JobQueued, job.Status)
+
+	ids := []string{"job1", "job2"}
+	r.progress(ids)(JobFetching, nil)
+	job, _ = r.get("job2")
+	assert.Equal(t, JobFetching, job.Status)
+
+	r.progress(ids)(JobPublishing, []string{"uuid1"})
+	job, _ = r.get("job1")
+	assert.Equal(t, JobPublishing, job.Status)
+	assert.Equal(t, []string{"uuid1"}, job.UUIDs)
+
+	r.finish([]string{"job1"}, nil)
+	job, _ = r.get("job1")
+	assert.Equal(t, JobDone, job.Status)
+	assert.Empty(t, job.Error)
+
+	r.retrying([]string{"job2"}, fmt.Errorf("notify failed: %w", ConceptErrors{"uuid1": errors.New("kafka is down")}))
+	job, _ = r.get("job2")
+	assert.Equal(t, JobRetrying, job.Status)
+	assert.Equal(t, map[string]string{"uuid1": "kafka is down"}, job.Errors)
+
+	r.finish([]string{"job2"}, errors.New("smartlogic is down"))
+	job, _ = r.get("job2")
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, "smartlogic is down", job.Error)
+	assert.Empty(t, job.Errors, "the errors of the concepts of an earlier attempt should be cleared")
+
+	r.finish([]string{"job2"}, fmt.Errorf("notify failed: %w", ConceptErrors{"uuid1": errors.New("not found")}))
+	job, _ = r.get("job2")
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, map[string]string{"uuid1": "not found"}, job.Errors)
+}
+
+func TestJobRegistry_ForgetsOldestJobs(t *testing.T) {
+	r := newJobRegistry(2)
+	for i := 1; i <= 3; i++ {
+		r.add(QueuedNotification{ID: fmt.Sprintf("job%d", i)})
+		time.Sleep(time.Millisecond)
+	}
+
+	_, ok := r.get("job1")
+	assert.False(t, ok)
+	_, ok = r.get("job2")
+	assert.True(t, ok)
+	_, ok = r.get("job3")
+	assert.True(t, ok)
+}
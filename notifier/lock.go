@@ -0,0 +1,45 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const lockFileName = "lock"
+
+// ErrDataDirLocked is returned when the data directory is used by another process, e.g. a reindex is run
+// from the command line against the data directory of a running service.
+var ErrDataDirLocked = errors.New("the data directory is used by another process")
+
+// DataDirLock is the exclusive lock of a data directory. It is held until it is released or the process exits.
+type DataDirLock struct {
+	file *os.File
+}
+
+// LockDataDir takes the exclusive lock of the given directory, so that its stores are not opened by two processes.
+// It fails with ErrDataDirLocked if another process holds the lock.
+func LockDataDir(dir string) (*DataDirLock, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the lock of the data directory: %w", err)
+	}
+	if err = lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &DataDirLock{file: f}, nil
+}
+
+// Release releases the lock.
+func (l *DataDirLock) Release() error {
+	if err := unlockFile(l.file); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
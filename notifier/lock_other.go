@@ -0,0 +1,14 @@
+//go:build !unix
+
+package notifier
+
+import "os"
+
+// the data directory is not locked where flock is not available, the service is only deployed on Linux
+func lockFile(*os.File) error {
+	return nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package notifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDataDir(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := LockDataDir(dir)
+	require.NoError(t, err)
+
+	_, err = LockDataDir(dir)
+	assert.ErrorIs(t, err, ErrDataDirLocked)
+
+	require.NoError(t, lock.Release())
+	lock, err = LockDataDir(dir)
+	require.NoError(t, err, "the lock should be available once released")
+	assert.NoError(t, lock.Release())
+}
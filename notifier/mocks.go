@@ -1,16 +1,23 @@
 package notifier
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
 	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 )
 
 type mockSmartlogicClient struct {
 	concepts                  map[string]string
+	getConceptFunc            func(uuid string) ([]byte, error)
 	getChangedConceptListFunc func(changeDate time.Time) ([]string, error)
+	getConceptPageFunc        func(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error)
+	lastCommitted             time.Time
+	// changePages are the pages of changes streamed by StreamConceptChanges, instead of the single page of GetConceptChanges
+	changePages []smartlogic.ConceptChanges
 
 	mu                          sync.Mutex
 	changedConceptListCallCount int
@@ -20,7 +27,14 @@ func (sl *mockSmartlogicClient) AccessToken() string {
 	return "access-token"
 }
 
+func (sl *mockSmartlogicClient) TokenStatus() smartlogic.TokenStatus {
+	return smartlogic.TokenStatus{Token: "access-token"}
+}
+
 func (sl *mockSmartlogicClient) GetConcept(uuid string) ([]byte, error) {
+	if sl.getConceptFunc != nil {
+		return sl.getConceptFunc(uuid)
+	}
 	c, ok := sl.concepts[uuid]
 	if !ok {
 		return nil, errors.New("can't find concept")
@@ -28,6 +42,14 @@ func (sl *mockSmartlogicClient) GetConcept(uuid string) ([]byte, error) {
 	return []byte(c), nil
 }
 
+func (sl *mockSmartlogicClient) GetConceptContext(ctx context.Context, uuid string) ([]byte, error) {
+	return sl.GetConcept(uuid)
+}
+
+func (sl *mockSmartlogicClient) GetConceptWithProperties(uuid string, properties []string) ([]byte, error) {
+	return sl.GetConcept(uuid)
+}
+
 func (sl *mockSmartlogicClient) GetChangedConceptList(changeDate time.Time) ([]string, error) {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
@@ -39,6 +61,70 @@ func (sl *mockSmartlogicClient) GetChangedConceptList(changeDate time.Time) ([]s
 	return nil, errors.New("not implemented")
 }
 
+func (sl *mockSmartlogicClient) GetConceptChanges(changeDate time.Time) (smartlogic.ConceptChanges, error) {
+	uuids, err := sl.GetChangedConceptList(changeDate)
+	if err != nil {
+		return smartlogic.ConceptChanges{}, err
+	}
+	changes := smartlogic.ConceptChanges{UUIDs: uuids, LastCommitted: sl.lastCommitted}
+	if !sl.lastCommitted.IsZero() {
+		changes.Committed = map[string]time.Time{}
+		for _, uuid := range uuids {
+			changes.Committed[uuid] = sl.lastCommitted
+		}
+	}
+	for _, uuid := range uuids {
+		changes.Events = append(changes.Events, smartlogic.ChangeEvent{UUID: uuid, Type: smartlogic.ChangeModified, Committed: sl.lastCommitted})
+	}
+	return changes, nil
+}
+
+func (sl *mockSmartlogicClient) GetConceptChangesAfter(key smartlogic.ChangesKey, limit int) (smartlogic.ConceptChanges, error) {
+	if sl.changePages == nil {
+		return sl.GetConceptChanges(key.Since)
+	}
+	for _, page := range sl.changePages {
+		if page.LastCommitted.After(key.Since) {
+			return page, nil
+		}
+	}
+	return smartlogic.ConceptChanges{UUIDs: []string{}}, nil
+}
+
+func (sl *mockSmartlogicClient) StreamConceptChanges(changeDate time.Time, fn func(smartlogic.ConceptChanges) error) error {
+	if sl.changePages == nil {
+		changes, err := sl.GetConceptChanges(changeDate)
+		if err != nil {
+			return err
+		}
+		return fn(changes)
+	}
+	sl.mu.Lock()
+	sl.changedConceptListCallCount++
+	sl.mu.Unlock()
+	for _, page := range sl.changePages {
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sl *mockSmartlogicClient) StreamConceptChangesContext(ctx context.Context, changeDate time.Time, fn func(smartlogic.ConceptChanges) error) error {
+	return sl.StreamConceptChanges(changeDate, fn)
+}
+
+func (sl *mockSmartlogicClient) GetConceptPage(after string, limit int) (smartlogic.ConceptPage, error) {
+	return sl.GetConceptPageContext(context.Background(), after, limit)
+}
+
+func (sl *mockSmartlogicClient) GetConceptPageContext(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error) {
+	if sl.getConceptPageFunc != nil {
+		return sl.getConceptPageFunc(ctx, after, limit)
+	}
+	return smartlogic.ConceptPage{}, errors.New("not implemented")
+}
+
 func (sl *mockSmartlogicClient) getChangedConceptListCallCount() int {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
@@ -48,23 +134,39 @@ func (sl *mockSmartlogicClient) getChangedConceptListCallCount() int {
 type mockKafkaClient struct {
 	mu        sync.Mutex
 	sentCount int
+	keys      []string
+	messages  []kafka.FTMessage
 }
 
 func (kf *mockKafkaClient) ConnectivityCheck() error {
 	return nil
 }
 
-func (kf *mockKafkaClient) SendMessage(message kafka.FTMessage) error {
+func (kf *mockKafkaClient) SendMessage(key string, message kafka.FTMessage) error {
 	kf.mu.Lock()
 	defer kf.mu.Unlock()
 
 	kf.sentCount++
+	kf.keys = append(kf.keys, key)
+	kf.messages = append(kf.messages, message)
 	return nil
 }
 
 func (kf *mockKafkaClient) Shutdown() {
 }
 
+func (kf *mockKafkaClient) getMessages() []kafka.FTMessage {
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	return append([]kafka.FTMessage(nil), kf.messages...)
+}
+
+func (kf *mockKafkaClient) getKeys() []string {
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	return append([]string(nil), kf.keys...)
+}
+
 func (kf *mockKafkaClient) getSentCount() int {
 	kf.mu.Lock()
 	defer kf.mu.Unlock()
@@ -73,10 +175,17 @@ func (kf *mockKafkaClient) getSentCount() int {
 
 type mockService struct {
 	getConcept             func(string) ([]byte, error)
+	getConceptProperties   func(string, []string) ([]byte, error)
 	getChangedConceptList  func(time.Time) ([]string, error)
-	notify                 func(time.Time, string) error
-	forceNotify            func([]string, string) error
+	getConceptChangesAfter func(smartlogic.ChangesKey, int) (smartlogic.ConceptChanges, error)
+	notify                 func(time.Time, string, ProgressFunc) error
+	forceNotify            func([]string, string, bool) ([]ConceptResult, error)
+	forceNotifyContext     func(context.Context, []string, string, bool) ([]ConceptResult, error)
+	catchUp                func(string) error
+	deadLetters            func() ([]DeadLetter, error)
+	replayDeadLetters      func([]string, string) ([]ConceptResult, error)
 	checkKafkaConnectivity func() error
+	tokenStatus            func() smartlogic.TokenStatus
 }
 
 func (s *mockService) GetConcept(uuid string) ([]byte, error) {
@@ -86,6 +195,13 @@ func (s *mockService) GetConcept(uuid string) ([]byte, error) {
 	return nil, errors.New("not implemented")
 }
 
+func (s *mockService) GetConceptWithProperties(uuid string, properties []string) ([]byte, error) {
+	if s.getConceptProperties != nil {
+		return s.getConceptProperties(uuid, properties)
+	}
+	return nil, errors.New("not implemented")
+}
+
 func (s *mockService) GetChangedConceptList(lastChange time.Time) ([]string, error) {
 	if s.getChangedConceptList != nil {
 		return s.getChangedConceptList(lastChange)
@@ -93,20 +209,66 @@ func (s *mockService) GetChangedConceptList(lastChange time.Time) ([]string, err
 	return nil, errors.New("not implemented")
 }
 
-func (s *mockService) Notify(lastChange time.Time, transactionID string) error {
+func (s *mockService) GetConceptChangesAfter(key smartlogic.ChangesKey, limit int) (smartlogic.ConceptChanges, error) {
+	if s.getConceptChangesAfter != nil {
+		return s.getConceptChangesAfter(key, limit)
+	}
+	return smartlogic.ConceptChanges{}, errors.New("not implemented")
+}
+
+func (s *mockService) Notify(lastChange time.Time, transactionID string, progress ProgressFunc) error {
 	if s.notify != nil {
-		return s.notify(lastChange, transactionID)
+		return s.notify(lastChange, transactionID, progress)
 	}
 	return errors.New("not implemented")
 }
 
-func (s *mockService) ForceNotify(uuids []string, transactionID string) error {
+func (s *mockService) NotifyContext(ctx context.Context, lastChange time.Time, transactionID string, progress ProgressFunc) error {
+	return s.Notify(lastChange, transactionID, progress)
+}
+
+func (s *mockService) ForceNotifyContext(ctx context.Context, uuids []string, transactionID string, force bool) ([]ConceptResult, error) {
+	if s.forceNotifyContext != nil {
+		return s.forceNotifyContext(ctx, uuids, transactionID, force)
+	}
+	return s.ForceNotify(uuids, transactionID, force)
+}
+
+func (s *mockService) ForceNotify(uuids []string, transactionID string, force bool) ([]ConceptResult, error) {
 	if s.forceNotify != nil {
-		return s.forceNotify(uuids, transactionID)
+		return s.forceNotify(uuids, transactionID, force)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (s *mockService) CatchUp(transactionID string) error {
+	if s.catchUp != nil {
+		return s.catchUp(transactionID)
 	}
 	return errors.New("not implemented")
 }
 
+func (s *mockService) DeadLetters() ([]DeadLetter, error) {
+	if s.deadLetters != nil {
+		return s.deadLetters()
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (s *mockService) ReplayDeadLetters(uuids []string, transactionID string) ([]ConceptResult, error) {
+	if s.replayDeadLetters != nil {
+		return s.replayDeadLetters(uuids, transactionID)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (s *mockService) SmartlogicTokenStatus() smartlogic.TokenStatus {
+	if s.tokenStatus != nil {
+		return s.tokenStatus()
+	}
+	return smartlogic.TokenStatus{}
+}
+
 func (s *mockService) CheckKafkaConnectivity() error {
 	if s.checkKafkaConnectivity != nil {
 		return s.checkKafkaConnectivity()
@@ -0,0 +1,63 @@
+package notifier
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// shardByUUID splits the indexes of the given uuids into n shards. The same uuid always ends up in the same shard
+// and the shards keep the original order, so that the messages for a concept are sent in the order they were requested.
+func shardByUUID(UUIDs []string, n int) [][]int {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([][]int, n)
+	for i, uuid := range UUIDs {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(uuid))
+		shard := int(h.Sum32() % uint32(n))
+		shards[shard] = append(shards[shard], i)
+	}
+	return shards
+}
+
+// uuidLocks serialises the fetching and publishing of the same concept across concurrent requests,
+// so that a concept fetched earlier is never sent to Kafka after one fetched later.
+type uuidLocks struct {
+	mu    sync.Mutex
+	locks map[string]*uuidLock
+}
+
+type uuidLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newUUIDLocks() *uuidLocks {
+	return &uuidLocks{locks: map[string]*uuidLock{}}
+}
+
+func (l *uuidLocks) lock(uuid string) {
+	l.mu.Lock()
+	lock, ok := l.locks[uuid]
+	if !ok {
+		lock = &uuidLock{}
+		l.locks[uuid] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+}
+
+func (l *uuidLocks) unlock(uuid string) {
+	l.mu.Lock()
+	lock := l.locks[uuid]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, uuid)
+	}
+	l.mu.Unlock()
+
+	lock.Unlock()
+}
@@ -0,0 +1,79 @@
+package notifier
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardByUUID(t *testing.T) {
+	uuids := []string{"uuid1", "uuid2", "uuid3", "uuid1", "uuid4", "uuid2", "uuid1"}
+
+	shards := shardByUUID(uuids, 3)
+	assert.Len(t, shards, 3)
+
+	shardOf := map[string]int{}
+	var total int
+	for s, shard := range shards {
+		for j, i := range shard {
+			if j > 0 {
+				assert.Less(t, shard[j-1], i, "shard should keep the original order")
+			}
+			if prev, ok := shardOf[uuids[i]]; ok {
+				assert.Equal(t, prev, s, "the same uuid should always be in the same shard")
+			}
+			shardOf[uuids[i]] = s
+			total++
+		}
+	}
+	assert.Equal(t, len(uuids), total)
+}
+
+func TestUUIDLocks(t *testing.T) {
+	locks := newUUIDLocks()
+
+	locks.lock("uuid1")
+	locked := make(chan struct{})
+	go func() {
+		locks.lock("uuid1")
+		close(locked)
+		locks.unlock("uuid1")
+	}()
+
+	// a different uuid is not blocked
+	locks.lock("uuid2")
+	locks.unlock("uuid2")
+
+	select {
+	case <-locked:
+		t.Fatal("uuid1 should still be locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	locks.unlock("uuid1")
+	<-locked
+
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	assert.Empty(t, locks.locks)
+}
+
+func TestUUIDLocks_Concurrent(t *testing.T) {
+	locks := newUUIDLocks()
+	counter := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locks.lock("uuid")
+			counter++
+			locks.unlock("uuid")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, counter)
+}
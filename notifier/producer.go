@@ -0,0 +1,144 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/IBM/sarama"
+	"github.com/aws/aws-sdk-go-v2/service/kafka/types"
+)
+
+// kafkaConnectivityTimeout is how long the connectivity check waits for the brokers to respond.
+const kafkaConnectivityTimeout = 5 * time.Second
+
+var (
+	errProducerClosed           = errors.New("the kafka producer is closed")
+	errKafkaConnectivityTimeout = errors.New("timed out checking the connectivity to kafka")
+)
+
+// KafkaProducer sends the concepts to Kafka keyed by their uuid, so that all the changes of a concept
+// end up in the same partition and are consumed in order.
+type KafkaProducer struct {
+	topic    string
+	client   sarama.Client
+	producer sarama.SyncProducer
+	// clusterState is set when a cluster ARN is configured, so that the cluster being unreachable
+	// during its maintenance is not reported as a failure.
+	clusterState clusterStateFunc
+
+	// mu makes Close wait for the messages being sent
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewKafkaProducer connects to the brokers in the given config.
+func NewKafkaProducer(config kafka.ProducerConfig) (*KafkaProducer, error) {
+	if config.Options == nil {
+		config.Options = kafka.DefaultProducerOptions()
+	}
+
+	client, err := sarama.NewClient(strings.Split(config.BrokersConnectionString, ","), config.Options)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("creating producer: %w", err)
+	}
+
+	p := &KafkaProducer{
+		topic:    config.Topic,
+		client:   client,
+		producer: producer,
+	}
+	if config.ClusterArn != nil && *config.ClusterArn != "" {
+		p.clusterState, err = newMSKClusterState(*config.ClusterArn)
+		if err != nil {
+			_ = p.Close()
+			return nil, fmt.Errorf("creating cluster describer: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// SendMessage publishes the message to Kafka with the given key.
+func (p *KafkaProducer) SendMessage(key string, message kafka.FTMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return errProducerClosed
+	}
+
+	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   p.topic,
+		Key:     sarama.StringEncoder(key),
+		Value:   sarama.StringEncoder(message.Build()),
+		Headers: traceRecordHeaders(message),
+	})
+	return err
+}
+
+// traceRecordHeaders returns the trace context of the message as Kafka record headers, so that the consumers which do not
+// parse the headers of the FT message can continue the trace too.
+func traceRecordHeaders(message kafka.FTMessage) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+	for _, field := range traceContext.Fields() {
+		if value := message.Headers[field]; value != "" {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(field), Value: []byte(value)})
+		}
+	}
+	return headers
+}
+
+// ConnectivityCheck checks whether the brokers of the topic can be reached with the connection of the producer.
+// The brokers not being reachable is not a failure while the cluster is under maintenance.
+func (p *KafkaProducer) ConnectivityCheck() error {
+	err := p.refreshMetadata()
+	if err == nil || p.clusterState == nil {
+		return err
+	}
+
+	state, stateErr := p.clusterState()
+	if stateErr != nil {
+		return fmt.Errorf("cluster status is unknown: %w", stateErr)
+	}
+	if state == types.ClusterStateMaintenance {
+		return nil
+	}
+	return err
+}
+
+func (p *KafkaProducer) refreshMetadata() error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.client.RefreshMetadata(p.topic)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(kafkaConnectivityTimeout):
+		return errKafkaConnectivityTimeout
+	}
+}
+
+// Close waits for the messages being sent and closes the connections to Kafka, the messages sent afterwards fail.
+func (p *KafkaProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	err := p.producer.Close()
+	if clientErr := p.client.Close(); err == nil {
+		err = clientErr
+	}
+	return err
+}
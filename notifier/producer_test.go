@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/aws/aws-sdk-go-v2/service/kafka/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockKafkaBroker(t *testing.T, topic string) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(topic, 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+	return broker
+}
+
+func TestKafkaProducer(t *testing.T) {
+	broker := newMockKafkaBroker(t, "SmartlogicConcept")
+	defer broker.Close()
+
+	producer, err := NewKafkaProducer(kafka.ProducerConfig{
+		Topic:                   "SmartlogicConcept",
+		BrokersConnectionString: broker.Addr(),
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, producer.ConnectivityCheck())
+	assert.NoError(t, producer.SendMessage("uuid1", kafka.NewFTMessage(map[string]string{}, "{}")))
+
+	require.NoError(t, producer.Close())
+	assert.ErrorIs(t, producer.SendMessage("uuid1", kafka.NewFTMessage(map[string]string{}, "{}")), errProducerClosed)
+	assert.NoError(t, producer.Close(), "closing the producer again should be a no-op")
+}
+
+func TestKafkaProducer_ConnectivityCheckDuringMaintenance(t *testing.T) {
+	broker := newMockKafkaBroker(t, "SmartlogicConcept")
+	config := kafka.DefaultProducerOptions()
+	config.Metadata.Retry.Max = 0
+	producer, err := NewKafkaProducer(kafka.ProducerConfig{
+		Topic:                   "SmartlogicConcept",
+		BrokersConnectionString: broker.Addr(),
+		Options:                 config,
+	})
+	require.NoError(t, err)
+	defer producer.Close()
+	broker.Close()
+
+	tests := []struct {
+		name          string
+		state         types.ClusterState
+		stateErr      error
+		expectedError string
+	}{
+		{name: "under maintenance", state: types.ClusterStateMaintenance},
+		{name: "active", state: types.ClusterStateActive, expectedError: "kafka: client has run out of available brokers"},
+		{name: "unknown", stateErr: errors.New("access denied"), expectedError: "cluster status is unknown: access denied"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			producer.clusterState = func() (types.ClusterState, error) { return test.state, test.stateErr }
+			err := producer.ConnectivityCheck()
+			if test.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, test.expectedError)
+		})
+	}
+}
+
+func TestKafkaProducer_SendsTheTraceContextInTheRecordHeaders(t *testing.T) {
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "SmartlogicConcept", msg.Topic)
+		assert.Equal(t, []sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte(incomingTraceParent)}}, msg.Headers)
+		return nil
+	})
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Empty(t, msg.Headers, "there is no trace context to send")
+		return nil
+	})
+	producer := &KafkaProducer{topic: "SmartlogicConcept", producer: mockProducer}
+
+	headers := map[string]string{"X-Request-Id": "tid_test", "traceparent": incomingTraceParent}
+	require.NoError(t, producer.SendMessage("uuid1", kafka.NewFTMessage(headers, "{}")))
+	require.NoError(t, producer.SendMessage("uuid1", kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_test"}, "{}")))
+	require.NoError(t, mockProducer.Close())
+}
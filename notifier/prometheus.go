@@ -0,0 +1,222 @@
+package notifier
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// summaryQuantiles are the quantiles of the histograms and timers exposed to Prometheus.
+var summaryQuantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+// metricLabels are the parts of the metric names which are exposed to Prometheus as labels, once the model is taken out of the name.
+// The value of the label is the part of the name between the prefix and the suffix, e.g. smartlogic.getConcept.errors.timeout
+// is exposed as smartlogic_getConcept_errors_total{kind="timeout"}.
+var metricLabels = []struct {
+	prefix string
+	suffix string
+	label  string
+}{
+	{prefix: "smartlogic.getConcept.errors.", label: "kind"},
+	{prefix: "smartlogic.droppedURIs.", label: "namespace"},
+	{prefix: "concepts.validation.", suffix: ".failed", label: "rule"},
+}
+
+// PrometheusHandler exposes the metrics of the given registry in the Prometheus text format. The model the metrics
+// are named after, which is one of the given models, is exposed as the model label, and so are the error kinds,
+// the validation rules and the URI namespaces, e.g. notifications.FTModel.pending is notifications_pending{model="FTModel"}.
+// The rest of the characters Prometheus does not accept in the names are replaced with _. The counters and meters are exposed
+// as counters with the _total suffix, the histograms and the timers as summaries, with the timers in seconds.
+func PrometheusHandler(r metrics.Registry, models ...string) http.Handler {
+	known := make(map[string]bool, len(models))
+	for _, model := range models {
+		known[model] = true
+	}
+	return http.HandlerFunc(func(resp http.ResponseWriter, _ *http.Request) {
+		resp.Header().Set("Content-Type", prometheusContentType)
+		writePrometheusMetrics(resp, r, known)
+	})
+}
+
+type prometheusLabel struct {
+	name  string
+	value string
+}
+
+type prometheusSample struct {
+	labels []prometheusLabel
+	metric interface{}
+}
+
+// prometheusFamily holds the metrics exposed under the same name, which differ by their labels.
+type prometheusFamily struct {
+	name       string
+	metricType string
+	samples    []prometheusSample
+	labelSets  map[string]bool
+}
+
+func writePrometheusMetrics(w io.Writer, r metrics.Registry, models map[string]bool) {
+	all := map[string]interface{}{}
+	r.Each(func(name string, metric interface{}) {
+		all[name] = metric
+	})
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := map[string]*prometheusFamily{}
+	for _, name := range names {
+		metric := all[name]
+		metricType, suffix := prometheusType(metric)
+		if metricType == "" {
+			continue
+		}
+		base, labels := prometheusSeries(name, models)
+		familyName := base + suffix
+
+		family, ok := families[familyName]
+		if ok && family.metricType != metricType {
+			// a metric of another type has the same name, the metrics are not dropped but exposed under the name with the type
+			familyName += "_" + metricType
+			family, ok = families[familyName]
+		}
+		if !ok {
+			family = &prometheusFamily{name: familyName, metricType: metricType, labelSets: map[string]bool{}}
+			families[familyName] = family
+		}
+		if family.labelSets[formatPrometheusLabels(labels)] {
+			// different metrics have the same name and labels once sanitised, they are told apart by their original name
+			labels = append(labels, prometheusLabel{name: "metric", value: name})
+		}
+		family.labelSets[formatPrometheusLabels(labels)] = true
+		family.samples = append(family.samples, prometheusSample{labels: labels, metric: metric})
+	}
+
+	familyNames := make([]string, 0, len(families))
+	for name := range families {
+		familyNames = append(familyNames, name)
+	}
+	sort.Strings(familyNames)
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	for _, name := range familyNames {
+		writePrometheusFamily(bw, families[name])
+	}
+}
+
+// prometheusType returns the Prometheus type of the given metric and the suffix of its name, or nothing if it is not exposed.
+func prometheusType(metric interface{}) (string, string) {
+	switch metric.(type) {
+	case metrics.Counter, metrics.Meter:
+		return "counter", "_total"
+	case metrics.Gauge, metrics.GaugeFloat64:
+		return "gauge", ""
+	case metrics.Histogram:
+		return "summary", ""
+	case metrics.Timer:
+		return "summary", "_seconds"
+	}
+	return "", ""
+}
+
+// prometheusSeries returns the name the metric with the given name is exposed under, and its labels.
+func prometheusSeries(name string, models map[string]bool) (string, []prometheusLabel) {
+	var labels []prometheusLabel
+	if parts := strings.SplitN(name, ".", 3); len(parts) == 3 && models[parts[1]] {
+		labels = append(labels, prometheusLabel{name: "model", value: parts[1]})
+		name = parts[0] + "." + parts[2]
+	}
+	for _, l := range metricLabels {
+		if len(name) > len(l.prefix)+len(l.suffix) && strings.HasPrefix(name, l.prefix) && strings.HasSuffix(name, l.suffix) {
+			labels = append(labels, prometheusLabel{name: l.label, value: name[len(l.prefix) : len(name)-len(l.suffix)]})
+			name = strings.TrimSuffix(l.prefix, ".") + l.suffix
+			break
+		}
+	}
+	return prometheusName(name), labels
+}
+
+func writePrometheusFamily(w io.Writer, f *prometheusFamily) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.metricType)
+	for _, s := range f.samples {
+		switch m := s.metric.(type) {
+		case metrics.Counter:
+			writePrometheusSample(w, f.name, s.labels, float64(m.Count()))
+		case metrics.Meter:
+			writePrometheusSample(w, f.name, s.labels, float64(m.Snapshot().Count()))
+		case metrics.Gauge:
+			writePrometheusSample(w, f.name, s.labels, float64(m.Value()))
+		case metrics.GaugeFloat64:
+			writePrometheusSample(w, f.name, s.labels, m.Value())
+		case metrics.Histogram:
+			h := m.Snapshot()
+			writePrometheusSummary(w, f.name, s.labels, h.Percentiles(summaryQuantiles), float64(h.Sum()), h.Count(), 1)
+		case metrics.Timer:
+			t := m.Snapshot()
+			writePrometheusSummary(w, f.name, s.labels, t.Percentiles(summaryQuantiles), float64(t.Sum()), t.Count(), 1e9)
+		}
+	}
+}
+
+func writePrometheusSample(w io.Writer, name string, labels []prometheusLabel, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, formatPrometheusLabels(labels), formatPrometheusValue(value))
+}
+
+// writePrometheusSummary writes a summary with the given quantiles, the values are divided by the given unit.
+func writePrometheusSummary(w io.Writer, name string, labels []prometheusLabel, quantiles []float64, sum float64, count int64, unit float64) {
+	for i, q := range summaryQuantiles {
+		quantileLabels := append(append([]prometheusLabel(nil), labels...), prometheusLabel{name: "quantile", value: formatPrometheusValue(q)})
+		writePrometheusSample(w, name, quantileLabels, quantiles[i]/unit)
+	}
+	writePrometheusSample(w, name+"_sum", labels, sum/unit)
+	writePrometheusSample(w, name+"_count", labels, float64(count))
+}
+
+func formatPrometheusLabels(labels []prometheusLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, l.name+`="`+prometheusLabelEscaper.Replace(l.value)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// prometheusLabelEscaper escapes the label values as the text format expects, the other characters are written as they are.
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatPrometheusValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// prometheusName replaces the characters which are not valid in the name of a Prometheus metric with _.
+func prometheusName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package notifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("notifications.FTModel.received", registry).Inc(3)
+	metrics.GetOrRegisterCounter("notifications.ManagedLocationModel.received", registry).Inc(5)
+	metrics.GetOrRegisterGauge("notifications.FTModel.pending", registry).Update(2)
+	metrics.GetOrRegisterGaugeFloat64("notifications.FTModel.lagSeconds", registry).Update(1.5)
+	metrics.GetOrRegisterMeter("GET /concept/{uuid}", registry).Mark(4)
+	metrics.GetOrRegisterHistogram("notify.FTModel.changes", registry, metrics.NewUniformSample(10)).Update(7)
+	metrics.GetOrRegisterTimer("kafka.FTModel.send", registry).Update(2 * time.Second)
+	metrics.GetOrRegisterCounter("smartlogic.FTModel.getConcept.errors.timeout", registry).Inc(6)
+	metrics.GetOrRegisterCounter("smartlogic.FTModel.droppedURIs.http://www.ft.com/ontology/other/", registry).Inc(1)
+	metrics.GetOrRegisterCounter("concepts.FTModel.validation.prefLabel.failed", registry).Inc(8)
+
+	rr := httptest.NewRecorder()
+	PrometheusHandler(registry, "FTModel", "ManagedLocationModel").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	assert.Equal(t, strings.Join([]string{
+		"# TYPE GET__concept__uuid__total counter",
+		"GET__concept__uuid__total 4",
+		"# TYPE concepts_validation_failed_total counter",
+		`concepts_validation_failed_total{model="FTModel",rule="prefLabel"} 8`,
+		"# TYPE kafka_send_seconds summary",
+		`kafka_send_seconds{model="FTModel",quantile="0.5"} 2`,
+		`kafka_send_seconds{model="FTModel",quantile="0.75"} 2`,
+		`kafka_send_seconds{model="FTModel",quantile="0.95"} 2`,
+		`kafka_send_seconds{model="FTModel",quantile="0.99"} 2`,
+		`kafka_send_seconds_sum{model="FTModel"} 2`,
+		`kafka_send_seconds_count{model="FTModel"} 1`,
+		"# TYPE notifications_lagSeconds gauge",
+		`notifications_lagSeconds{model="FTModel"} 1.5`,
+		"# TYPE notifications_pending gauge",
+		`notifications_pending{model="FTModel"} 2`,
+		"# TYPE notifications_received_total counter",
+		`notifications_received_total{model="FTModel"} 3`,
+		`notifications_received_total{model="ManagedLocationModel"} 5`,
+		"# TYPE notify_changes summary",
+		`notify_changes{model="FTModel",quantile="0.5"} 7`,
+		`notify_changes{model="FTModel",quantile="0.75"} 7`,
+		`notify_changes{model="FTModel",quantile="0.95"} 7`,
+		`notify_changes{model="FTModel",quantile="0.99"} 7`,
+		`notify_changes_sum{model="FTModel"} 7`,
+		`notify_changes_count{model="FTModel"} 1`,
+		"# TYPE smartlogic_droppedURIs_total counter",
+		`smartlogic_droppedURIs_total{model="FTModel",namespace="http://www.ft.com/ontology/other/"} 1`,
+		"# TYPE smartlogic_getConcept_errors_total counter",
+		`smartlogic_getConcept_errors_total{model="FTModel",kind="timeout"} 6`,
+	}, "\n")+"\n", rr.Body.String())
+}
+
+func TestPrometheusHandler_KeepsCollidingMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("notifications.FTModel.received", registry).Inc(3)
+	// the same name and labels as the received counter once sanitised
+	metrics.GetOrRegisterCounter("notifications.FTModel.received-", registry).Inc(1)
+	metrics.GetOrRegisterCounter("notifications.FTModel.received.", registry).Inc(2)
+	// the same name as the received counter, but another type
+	metrics.GetOrRegisterGauge("notifications.FTModel.received_total", registry).Update(4)
+
+	rr := httptest.NewRecorder()
+	PrometheusHandler(registry, "FTModel").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, strings.Join([]string{
+		"# TYPE notifications_received__total counter",
+		`notifications_received__total{model="FTModel"} 1`,
+		`notifications_received__total{model="FTModel",metric="notifications.FTModel.received."} 2`,
+		"# TYPE notifications_received_total counter",
+		`notifications_received_total{model="FTModel"} 3`,
+		"# TYPE notifications_received_total_gauge gauge",
+		`notifications_received_total_gauge{model="FTModel"} 4`,
+	}, "\n")+"\n", rr.Body.String())
+}
+
+func TestPrometheusSeries(t *testing.T) {
+	models := map[string]bool{"FTModel": true}
+
+	name, labels := prometheusSeries("smartlogic.FTModel.getConcept.errors.not_found", models)
+	assert.Equal(t, "smartlogic_getConcept_errors", name)
+	assert.Equal(t, []prometheusLabel{{name: "model", value: "FTModel"}, {name: "kind", value: "not_found"}}, labels)
+
+	name, labels = prometheusSeries("smartlogic.OtherModel.retries", models)
+	assert.Equal(t, "smartlogic_OtherModel_retries", name)
+	assert.Empty(t, labels)
+}
+
+func TestPrometheusName(t *testing.T) {
+	assert.Equal(t, "smartlogic_FTModel_getConcept_errors_not_found", prometheusName("smartlogic.FTModel.getConcept.errors.not_found"))
+	assert.Equal(t, "_2xx_responses", prometheusName("2xx-responses"))
+}
+
+func TestFormatPrometheusLabels(t *testing.T) {
+	labels := []prometheusLabel{
+		{name: "namespace", value: "http://www.ft.com/ontology/café/"},
+		{name: "rule", value: "a \"quoted\" \\ rule\nwith\ta tab"},
+	}
+	// only the backslashes, the double quotes and the line feeds are escaped, the other characters are kept as UTF-8
+	assert.Equal(t, `{namespace="http://www.ft.com/ontology/café/",rule="a \"quoted\" \\ rule\nwith`+"\t"+`a tab"}`, formatPrometheusLabels(labels))
+	assert.Empty(t, formatPrometheusLabels(nil))
+}
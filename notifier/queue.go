@@ -0,0 +1,273 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const queueFileName = "notify-queue.log"
+
+// NotificationQueue persists the accepted notifications until they have been processed,
+// so that they can be replayed after a restart of the service.
+type NotificationQueue interface {
+	Add(n QueuedNotification) error
+	Ack(ids ...string) error
+	Pending() ([]QueuedNotification, error)
+}
+
+// QueuedNotification is a notification received from Smartlogic which is waiting to be processed.
+type QueuedNotification struct {
+	ID            string    `json:"id"`
+	NotifySince   time.Time `json:"notifySince"`
+	TransactionID string    `json:"transactionId"`
+	ReceivedAt    time.Time `json:"receivedAt"`
+	// TraceParent is the trace context of the request of the notification, so that its processing is part of the same trace.
+	TraceParent string `json:"traceParent,omitempty"`
+}
+
+type queueRecord struct {
+	Op           string              `json:"op"`
+	ID           string              `json:"id,omitempty"`
+	Notification *QueuedNotification `json:"notification,omitempty"`
+}
+
+const (
+	queueOpAdd = "add"
+	queueOpAck = "ack"
+)
+
+// FileQueue is a NotificationQueue backed by an append-only log file.
+// Every change is synced to disk before the call returns.
+type FileQueue struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	pending map[string]QueuedNotification
+}
+
+// NewFileQueue opens the queue log in the given directory, creating it if needed.
+// The log is compacted on opening, so that it only contains the notifications that are still pending.
+func NewFileQueue(dir string) (*FileQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &FileQueue{
+		path:    filepath.Join(dir, queueFileName),
+		pending: map[string]QueuedNotification{},
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *FileQueue) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open queue log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec queueRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// a partially written record is expected if the service was stopped in the middle of a write
+			continue
+		}
+		switch rec.Op {
+		case queueOpAdd:
+			if rec.Notification != nil {
+				q.pending[rec.Notification.ID] = *rec.Notification
+			}
+		case queueOpAck:
+			delete(q.pending, rec.ID)
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the log so that it contains only the pending notifications and reopens it for appending.
+func (q *FileQueue) compact() error {
+	if q.file != nil {
+		_ = q.file.Close()
+		q.file = nil
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	for _, n := range q.sortedPending() {
+		n := n
+		if err := writeQueueRecord(w, queueRecord{Op: queueOpAdd, Notification: &n}); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write compacted queue log: %w", err)
+	}
+	if err := writeFileAtomic(q.path, buf.Bytes()); err != nil {
+		return err
+	}
+
+	var err error
+	q.file, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open queue log: %w", err)
+	}
+	return nil
+}
+
+// Add persists the notification. It returns only after the notification is synced to disk.
+func (q *FileQueue) Add(n QueuedNotification) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.append(queueRecord{Op: queueOpAdd, Notification: &n}); err != nil {
+		return err
+	}
+	q.pending[n.ID] = n
+	return nil
+}
+
+// Ack marks the notifications with the given ids as processed.
+func (q *FileQueue) Ack(ids ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := q.pending[id]; !ok {
+			continue
+		}
+		if err := q.append(queueRecord{Op: queueOpAck, ID: id}); err != nil {
+			return err
+		}
+		delete(q.pending, id)
+	}
+
+	if len(q.pending) == 0 {
+		// nothing left to replay, so there is no reason to keep the history around
+		return q.compact()
+	}
+	return nil
+}
+
+// Pending returns the notifications that were added but not acknowledged, oldest first.
+func (q *FileQueue) Pending() ([]QueuedNotification, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.sortedPending(), nil
+}
+
+// Close closes the underlying log file.
+func (q *FileQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+func (q *FileQueue) append(rec queueRecord) error {
+	if q.file == nil {
+		return fmt.Errorf("queue log %s is closed", q.path)
+	}
+	w := bufio.NewWriter(q.file)
+	if err := writeQueueRecord(w, rec); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write to queue log: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync queue log: %w", err)
+	}
+	return nil
+}
+
+func (q *FileQueue) sortedPending() []QueuedNotification {
+	return sortNotifications(q.pending)
+}
+
+func writeQueueRecord(w *bufio.Writer, rec queueRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode queue record: %w", err)
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("failed to write queue record: %w", err)
+	}
+	return nil
+}
+
+// memoryQueue is a NotificationQueue which does not survive restarts. It is used when no durable queue is configured.
+type memoryQueue struct {
+	mu      sync.Mutex
+	pending map[string]QueuedNotification
+}
+
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{pending: map[string]QueuedNotification{}}
+}
+
+func (q *memoryQueue) Add(n QueuedNotification) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[n.ID] = n
+	return nil
+}
+
+func (q *memoryQueue) Ack(ids ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range ids {
+		delete(q.pending, id)
+	}
+	return nil
+}
+
+func (q *memoryQueue) Pending() ([]QueuedNotification, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return sortNotifications(q.pending), nil
+}
+
+func sortNotifications(m map[string]QueuedNotification) []QueuedNotification {
+	out := make([]QueuedNotification, 0, len(m))
+	for _, n := range m {
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ReceivedAt.Before(out[j].ReceivedAt)
+	})
+	return out
+}
+
+func newNotificationID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
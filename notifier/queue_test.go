@@ -0,0 +1,80 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileQueue_PendingSurvivesReopening(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	q, err := NewFileQueue(dir)
+	require.NoError(t, err)
+
+	n1 := QueuedNotification{ID: "id1", NotifySince: now.Add(-time.Minute), TransactionID: "tid_1", ReceivedAt: now}
+	n2 := QueuedNotification{ID: "id2", NotifySince: now, TransactionID: "tid_2", ReceivedAt: now.Add(time.Second)}
+	n3 := QueuedNotification{ID: "id3", NotifySince: now, TransactionID: "tid_3", ReceivedAt: now.Add(2 * time.Second)}
+	require.NoError(t, q.Add(n1))
+	require.NoError(t, q.Add(n2))
+	require.NoError(t, q.Add(n3))
+	require.NoError(t, q.Ack("id2"))
+	require.NoError(t, q.Close())
+
+	q, err = NewFileQueue(dir)
+	require.NoError(t, err)
+	defer q.Close()
+
+	pending, err := q.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, []QueuedNotification{n1, n3}, pending)
+}
+
+func TestFileQueue_CompactsWhenEverythingIsAcknowledged(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewFileQueue(dir)
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Add(QueuedNotification{ID: "id1", ReceivedAt: time.Now()}))
+	require.NoError(t, q.Add(QueuedNotification{ID: "id2", ReceivedAt: time.Now()}))
+	require.NoError(t, q.Ack("id1", "id2", "unknown"))
+
+	info, err := os.Stat(filepath.Join(dir, queueFileName))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	pending, err := q.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestFileQueue_IgnoresPartiallyWrittenRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewFileQueue(dir)
+	require.NoError(t, err)
+	require.NoError(t, q.Add(QueuedNotification{ID: "id1", ReceivedAt: time.Now()}))
+	require.NoError(t, q.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, queueFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"add","notification":{"id":"id2"`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = NewFileQueue(dir)
+	require.NoError(t, err)
+	defer q.Close()
+
+	pending, err := q.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "id1", pending[0].ID)
+}
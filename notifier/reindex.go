@@ -0,0 +1,349 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"golang.org/x/time/rate"
+)
+
+const (
+	reindexFileName        = "reindex.json"
+	defaultReindexPageSize = 100
+)
+
+// ReindexStatus is the state of a reindex of the whole model.
+type ReindexStatus string
+
+const (
+	ReindexRunning     ReindexStatus = "running"
+	ReindexInterrupted ReindexStatus = "interrupted"
+	ReindexFailed      ReindexStatus = "failed"
+	ReindexDone        ReindexStatus = "done"
+)
+
+// ErrReindexRunning is returned when a reindex is requested while another one is in progress.
+var ErrReindexRunning = errors.New("a reindex is already in progress")
+
+// ReindexProgress is the progress of a reindex. Offset is the number of model entries read from Smartlogic so far.
+// After is the guid of the last entry read, it is where an interrupted reindex is resumed from.
+type ReindexProgress struct {
+	Status        ReindexStatus `json:"status,omitempty"`
+	TransactionID string        `json:"transactionId,omitempty"`
+	Offset        int           `json:"offset"`
+	After         string        `json:"after,omitempty"`
+	Published     int           `json:"published"`
+	Failed        int           `json:"failed"`
+	Error         string        `json:"error,omitempty"`
+	StartedAt     time.Time     `json:"startedAt"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+}
+
+// ReindexStore keeps the progress of the last reindex, so that it can be resumed after an interruption.
+type ReindexStore interface {
+	Load() (ReindexProgress, error)
+	Save(p ReindexProgress) error
+}
+
+// FileReindexStore is a ReindexStore which keeps the progress in a file.
+type FileReindexStore struct {
+	path string
+}
+
+// NewFileReindexStore returns a ReindexStore which keeps the progress in the given directory.
+func NewFileReindexStore(dir string) (*FileReindexStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create reindex directory: %w", err)
+	}
+	return &FileReindexStore{path: filepath.Join(dir, reindexFileName)}, nil
+}
+
+// Load returns the stored progress or an empty one if no reindex was run yet.
+func (s *FileReindexStore) Load() (ReindexProgress, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return ReindexProgress{}, nil
+	}
+	if err != nil {
+		return ReindexProgress{}, fmt.Errorf("failed to read reindex progress: %w", err)
+	}
+
+	var p ReindexProgress
+	if err = json.Unmarshal(b, &p); err != nil {
+		return ReindexProgress{}, fmt.Errorf("failed to decode reindex progress: %w", err)
+	}
+	return p, nil
+}
+
+// Save replaces the stored progress.
+func (s *FileReindexStore) Save(p ReindexProgress) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode reindex progress: %w", err)
+	}
+	return writeFileAtomic(s.path, b)
+}
+
+// memoryReindexStore is a ReindexStore which does not survive restarts. It is used when no durable store is configured.
+type memoryReindexStore struct {
+	mu       sync.Mutex
+	progress ReindexProgress
+}
+
+func (s *memoryReindexStore) Load() (ReindexProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.progress, nil
+}
+
+func (s *memoryReindexStore) Save(p ReindexProgress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress = p
+	return nil
+}
+
+// Reindexer republishes every concept in the Smartlogic model, e.g. to rebuild the downstream stores.
+// The model is read page by page and every page is published with ForceNotifyContext.
+type Reindexer struct {
+	notifier Servicer
+	slClient smartlogic.Clienter
+	store    ReindexStore
+	pageSize int
+	limiter  *rate.Limiter
+	log      *logger.UPPLogger
+
+	mu       sync.Mutex
+	progress ReindexProgress
+	cancel   context.CancelFunc
+}
+
+func NewReindexer(notifier Servicer, slClient smartlogic.Clienter, log *logger.UPPLogger, opts ...func(*Reindexer)) *Reindexer {
+	r := &Reindexer{
+		notifier: notifier,
+		slClient: slClient,
+		store:    &memoryReindexStore{},
+		pageSize: defaultReindexPageSize,
+		log:      log,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithReindexStore sets the store used to keep the progress of the reindex between restarts.
+func WithReindexStore(store ReindexStore) func(*Reindexer) {
+	return func(r *Reindexer) {
+		r.store = store
+	}
+}
+
+// WithReindexPageSize sets how many concepts are requested from Smartlogic at once.
+func WithReindexPageSize(size int) func(*Reindexer) {
+	return func(r *Reindexer) {
+		if size > 0 {
+			r.pageSize = size
+		}
+	}
+}
+
+// WithReindexThrottle limits the reindex to the given number of concepts per second, 0 means unlimited.
+func WithReindexThrottle(conceptsPerSecond int) func(*Reindexer) {
+	return func(r *Reindexer) {
+		r.limiter = nil
+		if conceptsPerSecond > 0 {
+			r.limiter = rate.NewLimiter(rate.Limit(conceptsPerSecond), conceptsPerSecond)
+		}
+	}
+}
+
+// Progress returns the progress of the running reindex or of the last one if none is running.
+func (r *Reindexer) Progress() (ReindexProgress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return r.progress, nil
+	}
+	return r.store.Load()
+}
+
+// Start runs the reindex in the background. See Run.
+func (r *Reindexer) Start(transactionID string, restart bool) (ReindexProgress, error) {
+	ctx, progress, err := r.begin(transactionID, restart)
+	if err != nil {
+		return ReindexProgress{}, err
+	}
+	go func() {
+		_ = r.run(ctx, progress)
+	}()
+	return progress, nil
+}
+
+// Stop interrupts the running reindex. The reindex can be resumed later from where it was stopped.
+func (r *Reindexer) Stop() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel == nil {
+		return false
+	}
+	r.cancel()
+	return true
+}
+
+// Run republishes every concept in the model and returns when done or when the context is cancelled.
+// A reindex which did not complete is resumed from where it stopped, unless restart is set.
+func (r *Reindexer) Run(ctx context.Context, transactionID string, restart bool) (ReindexProgress, error) {
+	runCtx, progress, err := r.begin(transactionID, restart)
+	if err != nil {
+		return ReindexProgress{}, err
+	}
+	stop := context.AfterFunc(ctx, func() { r.Stop() })
+	defer stop()
+
+	err = r.run(runCtx, progress)
+	p, _ := r.Progress()
+	return p, err
+}
+
+func (r *Reindexer) begin(transactionID string, restart bool) (context.Context, ReindexProgress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return nil, ReindexProgress{}, ErrReindexRunning
+	}
+
+	previous, err := r.store.Load()
+	if err != nil {
+		return nil, ReindexProgress{}, err
+	}
+
+	if transactionID == "" {
+		transactionID = transactionidutils.NewTransactionID()
+	}
+
+	now := time.Now()
+	progress := ReindexProgress{StartedAt: now}
+	switch {
+	case restart || previous.Status == "" || previous.Status == ReindexDone:
+	case previous.After == "" && previous.Offset > 0:
+		// the progress was recorded by offset, which does not say which concepts were read
+		r.log.WithTransactionID(transactionID).Warnf("The reindex stopped at offset %d can not be resumed, restarting it", previous.Offset)
+	default:
+		r.log.WithTransactionID(transactionID).Infof("Resuming the reindex after concept %s at offset %d", previous.After, previous.Offset)
+		progress = previous
+		progress.Error = ""
+	}
+	progress.Status = ReindexRunning
+	progress.TransactionID = transactionID
+	progress.UpdatedAt = now
+	if err = r.store.Save(progress); err != nil {
+		return nil, ReindexProgress{}, err
+	}
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	r.progress = progress
+	return ctx, progress, nil
+}
+
+func (r *Reindexer) run(ctx context.Context, progress ReindexProgress) error {
+	entry := r.log.WithTransactionID(progress.TransactionID)
+	entry.Infof("Reindexing the model from offset %d", progress.Offset)
+
+	err := r.publishPages(ctx, &progress)
+	switch {
+	case err == nil:
+		progress.Status = ReindexDone
+		entry.Infof("Reindex completed, %d concepts published and %d failed", progress.Published, progress.Failed)
+	case ctx.Err() != nil:
+		progress.Status = ReindexInterrupted
+		entry.Infof("Reindex interrupted at offset %d", progress.Offset)
+	default:
+		progress.Status = ReindexFailed
+		progress.Error = err.Error()
+		entry.WithError(err).Errorf("Reindex failed at offset %d", progress.Offset)
+	}
+	r.update(progress)
+
+	r.mu.Lock()
+	r.cancel()
+	r.cancel = nil
+	r.mu.Unlock()
+	return err
+}
+
+func (r *Reindexer) publishPages(ctx context.Context, progress *ReindexProgress) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// the pages are read by guid, so the concepts added or removed before the resumed page do not shift it
+		page, err := r.slClient.GetConceptPageContext(ctx, progress.After, r.pageSize)
+		if err != nil {
+			return err
+		}
+		if page.Size == 0 {
+			return nil
+		}
+		if page.Last == "" && page.Size >= r.pageSize {
+			return fmt.Errorf("the page of concepts after %q has no guid to read the next page after", progress.After)
+		}
+
+		if r.limiter != nil && len(page.UUIDs) > 0 {
+			// a page can be larger than the burst of the limiter, so the wait is done concept by concept
+			for range page.UUIDs {
+				if err = r.limiter.Wait(ctx); err != nil {
+					return err
+				}
+			}
+		}
+
+		// the concepts are published even if they did not change, as the point of a reindex is to rebuild the downstream stores
+		results, _ := r.notifier.ForceNotifyContext(ctx, page.UUIDs, progress.TransactionID, true)
+		published := 0
+		for _, result := range results {
+			if result.Status.succeeded() {
+				published++
+			}
+		}
+		if err = ctx.Err(); err != nil && published < len(results) {
+			// the page was cut short by the reindex being stopped, it is published again when the reindex is resumed
+			return err
+		}
+		progress.Published += published
+		progress.Failed += len(results) - published
+		progress.Offset += page.Size
+		progress.After = page.Last
+		r.update(*progress)
+		r.log.WithTransactionID(progress.TransactionID).
+			Infof("Reindexed %d concepts, %d published and %d failed", progress.Offset, progress.Published, progress.Failed)
+
+		if page.Size < r.pageSize {
+			return nil
+		}
+	}
+}
+
+// update records the progress so that it can be reported and resumed from.
+func (r *Reindexer) update(progress ReindexProgress) {
+	progress.UpdatedAt = time.Now()
+	r.mu.Lock()
+	r.progress = progress
+	r.mu.Unlock()
+	if err := r.store.Save(progress); err != nil {
+		r.log.WithError(err).WithTransactionID(progress.TransactionID).Error("Failed to save the reindex progress")
+	}
+}
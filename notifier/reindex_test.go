@@ -0,0 +1,340 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modelPages returns a getConceptPageFunc serving the given number of concepts.
+func modelPages(total int) func(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error) {
+	var uuids []string
+	for i := 0; i < total; i++ {
+		uuids = append(uuids, fmt.Sprintf("uuid%d", i))
+	}
+	return modelPagesOf(&uuids)
+}
+
+// modelPagesOf returns a getConceptPageFunc serving the given concepts, which are in the order of their guid,
+// the guid of a concept being its uuid. The concepts can be changed between the pages.
+func modelPagesOf(uuids *[]string) func(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error) {
+	return func(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error) {
+		page := smartlogic.ConceptPage{UUIDs: []string{}}
+		start := 0
+		if after != "" {
+			start = len(*uuids)
+			for i, uuid := range *uuids {
+				if uuid == after {
+					start = i + 1
+				}
+			}
+		}
+		for i := start; i < len(*uuids) && i < start+limit; i++ {
+			page.UUIDs = append(page.UUIDs, (*uuids)[i])
+			page.Last = (*uuids)[i]
+		}
+		page.Size = len(page.UUIDs)
+		return page, nil
+	}
+}
+
+type recordingService struct {
+	mockService
+
+	mu        sync.Mutex
+	published []string
+}
+
+func newRecordingService() *recordingService {
+	s := &recordingService{}
+	s.forceNotify = func(uuids []string, transactionID string, force bool) ([]ConceptResult, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var results []ConceptResult
+		for _, uuid := range uuids {
+			s.published = append(s.published, uuid)
+			results = append(results, ConceptResult{UUID: uuid, Status: ConceptPublished, TransactionID: transactionID})
+		}
+		return results, nil
+	}
+	return s
+}
+
+func (s *recordingService) getPublished() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.published...)
+}
+
+func TestReindexer_Run(t *testing.T) {
+	svc := newRecordingService()
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(7)}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(3))
+	progress, err := r.Run(context.Background(), "tid_reindex", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, ReindexDone, progress.Status)
+	assert.Equal(t, "tid_reindex", progress.TransactionID)
+	assert.Equal(t, 7, progress.Offset)
+	assert.Equal(t, 7, progress.Published)
+	assert.Equal(t, 0, progress.Failed)
+	assert.Len(t, svc.getPublished(), 7)
+}
+
+func TestReindexer_CountsFailedConcepts(t *testing.T) {
+	svc := &mockService{
+		forceNotify: func(uuids []string, transactionID string, force bool) ([]ConceptResult, error) {
+			results := []ConceptResult{{UUID: uuids[0], Status: ConceptKafkaError}}
+			for _, uuid := range uuids[1:] {
+				results = append(results, ConceptResult{UUID: uuid, Status: ConceptPublished})
+			}
+			return results, ConceptErrors{uuids[0]: errors.New("kafka is down")}
+		},
+	}
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(4)}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(2))
+	progress, err := r.Run(context.Background(), "tid_reindex", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, ReindexDone, progress.Status)
+	assert.Equal(t, 2, progress.Published)
+	assert.Equal(t, 2, progress.Failed)
+}
+
+func TestReindexer_ResumesAfterFailure(t *testing.T) {
+	svc := newRecordingService()
+	pages := modelPages(6)
+	failAfter := "uuid3"
+	sl := &mockSmartlogicClient{
+		getConceptPageFunc: func(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error) {
+			if after == failAfter {
+				return smartlogic.ConceptPage{}, errors.New("smartlogic is down")
+			}
+			return pages(ctx, after, limit)
+		},
+	}
+	store := &memoryReindexStore{}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(2), WithReindexStore(store))
+	progress, err := r.Run(context.Background(), "tid_first", false)
+	require.Error(t, err)
+	assert.Equal(t, ReindexFailed, progress.Status)
+	assert.Equal(t, 4, progress.Offset)
+	assert.Equal(t, "uuid3", progress.After)
+	assert.Equal(t, "smartlogic is down", progress.Error)
+
+	failAfter = ""
+	r = NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(2), WithReindexStore(store))
+	progress, err = r.Run(context.Background(), "tid_second", false)
+	require.NoError(t, err)
+	assert.Equal(t, ReindexDone, progress.Status)
+	assert.Equal(t, "tid_second", progress.TransactionID)
+	assert.Equal(t, 6, progress.Offset)
+	assert.Equal(t, 6, progress.Published)
+	assert.Empty(t, progress.Error)
+	assert.Equal(t, []string{"uuid0", "uuid1", "uuid2", "uuid3", "uuid4", "uuid5"}, svc.getPublished())
+}
+
+func TestReindexer_ResumesAfterTheLastConcept(t *testing.T) {
+	svc := newRecordingService()
+	uuids := []string{"uuid0", "uuid1", "uuid2", "uuid3", "uuid4"}
+	pages := modelPagesOf(&uuids)
+	stopAfter := "uuid1"
+	sl := &mockSmartlogicClient{
+		getConceptPageFunc: func(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error) {
+			if after == stopAfter {
+				return smartlogic.ConceptPage{}, errors.New("smartlogic is down")
+			}
+			return pages(ctx, after, limit)
+		},
+	}
+	store := &memoryReindexStore{}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(2), WithReindexStore(store))
+	_, err := r.Run(context.Background(), "tid_first", false)
+	require.Error(t, err)
+
+	// a concept read already is removed from the model, which would shift the following concepts by an offset
+	uuids = uuids[1:]
+	stopAfter = ""
+	progress, err := r.Run(context.Background(), "tid_second", false)
+	require.NoError(t, err)
+	assert.Equal(t, ReindexDone, progress.Status)
+	assert.Equal(t, []string{"uuid0", "uuid1", "uuid2", "uuid3", "uuid4"}, svc.getPublished())
+}
+
+func TestReindexer_RestartsAProgressRecordedByOffset(t *testing.T) {
+	svc := newRecordingService()
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(3)}
+	store := &memoryReindexStore{progress: ReindexProgress{Status: ReindexInterrupted, Offset: 2, Published: 2}}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexStore(store))
+	progress, err := r.Run(context.Background(), "tid_reindex", false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, progress.Offset)
+	assert.Equal(t, 3, progress.Published)
+	assert.Len(t, svc.getPublished(), 3)
+}
+
+func TestReindexer_StopCancelsThePageRequest(t *testing.T) {
+	started := make(chan struct{}, 1)
+	sl := &mockSmartlogicClient{
+		getConceptPageFunc: func(ctx context.Context, after string, limit int) (smartlogic.ConceptPage, error) {
+			started <- struct{}{}
+			<-ctx.Done()
+			return smartlogic.ConceptPage{}, ctx.Err()
+		},
+	}
+	store := &memoryReindexStore{}
+
+	r := NewReindexer(newRecordingService(), sl, logger.NewUnstructuredLogger(), WithReindexStore(store))
+	_, err := r.Start("tid_reindex", false)
+	require.NoError(t, err)
+
+	<-started
+	assert.True(t, r.Stop())
+
+	assert.Eventually(t, func() bool {
+		p, err := r.Progress()
+		return err == nil && p.Status == ReindexInterrupted
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReindexer_Restart(t *testing.T) {
+	svc := newRecordingService()
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(3)}
+	store := &memoryReindexStore{progress: ReindexProgress{Status: ReindexInterrupted, Offset: 2, Published: 2}}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexStore(store))
+	progress, err := r.Run(context.Background(), "tid_reindex", true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, progress.Offset)
+	assert.Equal(t, 3, progress.Published)
+	assert.Len(t, svc.getPublished(), 3)
+}
+
+func TestReindexer_StartAndStop(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	svc := &mockService{
+		forceNotify: func(uuids []string, transactionID string, force bool) ([]ConceptResult, error) {
+			started <- struct{}{}
+			<-release
+			var results []ConceptResult
+			for _, uuid := range uuids {
+				results = append(results, ConceptResult{UUID: uuid, Status: ConceptPublished})
+			}
+			return results, nil
+		},
+	}
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(10)}
+	store := &memoryReindexStore{}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(2), WithReindexStore(store))
+	progress, err := r.Start("tid_reindex", false)
+	require.NoError(t, err)
+	assert.Equal(t, ReindexRunning, progress.Status)
+
+	_, err = r.Start("tid_other", false)
+	assert.ErrorIs(t, err, ErrReindexRunning)
+
+	<-started
+	assert.True(t, r.Stop())
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		p, err := r.Progress()
+		return err == nil && p.Status == ReindexInterrupted
+	}, time.Second, 10*time.Millisecond)
+
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, ReindexInterrupted, stored.Status)
+	assert.Equal(t, 2, stored.Offset)
+	assert.False(t, r.Stop())
+}
+
+func TestReindexer_StopCancelsThePage(t *testing.T) {
+	started := make(chan struct{}, 1)
+	svc := &mockService{
+		forceNotifyContext: func(ctx context.Context, uuids []string, transactionID string, force bool) ([]ConceptResult, error) {
+			started <- struct{}{}
+			<-ctx.Done()
+			var results []ConceptResult
+			for _, uuid := range uuids {
+				results = append(results, ConceptResult{UUID: uuid, Status: ConceptSmartlogicError})
+			}
+			return results, ctx.Err()
+		},
+	}
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(10)}
+	store := &memoryReindexStore{}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(2), WithReindexStore(store))
+	_, err := r.Start("tid_reindex", false)
+	require.NoError(t, err)
+
+	<-started
+	assert.True(t, r.Stop())
+
+	assert.Eventually(t, func() bool {
+		p, err := r.Progress()
+		return err == nil && p.Status == ReindexInterrupted
+	}, time.Second, 10*time.Millisecond)
+
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 0, stored.Offset, "the cancelled page should be published again on resume")
+	assert.Equal(t, 0, stored.Failed)
+}
+
+func TestReindexer_Throttle(t *testing.T) {
+	svc := newRecordingService()
+	sl := &mockSmartlogicClient{getConceptPageFunc: modelPages(15)}
+
+	r := NewReindexer(svc, sl, logger.NewUnstructuredLogger(), WithReindexPageSize(5), WithReindexThrottle(10))
+	start := time.Now()
+	_, err := r.Run(context.Background(), "tid_reindex", false)
+	require.NoError(t, err)
+	// the first 10 concepts use up the burst, the following 5 are spread over half a second
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestFileReindexStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileReindexStore(dir)
+	require.NoError(t, err)
+
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, stored.Status)
+
+	progress := ReindexProgress{
+		Status:        ReindexInterrupted,
+		TransactionID: "tid_reindex",
+		Offset:        300,
+		After:         "9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f",
+		Published:     298,
+		Failed:        2,
+		StartedAt:     time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC),
+		UpdatedAt:     time.Date(2020, 4, 5, 10, 5, 0, 0, time.UTC),
+	}
+	require.NoError(t, store.Save(progress))
+
+	store, err = NewFileReindexStore(dir)
+	require.NoError(t, err)
+
+	stored, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, progress, stored)
+}
@@ -0,0 +1,42 @@
+package notifier
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how the fetching of a single concept from Smartlogic is retried when it fails,
+// e.g. because Smartlogic returns 5xx or the changed concept is not visible yet.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Values below 2 disable retrying.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, every following wait is doubled up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction of the backoff which is randomised, between 0 and 1.
+	Jitter float64
+}
+
+// noRetryPolicy is used when no retry policy is configured.
+var noRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// backoff returns how long to wait before the given retry, counting from 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 && d > 0 {
+		jitter := time.Duration(p.Jitter * float64(d))
+		// spread the wait evenly in [d-jitter, d+jitter]
+		d = d - jitter + time.Duration(rand.Int63n(int64(2*jitter)+1))
+	}
+	return d
+}
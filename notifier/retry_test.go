@@ -0,0 +1,33 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+
+	assert.Equal(t, 100*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 300*time.Millisecond, p.backoff(3))
+	assert.Equal(t, 300*time.Millisecond, p.backoff(4))
+}
+
+func TestRetryPolicy_BackoffWithJitter(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 300*time.Millisecond)
+	}
+}
+
+func TestRetryPolicy_Enabled(t *testing.T) {
+	assert.False(t, noRetryPolicy.enabled())
+	assert.False(t, RetryPolicy{}.enabled())
+	assert.True(t, RetryPolicy{MaxAttempts: 2}.enabled())
+}
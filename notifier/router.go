@@ -0,0 +1,129 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ModelRouter serves the endpoints for several Smartlogic models, each of them handled by its own Handler.
+// The notifications are routed by their modifiedGraphId and the rest of the requests by the model query parameter,
+// which can be left out when there is only one model.
+type ModelRouter struct {
+	handlers map[string]*Handler
+	models   []string
+	tracer   trace.Tracer
+}
+
+func NewModelRouter(modelHandlers ...*Handler) *ModelRouter {
+	r := &ModelRouter{handlers: map[string]*Handler{}, tracer: otel.Tracer(tracerName)}
+	for _, h := range modelHandlers {
+		r.handlers[h.model] = h
+		r.models = append(r.models, h.model)
+	}
+	sort.Strings(r.models)
+	return r
+}
+
+// handlerFor returns the handler of the given model. The model can be empty if there is only one.
+func (r *ModelRouter) handlerFor(model string) (*Handler, error) {
+	if model == "" && len(r.models) == 1 {
+		return r.handlers[r.models[0]], nil
+	}
+	if h, ok := r.handlers[model]; ok {
+		return h, nil
+	}
+	if model == "" {
+		return nil, fmt.Errorf("Query parameter model is required, it should be one of %s", strings.Join(r.models, ", "))
+	}
+	return nil, fmt.Errorf("Unknown model %q, it should be one of %s", model, strings.Join(r.models, ", "))
+}
+
+// byModel returns a handler func which passes the request to the given method of the handler of the requested model.
+func (r *ModelRouter) byModel(handle func(h *Handler, resp http.ResponseWriter, req *http.Request)) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		h, err := r.handlerFor(req.URL.Query().Get("model"))
+		if err != nil {
+			writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: err.Error()})
+			return
+		}
+		handle(h, resp, req)
+	}
+}
+
+func (r *ModelRouter) HandleNotify(resp http.ResponseWriter, req *http.Request) {
+	h, ok := r.handlers[req.URL.Query().Get("modifiedGraphId")]
+	if !ok {
+		if len(r.models) != 1 {
+			writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: "Query parameters are missing or incorrect: modifiedGraphId"})
+			return
+		}
+		// the handler of the only model reports what is wrong with the notification
+		h = r.handlers[r.models[0]]
+	}
+	h.HandleNotify(resp, req)
+}
+
+func (r *ModelRouter) HandleGetJob(resp http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	for _, model := range r.models {
+		h := r.handlers[model]
+		if _, ok := h.jobs.get(id); ok {
+			h.HandleGetJob(resp, req)
+			return
+		}
+	}
+	writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: "Job not found"})
+}
+
+func (r *ModelRouter) RegisterEndpoints(router *mux.Router) {
+	notifyHandler := handlers.MethodHandler{
+		"GET": http.HandlerFunc(r.HandleNotify),
+	}
+	forceNotifyHandler := handlers.MethodHandler{
+		"POST": r.byModel((*Handler).HandleForceNotify),
+	}
+	getConceptHandler := handlers.MethodHandler{
+		"GET": r.byModel((*Handler).HandleGetConcept),
+	}
+	getConceptsHandler := handlers.MethodHandler{
+		"GET": r.byModel((*Handler).HandleGetConcepts),
+	}
+	getJobHandler := handlers.MethodHandler{
+		"GET": http.HandlerFunc(r.HandleGetJob),
+	}
+	getDeadLettersHandler := handlers.MethodHandler{
+		"GET": r.byModel((*Handler).HandleGetDeadLetters),
+	}
+	replayDeadLettersHandler := handlers.MethodHandler{
+		"POST": r.byModel((*Handler).HandleReplayDeadLetters),
+	}
+	reindexHandler := handlers.MethodHandler{
+		"GET":    r.byModel((*Handler).HandleGetReindex),
+		"POST":   r.byModel((*Handler).HandleStartReindex),
+		"DELETE": r.byModel((*Handler).HandleStopReindex),
+	}
+
+	endpoints := []struct {
+		route   string
+		handler http.Handler
+	}{
+		{"/notify", notifyHandler},
+		{"/force-notify", forceNotifyHandler},
+		{"/concept/{uuid}", getConceptHandler},
+		{"/concepts", getConceptsHandler},
+		{"/jobs/{id}", getJobHandler},
+		{"/dead-letters", getDeadLettersHandler},
+		{"/dead-letters/replay", replayDeadLettersHandler},
+		{"/reindex", reindexHandler},
+	}
+	for _, e := range endpoints {
+		router.Handle(e.route, traceRequests(r.tracer, e.route, e.handler))
+	}
+}
@@ -0,0 +1,118 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRouter(t *testing.T) {
+	t.Parallel()
+
+	notified := make(chan string, 2)
+	newModelService := func(model string) *mockService {
+		return &mockService{
+			notify: func(since time.Time, transactionID string, progress ProgressFunc) error {
+				notified <- model
+				return nil
+			},
+			getConcept: func(uuid string) ([]byte, error) {
+				return []byte(fmt.Sprintf(`{"model": "%s"}`, model)), nil
+			},
+		}
+	}
+
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	first := NewNotifierHandler(newModelService("FirstModel"), "FirstModel", logger.NewUnstructuredLogger(), WithTicker(tk))
+	second := NewNotifierHandler(newModelService("SecondModel"), "SecondModel", logger.NewUnstructuredLogger(), WithTicker(tk))
+	m := mux.NewRouter()
+	NewModelRouter(first, second).RegisterEndpoints(m)
+
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("notifications are routed by modifiedGraphId", func(t *testing.T) {
+		url := fmt.Sprintf("/notify?affectedGraphId=SecondModel&modifiedGraphId=SecondModel&lastChangeDate=%s", time.Now().Format(TimeFormat))
+		rr := serve("GET", url)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		select {
+		case model := <-notified:
+			assert.Equal(t, "SecondModel", model)
+		case <-time.After(time.Second):
+			t.Fatal("the notification was not processed")
+		}
+
+		var accepted struct {
+			JobID string `json:"jobId"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &accepted))
+		assert.Equal(t, http.StatusOK, serve("GET", "/jobs/"+accepted.JobID).Code)
+		assert.Equal(t, http.StatusNotFound, serve("GET", "/jobs/unknown").Code)
+	})
+
+	t.Run("notifications of unknown models are rejected", func(t *testing.T) {
+		url := fmt.Sprintf("/notify?affectedGraphId=OtherModel&modifiedGraphId=OtherModel&lastChangeDate=%s", time.Now().Format(TimeFormat))
+		rr := serve("GET", url)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"message": "Query parameters are missing or incorrect: modifiedGraphId"}`, rr.Body.String())
+	})
+
+	t.Run("requests are routed by the model parameter", func(t *testing.T) {
+		rr := serve("GET", "/concept/uuid1?model=FirstModel")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"model": "FirstModel"}`, rr.Body.String())
+
+		rr = serve("GET", "/concept/uuid1")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"message": "Query parameter model is required, it should be one of FirstModel, SecondModel"}`, rr.Body.String())
+
+		rr = serve("GET", "/concept/uuid1?model=OtherModel")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"message": "Unknown model \"OtherModel\", it should be one of FirstModel, SecondModel"}`, rr.Body.String())
+	})
+
+	t.Run("the unknown model is escaped in the response", func(t *testing.T) {
+		rr := serve("GET", "/concept/uuid1?model="+url.QueryEscape(`Other"Model\`))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), rr.Body.String())
+		assert.Equal(t, `Unknown model "Other\"Model\\", it should be one of FirstModel, SecondModel`, body["message"])
+	})
+}
+
+func TestModelRouter_SingleModel(t *testing.T) {
+	t.Parallel()
+
+	svc := &mockService{
+		getConcept: func(uuid string) ([]byte, error) {
+			return []byte(`{"model": "FTTestModel"}`), nil
+		},
+	}
+	handler := NewNotifierHandler(svc, smartlogicModel, logger.NewUnstructuredLogger())
+	m := mux.NewRouter()
+	NewModelRouter(handler).RegisterEndpoints(m)
+
+	req, _ := http.NewRequest("GET", "/concept/uuid1", nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, _ = http.NewRequest("GET", "/notify?affectedGraphId=OtherModel&modifiedGraphId=OtherModel", nil)
+	rr = httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
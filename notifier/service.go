@@ -1,40 +1,216 @@
 package notifier
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/kafka-client-go/v4"
 	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Servicer interface {
 	GetConcept(uuid string) ([]byte, error)
+	GetConceptWithProperties(uuid string, properties []string) ([]byte, error)
 	GetChangedConceptList(lastChange time.Time) ([]string, error)
-	Notify(lastChange time.Time, transactionID string) error
-	ForceNotify(UUIDs []string, transactionID string) error
+	GetConceptChangesAfter(key smartlogic.ChangesKey, limit int) (smartlogic.ConceptChanges, error)
+	Notify(lastChange time.Time, transactionID string, progress ProgressFunc) error
+	NotifyContext(ctx context.Context, lastChange time.Time, transactionID string, progress ProgressFunc) error
+	ForceNotify(UUIDs []string, transactionID string, force bool) ([]ConceptResult, error)
+	ForceNotifyContext(ctx context.Context, UUIDs []string, transactionID string, force bool) ([]ConceptResult, error)
+	CatchUp(transactionID string) error
+	DeadLetters() ([]DeadLetter, error)
+	ReplayDeadLetters(UUIDs []string, transactionID string) ([]ConceptResult, error)
+	SmartlogicTokenStatus() smartlogic.TokenStatus
 	CheckKafkaConnectivity() error
 }
 
+// ConceptStatus is the outcome of publishing a single concept.
+type ConceptStatus string
+
+const (
+	ConceptPublished       ConceptStatus = "published"
+	ConceptDeleted         ConceptStatus = "deleted"
+	ConceptUnchanged       ConceptStatus = "unchanged"
+	ConceptNotFound        ConceptStatus = "not_found"
+	ConceptSmartlogicError ConceptStatus = "smartlogic_error"
+	ConceptTransformError  ConceptStatus = "transform_error"
+	ConceptQuarantined     ConceptStatus = "quarantined"
+	ConceptKafkaError      ConceptStatus = "kafka_error"
+)
+
+// succeeded tells whether the concept is up to date in Kafka, either because it was published or deleted or because it did not change.
+func (s ConceptStatus) succeeded() bool {
+	return s == ConceptPublished || s == ConceptDeleted || s == ConceptUnchanged
+}
+
+// ConceptResult is the outcome of publishing the concept with the given uuid.
+// TransactionID is the transaction id of the message sent to Kafka, it is empty if no message was sent.
+// FailedRules are the validation rules the concept failed, if it was quarantined.
+type ConceptResult struct {
+	UUID          string        `json:"uuid"`
+	Status        ConceptStatus `json:"status"`
+	TransactionID string        `json:"transactionId,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	FailedRules   []string      `json:"failedRules,omitempty"`
+}
+
+// The headers of the messages sent to Kafka, on top of the transaction id.
+const (
+	originSystemIDHeader      = "Origin-System-Id"
+	smartlogicModelHeader     = "Smartlogic-Model"
+	contentTypeHeader         = "Content-Type"
+	messageTimestampHeader    = "Message-Timestamp"
+	changeCommittedHeader     = "Change-Committed"
+	parentTransactionIDHeader = "Parent-Transaction-Id"
+	changeTypeHeader          = "Change-Type"
+	mergedIntoHeader          = "Merged-Into-Uuid"
+
+	smartlogicOriginSystemID = "http://cmdb.ft.com/systems/smartlogic"
+	conceptContentType       = "application/ld+json"
+	uppConceptContentType    = "application/vnd.ft-upp-concept+json"
+	messageTimestampFormat   = "2006-01-02T15:04:05.000Z"
+
+	// deletedHash is kept as the hash of the concepts for which a delete message was sent,
+	// so that the delete message is not sent again and the concept is published again if it is recreated.
+	deletedHash = "deleted"
+)
+
+// changesRetryDelay is how long to wait before getting the changes again when Smartlogic notified of changes it does not return yet.
+const changesRetryDelay = 10 * time.Second
+
+// ErrNoChangedConcepts is returned when Smartlogic has no changes since the time of a notification, even after waiting for them.
+var ErrNoChangedConcepts = errors.New("no changed concepts were returned")
+
+// errTransformFailed is the error of the concepts which could not be transformed into the UPP concept model.
+var errTransformFailed = errors.New("failed to transform the concept")
+
 type Service struct {
+	producer     messageProducer
+	slClient     smartlogic.Clienter
+	model        string
+	checkpoint   CheckpointStore
+	checkpointMu sync.Mutex
+	deadLetters  DeadLetterStore
+	hashes       HashStore
+	retryPolicy  RetryPolicy
+	concurrency  int
+	uuidLocks    *uuidLocks
+	transform    *conceptTransform
+	rules        []ValidationRule
+	metrics      metrics.Registry
+	tracer       trace.Tracer
+	log          *logger.UPPLogger
+}
+
+// conceptTransform publishes the concepts in the UPP concept model as well as in json-ld.
+type conceptTransform struct {
 	producer messageProducer
-	slClient smartlogic.Clienter
-	log      *logger.UPPLogger
+	uris     *smartlogic.URIRegistry
 }
 
 type messageProducer interface {
-	SendMessage(message kafka.FTMessage) error
+	SendMessage(key string, message kafka.FTMessage) error
 	ConnectivityCheck() error
 }
 
-func NewNotifierService(producer messageProducer, slClient smartlogic.Clienter, log *logger.UPPLogger) *Service {
-	return &Service{
-		producer: producer,
-		slClient: slClient,
-		log:      log,
+func NewNotifierService(producer messageProducer, slClient smartlogic.Clienter, log *logger.UPPLogger, opts ...func(*Service)) *Service {
+	s := &Service{
+		producer:    producer,
+		slClient:    slClient,
+		checkpoint:  &memoryCheckpoint{},
+		deadLetters: newMemoryDeadLetterStore(),
+		hashes:      newMemoryHashStore(),
+		retryPolicy: noRetryPolicy,
+		concurrency: 1,
+		uuidLocks:   newUUIDLocks(),
+		metrics:     metrics.NewRegistry(),
+		tracer:      otel.Tracer(tracerName),
+		log:         log,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithSmartlogicModel sets the Smartlogic model the concepts are read from, it is added to the messages sent to Kafka.
+func WithSmartlogicModel(model string) func(*Service) {
+	return func(s *Service) {
+		s.model = model
+	}
+}
+
+// WithCheckpoint sets the store for the sem:committed time of the last fully processed change.
+func WithCheckpoint(c CheckpointStore) func(*Service) {
+	return func(s *Service) {
+		s.checkpoint = c
+	}
+}
+
+// WithDeadLetters sets the store for the concepts which failed to be published.
+func WithDeadLetters(d DeadLetterStore) func(*Service) {
+	return func(s *Service) {
+		s.deadLetters = d
+	}
+}
+
+// WithHashStore sets the store for the hashes of the last published concepts, which are used to skip unchanged concepts.
+func WithHashStore(h HashStore) func(*Service) {
+	return func(s *Service) {
+		s.hashes = h
+	}
+}
+
+// WithRetryPolicy sets how the fetching of the concepts which fail is retried. The concepts which do not exist, are invalid
+// or are not authorized are not retried.
+func WithRetryPolicy(p RetryPolicy) func(*Service) {
+	return func(s *Service) {
+		s.retryPolicy = p
+	}
+}
+
+// WithConcurrency sets how many concepts are fetched and published in parallel.
+func WithConcurrency(n int) func(*Service) {
+	return func(s *Service) {
+		if n > 0 {
+			s.concurrency = n
+		}
+	}
+}
+
+// WithConceptTransform publishes every concept in the UPP concept model to the given producer as well,
+// so that the consumers do not have to parse the json-ld. The uris are used to refer to the related concepts by their uuid.
+func WithConceptTransform(producer messageProducer, uris *smartlogic.URIRegistry) func(*Service) {
+	return func(s *Service) {
+		s.transform = &conceptTransform{producer: producer, uris: uris}
+	}
+}
+
+// WithValidationRules sets the rules the concepts are checked against before they are published.
+// The concepts which fail any of them are quarantined instead of being published.
+func WithValidationRules(rules ...ValidationRule) func(*Service) {
+	return func(s *Service) {
+		s.rules = rules
+	}
+}
+
+// WithMetrics adds the metrics of the published concepts to the given registry.
+func WithMetrics(r metrics.Registry) func(*Service) {
+	return func(s *Service) {
+		s.metrics = r
 	}
 }
 
@@ -42,70 +218,635 @@ func (s *Service) GetConcept(uuid string) ([]byte, error) {
 	return s.slClient.GetConcept(uuid)
 }
 
+// GetConceptWithProperties returns the concept with the given properties instead of the ones of the model.
+func (s *Service) GetConceptWithProperties(uuid string, properties []string) ([]byte, error) {
+	return s.slClient.GetConceptWithProperties(uuid, properties)
+}
+
+// SmartlogicTokenStatus returns the Smartlogic access token in use and when it was issued and expires.
+func (s *Service) SmartlogicTokenStatus() smartlogic.TokenStatus {
+	return s.slClient.TokenStatus()
+}
+
 func (s *Service) GetChangedConceptList(lastChange time.Time) (uuids []string, err error) {
 	return s.slClient.GetChangedConceptList(lastChange)
 }
 
-func (s *Service) Notify(lastChange time.Time, transactionID string) error {
-	changedConcepts, err := s.slClient.GetChangedConceptList(lastChange)
+// GetConceptChangesAfter returns a page of the changes the given key points at, see smartlogic.Client.GetConceptChangesAfter.
+func (s *Service) GetConceptChangesAfter(key smartlogic.ChangesKey, limit int) (smartlogic.ConceptChanges, error) {
+	return s.slClient.GetConceptChangesAfter(key, limit)
+}
+
+// Notify publishes the concepts changed since the given time. The optional progress func is called
+// when the fetching of the changes and the publishing of the concepts starts.
+func (s *Service) Notify(lastChange time.Time, transactionID string, progress ProgressFunc) error {
+	return s.NotifyContext(context.Background(), lastChange, transactionID, progress)
+}
+
+// NotifyContext is Notify with the requests to Smartlogic and Kafka traced as part of the given context.
+func (s *Service) NotifyContext(ctx context.Context, lastChange time.Time, transactionID string, progress ProgressFunc) error {
+	if progress == nil {
+		progress = func(JobStatus, []string) {}
+	}
+
+	progress(JobFetching, nil)
+	published, err := s.publishChanges(ctx, lastChange, transactionID, progress)
 	if err != nil {
 		return fmt.Errorf("failed to fetch the list of changed concepts: %w", err)
 	}
 
-	if len(changedConcepts) == 0 {
+	if len(published.uuids) == 0 {
 		// After some time interval retry getting the changed concept list,
 		// because Smartlogic sometimes notify us before the data is available to be retrieved.
-		time.Sleep(time.Second * 10)
-		changedConcepts, err = s.slClient.GetChangedConceptList(lastChange)
+		timer := time.NewTimer(changesRetryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("stopped waiting for the changed concepts: %w", ctx.Err())
+		case <-timer.C:
+		}
+		published, err = s.publishChanges(ctx, lastChange, transactionID, progress)
 		if err != nil {
 			return fmt.Errorf("failed while retrying to fetch the list of changed concepts: %w", err)
 		}
 	}
 
-	if len(changedConcepts) == 0 {
-		return fmt.Errorf("no changed concepts since %v were returned for transaction id %s", lastChange, transactionID)
+	if len(published.uuids) == 0 {
+		return fmt.Errorf("%w since %v for transaction id %s", ErrNoChangedConcepts, lastChange, transactionID)
 	}
+	if len(published.errs) > 0 {
+		return published.errs
+	}
+	s.advanceCheckpointFrom(lastChange, published.lastCommitted)
+	return nil
+}
 
-	return s.ForceNotify(changedConcepts, transactionID)
+// publishedChanges is the outcome of publishing the concepts changed since a point in time.
+type publishedChanges struct {
+	uuids         []string
+	lastCommitted time.Time
+	errs          ConceptErrors
 }
 
-func (s *Service) ForceNotify(UUIDs []string, transactionID string) error {
-	errorMap := map[string]error{}
+// publishChanges publishes the concepts changed since the given time page by page, as the pages of changes arrive from Smartlogic.
+// A concept changed in several pages is published once. The returned error is the one of getting the changes,
+// the concepts which failed are in the returned errs. The optional progress func is called with the uuids of every page.
+func (s *Service) publishChanges(ctx context.Context, since time.Time, transactionID string, progress ProgressFunc) (publishedChanges, error) {
+	if progress == nil {
+		progress = func(JobStatus, []string) {}
+	}
+	published := publishedChanges{uuids: []string{}, errs: ConceptErrors{}}
+	seen := map[string]bool{}
+	err := s.slClient.StreamConceptChangesContext(ctx, since, func(page smartlogic.ConceptChanges) error {
+		if page.LastCommitted.After(published.lastCommitted) {
+			published.lastCommitted = page.LastCommitted
+		}
+		var uuids []string
+		for _, uuid := range page.UUIDs {
+			if !seen[uuid] {
+				seen[uuid] = true
+				uuids = append(uuids, uuid)
+			}
+		}
+		s.logChangesets(page, transactionID)
+		if len(uuids) == 0 {
+			return nil
+		}
 
-	for _, conceptUUID := range UUIDs {
-		concept, err := s.slClient.GetConcept(conceptUUID)
-		if err != nil {
-			errorMap[conceptUUID] = err
-			continue
+		published.uuids = append(published.uuids, uuids...)
+		progress(JobPublishing, append([]string(nil), published.uuids...))
+		_, err := s.publish(ctx, uuids, transactionID, page.LatestEvents(), false)
+		var conceptErrors ConceptErrors
+		if errors.As(err, &conceptErrors) {
+			for uuid, conceptErr := range conceptErrors {
+				// the concepts which failed for good are kept in the dead letters and do not hold back the checkpoint,
+				// as fixing them in Smartlogic makes a new change which publishes them
+				if permanentConceptError(conceptErr) {
+					continue
+				}
+				published.errs[uuid] = conceptErr
+			}
+		} else if err != nil {
+			return err
 		}
+		return nil
+	})
+	if err == nil {
+		metrics.GetOrRegisterHistogram(metricName("notify", s.model, "changes"), s.metrics, metrics.NewExpDecaySample(1028, 0.015)).
+			Update(int64(len(published.uuids)))
+	}
+	return published, err
+}
 
-		newTransactionID := transactionidutils.NewTransactionID()
+// CatchUp publishes the concepts changed since the last fully processed change.
+// It allows recovering the changes for which we did not receive a notification, e.g. because the service was down.
+// The catch up is not bound by the LastChangeLimit.
+func (s *Service) CatchUp(transactionID string) (err error) {
+	ctx, span := s.tracer.Start(context.Background(), "notifier.CatchUp", trace.WithAttributes(
+		modelAttribute.String(s.model),
+		transactionIDAttribute.String(transactionID),
+	))
+	defer func() { endSpan(span, err) }()
 
-		message := kafka.NewFTMessage(map[string]string{
-			transactionidutils.TransactionIDHeader: newTransactionID,
-		}, string(concept))
-		s.log.
-			WithTransactionID(transactionID).
-			WithField("concept_transaction_id", newTransactionID).
-			WithField("concept_uuid", conceptUUID).
-			Info("Sending message to Kafka")
-		err = s.producer.SendMessage(message)
-		if err != nil {
-			errorMap[conceptUUID] = err
+	since, err := s.checkpoint.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load the last processed change time: %w", err)
+	}
+	if since.IsZero() {
+		s.log.WithTransactionID(transactionID).Info("No processed changes recorded yet, skipping catch up")
+		return nil
+	}
+
+	span.SetAttributes(notifySinceAttribute.String(since.Format(time.RFC3339)))
+	published, err := s.publishChanges(ctx, since, transactionID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the list of changed concepts: %w", err)
+	}
+	if len(published.uuids) > 0 {
+		s.log.WithTransactionID(transactionID).
+			WithField("uuids", published.uuids).
+			Infof("Caught up with %d concepts changed since %v", len(published.uuids), since)
+	}
+	if len(published.errs) > 0 {
+		return published.errs
+	}
+	s.advanceCheckpointFrom(since, published.lastCommitted)
+	return nil
+}
+
+// logChangesets logs the changesets the changes were made in, so that the published concepts can be traced back to them.
+func (s *Service) logChangesets(changes smartlogic.ConceptChanges, transactionID string) {
+	for _, changeset := range changes.Changesets {
+		s.log.WithTransactionID(transactionID).
+			WithField("changeset", changeset.ID).
+			WithField("changeType", changeset.ChangeType).
+			WithField("author", changeset.Author).
+			WithField("committed", changeset.Committed).
+			WithField("uuids", changeset.UUIDs).
+			Info("Processing Smartlogic changeset")
+	}
+}
+
+// StartCatchUp starts separate go routine which catches up with the missed changes on startup and on every interval after that.
+// A zero interval means that the catch up is performed only on startup.
+func (s *Service) StartCatchUp(interval time.Duration) {
+	go func() {
+		s.catchUp()
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.catchUp()
+		}
+	}()
+}
+
+func (s *Service) catchUp() {
+	transactionID := transactionidutils.NewTransactionID()
+	err := s.CatchUp(transactionID)
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transactionID).Error("Failed to catch up with the missed changes")
+	}
+}
+
+// advanceCheckpointFrom stores the given time as the last processed change time, unless a later one is already stored.
+// The changes published are the ones made since the given time, so the checkpoint is advanced only when they follow on
+// from it. Otherwise the changes between the checkpoint and the given time may have failed, e.g. in an earlier notification,
+// and the catch up, which starts from the checkpoint, would skip them.
+func (s *Service) advanceCheckpointFrom(since, lastCommitted time.Time) {
+	if lastCommitted.IsZero() {
+		return
+	}
+
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	current, err := s.checkpoint.Load()
+	if err != nil {
+		s.log.WithError(err).Error("Failed to load the last processed change time")
+		return
+	}
+	if !lastCommitted.After(current) {
+		return
+	}
+	// without a checkpoint, the first changes processed start it
+	if !current.IsZero() && since.After(current) {
+		s.log.Debugf("Not advancing the last processed change time %v to %v, as the changes since %v were not processed",
+			current, lastCommitted, current)
+		return
+	}
+	err = s.checkpoint.Save(lastCommitted)
+	if err != nil {
+		s.log.WithError(err).Errorf("Failed to save %v as the last processed change time", lastCommitted)
+	}
+}
+
+// ForceNotify publishes the concepts with the given uuids and returns the outcome for each of them.
+// If some of the concepts fail, the returned error is ConceptErrors.
+// The concepts are processed by a bounded pool of workers, the same uuid is always processed by the same worker.
+// The concepts which fail to be fetched are retried according to the retry policy by the worker of the concept,
+// so that the retries do not add to the number of concurrent requests to Smartlogic.
+func (s *Service) ForceNotify(UUIDs []string, transactionID string, force bool) ([]ConceptResult, error) {
+	return s.publish(context.Background(), UUIDs, transactionID, nil, force)
+}
+
+// ForceNotifyContext is ForceNotify with the requests to Smartlogic and Kafka traced as part of the given context.
+func (s *Service) ForceNotifyContext(ctx context.Context, UUIDs []string, transactionID string, force bool) ([]ConceptResult, error) {
+	return s.publish(ctx, UUIDs, transactionID, nil, force)
+}
+
+// publish does the work of ForceNotify. The events map holds the latest change of the concepts, if it is known.
+// The concepts which were deleted or merged are not fetched, a delete message is sent for them instead.
+// Every concept is traced in its own span of the given context.
+func (s *Service) publish(ctx context.Context, UUIDs []string, transactionID string, events map[string]smartlogic.ChangeEvent, force bool) ([]ConceptResult, error) {
+	results := make([]ConceptResult, len(UUIDs))
+	errs := make([]error, len(UUIDs))
+
+	var workers sync.WaitGroup
+	for _, shard := range shardByUUID(UUIDs, s.concurrency) {
+		if len(shard) == 0 {
+			continue
+		}
+		workers.Add(1)
+		go func(shard []int) {
+			defer workers.Done()
+			for _, i := range shard {
+				conceptUUID := UUIDs[i]
+				event := events[conceptUUID]
+				ctx, span := s.startConceptSpan(ctx, conceptUUID, transactionID, event)
+				s.uuidLocks.lock(conceptUUID)
+				if event.Type.Removed() {
+					results[i], errs[i] = s.publishDeletion(ctx, conceptUUID, transactionID, event, force)
+					s.uuidLocks.unlock(conceptUUID)
+					endConceptSpan(span, results[i], errs[i])
+					continue
+				}
+				concept, err := s.slClient.GetConceptContext(ctx, conceptUUID)
+				if err != nil && s.retryPolicy.enabled() && retryableConceptError(err) {
+					// the concept is retried by its own worker, so that the requests to Smartlogic keep to the concurrency
+					concept, err = s.retryGetConcept(ctx, conceptUUID, transactionID, err)
+				}
+				results[i], errs[i] = s.publishConcept(ctx, conceptUUID, transactionID, event, force, concept, err)
+				s.uuidLocks.unlock(conceptUUID)
+				endConceptSpan(span, results[i], errs[i])
+			}
+		}(shard)
+	}
+	workers.Wait()
+
+	errorMap := ConceptErrors{}
+	for i, result := range results {
+		if errs[i] != nil {
+			errorMap[result.UUID] = errs[i]
 		}
+		s.recordDeadLetter(result, transactionID)
 	}
 
 	if len(errorMap) > 0 {
-		errorMsg := fmt.Sprintf("There was an error with %d concept ingestions", len(errorMap))
-		s.log.WithField("errorMap", errorMap).Error(errorMsg)
-		return errors.New(errorMsg)
+		s.log.WithField("errorMap", errorMap).Error(errorMap.Error())
+		return results, errorMap
 	}
 	if len(UUIDs) > 0 {
 		s.log.WithField("uuids", UUIDs).Info("Completed notification of concepts")
 	}
+	return results, nil
+}
+
+// retryGetConcept retries getting the concept with the given uuid from Smartlogic after the first attempt failed.
+// It stops when the error is not worth retrying or the context is done, e.g. because the service is stopping.
+func (s *Service) retryGetConcept(ctx context.Context, conceptUUID, transactionID string, err error) ([]byte, error) {
+	for retry := 1; retry < s.retryPolicy.MaxAttempts && retryableConceptError(err); retry++ {
+		backoff := s.retryPolicy.backoff(retry)
+		s.log.WithError(err).
+			WithTransactionID(transactionID).
+			WithField("concept_uuid", conceptUUID).
+			Warnf("Failed to get concept, retrying in %v (attempt %d of %d)", backoff, retry+1, s.retryPolicy.MaxAttempts)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("stopped retrying to get the concept: %w", err)
+		case <-timer.C:
+		}
+
+		var concept []byte
+		concept, err = s.slClient.GetConceptContext(ctx, conceptUUID)
+		if err == nil {
+			return concept, nil
+		}
+	}
+	return nil, err
+}
+
+// retryableConceptError reports whether getting a concept which failed with the given error is worth retrying.
+// Smartlogic rejecting the access token, the concept not existing and an invalid concept are not expected
+// to change by the next attempt.
+func retryableConceptError(err error) bool {
+	return !errors.Is(err, smartlogic.ErrUnauthorized) &&
+		!errors.Is(err, smartlogic.ErrorConceptDoesNotExist) &&
+		!errors.Is(err, smartlogic.ErrInvalidResponse)
+}
+
+// permanentConceptError reports whether publishing a concept failed in a way which retrying it does not change,
+// i.e. the concept does not exist, is not valid json-ld, failed validation or could not be transformed.
+// Smartlogic rejecting the credentials of the service is not permanent, as it is fixed by fixing the credentials.
+func permanentConceptError(err error) bool {
+	var quarantineErr *QuarantineError
+	return errors.As(err, &quarantineErr) ||
+		errors.Is(err, smartlogic.ErrorConceptDoesNotExist) ||
+		errors.Is(err, smartlogic.ErrInvalidResponse) ||
+		errors.Is(err, errTransformFailed)
+}
+
+// publishConcept sends the concept fetched from Smartlogic to Kafka, keyed by its uuid. The fetchErr is the error from getting the concept.
+// The committed time and the type of the change are added to the message if they are known.
+// Unless force is set, the concept is not sent if it is the same as the last one published.
+func (s *Service) publishConcept(ctx context.Context, conceptUUID, transactionID string, event smartlogic.ChangeEvent, force bool, concept []byte, fetchErr error) (ConceptResult, error) {
+	result := ConceptResult{UUID: conceptUUID}
+
+	if fetchErr != nil {
+		result.Status = ConceptSmartlogicError
+		if errors.Is(fetchErr, smartlogic.ErrorConceptDoesNotExist) {
+			result.Status = ConceptNotFound
+		}
+		result.Error = fetchErr.Error()
+		return result, fetchErr
+	}
+
+	if err := validate(s.rules, conceptUUID, concept); err != nil {
+		var quarantineErr *QuarantineError
+		errors.As(err, &quarantineErr)
+		s.quarantine(conceptUUID, transactionID, quarantineErr)
+		result.Status = ConceptQuarantined
+		result.Error = err.Error()
+		result.FailedRules = quarantineErr.rules()
+		return result, err
+	}
+
+	hash := conceptHash(concept)
+	if !force && s.isUnchanged(conceptUUID, hash) {
+		s.log.
+			WithTransactionID(transactionID).
+			WithField("concept_uuid", conceptUUID).
+			Info("Concept did not change since it was last published, skipping it")
+		result.Status = ConceptUnchanged
+		return result, nil
+	}
+
+	transformed, err := s.transformConcept(concept)
+	if err != nil {
+		result.Status = ConceptTransformError
+		result.Error = err.Error()
+		return result, err
+	}
+
+	if err := s.send(ctx, conceptUUID, transactionID, event, concept, transformed, &result); err != nil {
+		result.Status = ConceptKafkaError
+		result.Error = err.Error()
+		return result, err
+	}
+
+	if err := s.hashes.Set(conceptUUID, hash); err != nil {
+		s.log.WithError(err).WithTransactionID(transactionID).WithField("concept_uuid", conceptUUID).Error("Failed to store the hash of the published concept")
+	}
+	result.Status = ConceptPublished
+	return result, nil
+}
+
+// publishDeletion sends a delete message for the concept which was deleted or merged in Smartlogic, keyed by its uuid.
+// The message has no body, its Change-Type header tells what happened to the concept.
+// Unless force is set, the message is not sent if it was already sent since the concept was last published.
+func (s *Service) publishDeletion(ctx context.Context, conceptUUID, transactionID string, event smartlogic.ChangeEvent, force bool) (ConceptResult, error) {
+	result := ConceptResult{UUID: conceptUUID}
+
+	if !force && s.isUnchanged(conceptUUID, deletedHash) {
+		s.log.
+			WithTransactionID(transactionID).
+			WithField("concept_uuid", conceptUUID).
+			Info("Concept was already deleted, skipping it")
+		result.Status = ConceptUnchanged
+		return result, nil
+	}
+
+	if err := s.send(ctx, conceptUUID, transactionID, event, nil, nil, &result); err != nil {
+		result.Status = ConceptKafkaError
+		result.Error = err.Error()
+		return result, err
+	}
+
+	if err := s.hashes.Set(conceptUUID, deletedHash); err != nil {
+		s.log.WithError(err).WithTransactionID(transactionID).WithField("concept_uuid", conceptUUID).Error("Failed to store the hash of the deleted concept")
+	}
+	result.Status = ConceptDeleted
+	return result, nil
+}
+
+// quarantine logs and counts the concept which failed validation. The concept is kept in the dead letters with its
+// quarantined status, so that it can be replayed once it is fixed.
+func (s *Service) quarantine(conceptUUID, transactionID string, err *QuarantineError) {
+	s.log.WithError(err).
+		WithTransactionID(transactionID).
+		WithField("concept_uuid", conceptUUID).
+		WithField("failed_rules", err.rules()).
+		Warn("Concept failed validation, quarantining it")
+
+	metrics.GetOrRegisterCounter(metricName("concepts", s.model, "quarantined"), s.metrics).Inc(1)
+	for _, rule := range err.rules() {
+		metrics.GetOrRegisterCounter(metricName("concepts", s.model, "validation."+rule+".failed"), s.metrics).Inc(1)
+	}
+}
+
+// metricName returns the name of a metric of the given group, which includes the model if there is one,
+// e.g. kafka.FTModel.send.
+func metricName(group, model, name string) string {
+	if model == "" {
+		return group + "." + name
+	}
+	return group + "." + model + "." + name
+}
+
+// transformConcept returns the concept in the UPP concept model, or nothing if the concepts are not transformed.
+func (s *Service) transformConcept(concept []byte) ([]byte, error) {
+	if s.transform == nil {
+		return nil, nil
+	}
+	transformed, err := smartlogic.ParseConcept(concept, s.transform.uris)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errTransformFailed, err)
+	}
+	return json.Marshal(transformed)
+}
+
+// send sends the concept to Kafka and records the transaction id of the message in the result. An empty concept is sent
+// for the concepts which were removed from Smartlogic. If the concepts are transformed, the transformed concept is sent
+// to its own producer as well, with the same transaction id.
+func (s *Service) send(ctx context.Context, conceptUUID, transactionID string, event smartlogic.ChangeEvent, concept, transformed []byte, result *ConceptResult) error {
+	newTransactionID := transactionidutils.NewTransactionID()
+	result.TransactionID = newTransactionID
+	trace.SpanFromContext(ctx).SetAttributes(conceptTransactionIDAttribute.String(newTransactionID))
+
+	entry := s.log.
+		WithTransactionID(transactionID).
+		WithField("concept_transaction_id", newTransactionID).
+		WithField("concept_uuid", conceptUUID)
+	if event.Type != "" {
+		entry = entry.WithField("change_type", event.Type)
+	}
+	entry.Info("Sending message to Kafka")
+	message := kafka.NewFTMessage(s.messageHeaders(newTransactionID, transactionID, event, conceptContentType, concept), string(concept))
+	if err := s.sendMessage(ctx, s.producer, "send", conceptUUID, message); err != nil {
+		return err
+	}
+
+	if s.transform == nil {
+		return nil
+	}
+	message = kafka.NewFTMessage(s.messageHeaders(newTransactionID, transactionID, event, uppConceptContentType, transformed), string(transformed))
+	if err := s.sendMessage(ctx, s.transform.producer, "uppConcept.send", conceptUUID, message); err != nil {
+		return fmt.Errorf("failed to send the transformed concept: %w", err)
+	}
 	return nil
 }
 
+// sendMessage sends the message with the given producer, timing it and counting the failures under the given metric name.
+// The message is sent in its own span, the context of which is added to the headers of the message,
+// so that the trace is continued by the consumers.
+func (s *Service) sendMessage(ctx context.Context, producer messageProducer, metric, key string, message kafka.FTMessage) error {
+	ctx, span := s.tracer.Start(ctx, "kafka.SendMessage", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		messagingSystemAttribute.String("kafka"),
+		messagingKeyAttribute.String(key),
+		conceptTransactionIDAttribute.String(message.Headers[transactionidutils.TransactionIDHeader]),
+	))
+	traceContext.Inject(ctx, propagation.MapCarrier(message.Headers))
+
+	start := time.Now()
+	err := producer.SendMessage(key, message)
+	metrics.GetOrRegisterTimer(metricName("kafka", s.model, metric), s.metrics).UpdateSince(start)
+	if err != nil {
+		metrics.GetOrRegisterCounter(metricName("kafka", s.model, metric+".failures"), s.metrics).Inc(1)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// startConceptSpan starts the span of publishing the concept with the given uuid.
+func (s *Service) startConceptSpan(ctx context.Context, conceptUUID, transactionID string, event smartlogic.ChangeEvent) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		modelAttribute.String(s.model),
+		conceptUUIDAttribute.String(conceptUUID),
+		transactionIDAttribute.String(transactionID),
+	}
+	if event.Type != "" {
+		attrs = append(attrs, changeTypeAttribute.String(string(event.Type)))
+	}
+	return s.tracer.Start(ctx, "notifier.PublishConcept", trace.WithAttributes(attrs...))
+}
+
+// endConceptSpan ends the span of publishing a concept with its outcome.
+func endConceptSpan(span trace.Span, result ConceptResult, err error) {
+	span.SetAttributes(conceptStatusAttribute.String(string(result.Status)))
+	endSpan(span, err)
+}
+
+// messageHeaders returns the headers of a message with the given body. The committed time and the type of the change
+// are added if they are known, the content type is added unless the body is empty.
+func (s *Service) messageHeaders(conceptTransactionID, transactionID string, event smartlogic.ChangeEvent, contentType string, body []byte) map[string]string {
+	headers := map[string]string{
+		transactionidutils.TransactionIDHeader: conceptTransactionID,
+		originSystemIDHeader:                   smartlogicOriginSystemID,
+		messageTimestampHeader:                 time.Now().UTC().Format(messageTimestampFormat),
+	}
+	if len(body) > 0 {
+		headers[contentTypeHeader] = contentType
+	}
+	if s.model != "" {
+		headers[smartlogicModelHeader] = s.model
+	}
+	if !event.Committed.IsZero() {
+		headers[changeCommittedHeader] = event.Committed.UTC().Format(messageTimestampFormat)
+	}
+	if event.Type != "" {
+		headers[changeTypeHeader] = string(event.Type)
+	}
+	if event.MergedInto != "" {
+		headers[mergedIntoHeader] = event.MergedInto
+	}
+	if transactionID != "" {
+		headers[parentTransactionIDHeader] = transactionID
+	}
+	return headers
+}
+
+// isUnchanged tells whether the concept with the given hash is the same as the one which was last published.
+func (s *Service) isUnchanged(conceptUUID, hash string) bool {
+	previous, ok, err := s.hashes.Get(conceptUUID)
+	if err != nil {
+		s.log.WithError(err).WithField("concept_uuid", conceptUUID).Error("Failed to get the hash of the last published concept")
+		return false
+	}
+	return ok && previous == hash
+}
+
+// recordDeadLetter keeps the failed concepts in the dead letter store and removes the ones which were published.
+func (s *Service) recordDeadLetter(result ConceptResult, transactionID string) {
+	var err error
+	if result.Status.succeeded() {
+		err = s.deadLetters.Remove(result.UUID)
+	} else {
+		err = s.deadLetters.Add(DeadLetter{
+			UUID:          result.UUID,
+			Status:        result.Status,
+			Error:         result.Error,
+			TransactionID: transactionID,
+			LastFailedAt:  time.Now(),
+		})
+	}
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transactionID).WithField("concept_uuid", result.UUID).Error("Failed to update the dead letters")
+	}
+}
+
+// DeadLetters returns the concepts which failed to be published.
+func (s *Service) DeadLetters() ([]DeadLetter, error) {
+	return s.deadLetters.List()
+}
+
+// ReplayDeadLetters tries to publish again the dead letters with the given uuids, or all of them if no uuids are given.
+// The uuids which are not dead letters are ignored.
+func (s *Service) ReplayDeadLetters(UUIDs []string, transactionID string) ([]ConceptResult, error) {
+	letters, err := s.deadLetters.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the dead letters: %w", err)
+	}
+
+	requested := map[string]bool{}
+	for _, uuid := range UUIDs {
+		requested[uuid] = true
+	}
+
+	var replay []string
+	for _, d := range letters {
+		if len(UUIDs) == 0 || requested[d.UUID] {
+			replay = append(replay, d.UUID)
+		}
+	}
+	if len(replay) == 0 {
+		return []ConceptResult{}, nil
+	}
+
+	s.log.WithTransactionID(transactionID).WithField("uuids", replay).Infof("Replaying %d dead letters", len(replay))
+	return s.ForceNotify(replay, transactionID, false)
+}
+
 func (s *Service) CheckKafkaConnectivity() error {
-	return s.producer.ConnectivityCheck()
+	if err := s.producer.ConnectivityCheck(); err != nil {
+		return err
+	}
+	if s.transform != nil {
+		return s.transform.producer.ConnectivityCheck()
+	}
+	return nil
 }
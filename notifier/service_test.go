@@ -1,11 +1,23 @@
 package notifier
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewNotifierService(t *testing.T) {
@@ -49,7 +61,7 @@ func TestService_Notify(t *testing.T) {
 
 	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
 
-	err := service.Notify(time.Now(), "transactionID")
+	err := service.Notify(time.Now(), "transactionID", nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, kc.sentCount)
@@ -75,7 +87,7 @@ func TestService_RetryNotify(t *testing.T) {
 
 	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
 
-	err := service.Notify(time.Now(), "transactionID")
+	err := service.Notify(time.Now(), "transactionID", nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, kc.sentCount)
@@ -95,8 +107,773 @@ func TestService_ForceNotify(t *testing.T) {
 
 	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
 
-	err := service.ForceNotify([]string{"uuid1"}, "transactionID")
+	results, err := service.ForceNotify([]string{"uuid1"}, "transactionID", false)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, kc.sentCount)
+	assert.Len(t, results, 1)
+	assert.Equal(t, ConceptPublished, results[0].Status)
+	assert.NotEmpty(t, results[0].TransactionID)
+}
+
+func TestService_ForceNotifyResults(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+		},
+	}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
+
+	results, err := service.ForceNotify([]string{"uuid1", "uuid2"}, "transactionID", false)
+
+	var conceptErrors ConceptErrors
+	assert.ErrorAs(t, err, &conceptErrors)
+	assert.Contains(t, conceptErrors, "uuid2")
+	assert.Equal(t, 1, kc.getSentCount())
+	assert.Len(t, results, 2)
+	assert.Equal(t, "uuid1", results[0].UUID)
+	assert.Equal(t, ConceptPublished, results[0].Status)
+	assert.Equal(t, "uuid2", results[1].UUID)
+	assert.Equal(t, ConceptSmartlogicError, results[1].Status)
+	assert.Empty(t, results[1].TransactionID)
+	assert.Equal(t, "can't find concept", results[1].Error)
+}
+
+func TestService_NotifyAdvancesCheckpoint(t *testing.T) {
+	lastCommitted := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+		},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"uuid1"}, nil
+		},
+		lastCommitted: lastCommitted,
+	}
+	checkpoint := &memoryCheckpoint{}
+	checkpoint.lastCommitted = lastCommitted.Add(-time.Hour)
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint))
+
+	err := service.Notify(checkpoint.lastCommitted, "transactionID", nil)
+	assert.NoError(t, err)
+
+	stored, err := checkpoint.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, lastCommitted, stored)
+}
+
+func TestService_NotifyDoesNotMoveCheckpointBackwards(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+		},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"uuid1"}, nil
+		},
+		lastCommitted: time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC),
+	}
+	later := time.Date(2020, 4, 5, 11, 0, 0, 0, time.UTC)
+	checkpoint := &memoryCheckpoint{lastCommitted: later}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint))
+
+	err := service.Notify(time.Now(), "transactionID", nil)
+	assert.NoError(t, err)
+
+	stored, err := checkpoint.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, later, stored)
+}
+
+func TestService_NotifyDoesNotSkipFailedChanges(t *testing.T) {
+	checkpointed := time.Date(2020, 4, 5, 9, 0, 0, 0, time.UTC)
+	later := checkpointed.Add(time.Hour)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+		},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			if changeDate.Equal(checkpointed) {
+				return nil, smartlogic.ErrUnavailable
+			}
+			return []string{"uuid1"}, nil
+		},
+		lastCommitted: later.Add(time.Minute),
+	}
+	checkpoint := &memoryCheckpoint{lastCommitted: checkpointed}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint))
+
+	// the changes since the checkpoint fail, the later ones are published
+	err := service.Notify(checkpointed, "transactionID1", nil)
+	assert.Error(t, err)
+	err = service.Notify(later, "transactionID2", nil)
+	assert.NoError(t, err)
+
+	// so the failed changes are still caught up
+	stored, err := checkpoint.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, checkpointed, stored)
+}
+
+func TestService_CatchUp(t *testing.T) {
+	since := time.Now().Add(-30 * 24 * time.Hour)
+	lastCommitted := time.Now().Add(-time.Hour)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+			"uuid2": "concept2",
+		},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			assert.Equal(t, since, changeDate)
+			return []string{"uuid1", "uuid2"}, nil
+		},
+		lastCommitted: lastCommitted,
+	}
+	checkpoint := &memoryCheckpoint{lastCommitted: since}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint))
+
+	err := service.CatchUp("transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, kc.getSentCount())
+
+	stored, err := checkpoint.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, lastCommitted, stored)
+}
+
+func TestService_CatchUpAdvancesPastPermanentFailures(t *testing.T) {
+	since := time.Now().Add(-30 * 24 * time.Hour)
+	lastCommitted := time.Now().Add(-time.Hour)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getConceptFunc: func(uuid string) ([]byte, error) {
+			switch uuid {
+			case "uuid1":
+				return nil, smartlogic.ErrorConceptDoesNotExist
+			case "uuid2":
+				return nil, smartlogic.ErrUnavailable
+			}
+			return []byte("concept"), nil
+		},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"uuid1", "uuid3"}, nil
+		},
+		lastCommitted: lastCommitted,
+	}
+	checkpoint := &memoryCheckpoint{lastCommitted: since}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint))
+
+	// the concept which does not exist is dead lettered and does not hold back the checkpoint
+	err := service.CatchUp("transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, kc.getSentCount())
+	stored, err := checkpoint.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, lastCommitted, stored)
+
+	letters, err := service.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, "uuid1", letters[0].UUID)
+	assert.Equal(t, ConceptNotFound, letters[0].Status)
+
+	// a concept which failed because Smartlogic is down holds the checkpoint back
+	sl.lastCommitted = lastCommitted.Add(time.Minute)
+	sl.getChangedConceptListFunc = func(changeDate time.Time) ([]string, error) {
+		return []string{"uuid2", "uuid3"}, nil
+	}
+	err = service.CatchUp("transactionID")
+	assert.Error(t, err)
+	stored, err = checkpoint.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, lastCommitted, stored)
+}
+
+func TestPermanentConceptError(t *testing.T) {
+	assert.True(t, permanentConceptError(fmt.Errorf("getting concept: %w", smartlogic.ErrorConceptDoesNotExist)))
+	assert.True(t, permanentConceptError(smartlogic.ErrInvalidResponse))
+	assert.True(t, permanentConceptError(&QuarantineError{}))
+	assert.True(t, permanentConceptError(fmt.Errorf("%w: %w", errTransformFailed, errors.New("no prefLabel"))))
+	assert.False(t, permanentConceptError(smartlogic.ErrUnavailable))
+	assert.False(t, permanentConceptError(smartlogic.ErrUnauthorized))
+	assert.False(t, permanentConceptError(errors.New("kafka is down")))
+}
+
+func TestService_NotifyStreamsPages(t *testing.T) {
+	firstCommitted := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	lastCommitted := firstCommitted.Add(time.Minute)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+			"uuid2": "concept2",
+			"uuid3": "concept3",
+		},
+		changePages: []smartlogic.ConceptChanges{
+			{UUIDs: []string{"uuid1", "uuid2"}, LastCommitted: firstCommitted},
+			{UUIDs: []string{"uuid2", "uuid3"}, LastCommitted: lastCommitted},
+		},
+	}
+	checkpoint := &memoryCheckpoint{}
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint))
+
+	var published [][]string
+	err := service.Notify(time.Now(), "transactionID", func(status JobStatus, uuids []string) {
+		if status == JobPublishing {
+			published = append(published, uuids)
+		}
+	})
+	require.NoError(t, err)
+
+	// a concept changed in several pages is published once
+	assert.Equal(t, 3, kc.getSentCount())
+	assert.Equal(t, [][]string{{"uuid1", "uuid2"}, {"uuid1", "uuid2", "uuid3"}}, published)
+
+	stored, err := checkpoint.Load()
+	require.NoError(t, err)
+	assert.Equal(t, lastCommitted, stored)
+}
+
+func TestService_NotifyPageFailure(t *testing.T) {
+	committed := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{"uuid1": "concept1", "uuid3": "concept3"},
+		changePages: []smartlogic.ConceptChanges{
+			{UUIDs: []string{"uuid1", "uuid2"}, LastCommitted: committed},
+			{UUIDs: []string{"uuid3"}, LastCommitted: committed},
+		},
+	}
+	checkpoint := &memoryCheckpoint{}
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+
+	err := service.Notify(time.Now(), "transactionID", nil)
+
+	// the failure of a concept does not stop the following pages, but the checkpoint is not advanced
+	var conceptErrors ConceptErrors
+	require.ErrorAs(t, err, &conceptErrors)
+	assert.Contains(t, conceptErrors, "uuid2")
+	assert.Equal(t, 2, kc.getSentCount())
+	stored, err := checkpoint.Load()
+	require.NoError(t, err)
+	assert.True(t, stored.IsZero())
+}
+
+func TestService_CatchUpWithoutCheckpoint(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
+
+	err := service.CatchUp("transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sl.getChangedConceptListCallCount())
+	assert.Equal(t, 0, kc.getSentCount())
+}
+
+func TestService_DeadLetters(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+		},
+	}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
+
+	_, err := service.ForceNotify([]string{"uuid1", "uuid2", "uuid3"}, "tid_original", false)
+	assert.Error(t, err)
+
+	letters, err := service.DeadLetters()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 2)
+	for _, d := range letters {
+		assert.Equal(t, "tid_original", d.TransactionID)
+		assert.Equal(t, ConceptSmartlogicError, d.Status)
+		assert.Equal(t, 1, d.Attempts)
+	}
+
+	// uuid2 becomes available in Smartlogic, uuid3 still fails
+	sl.concepts["uuid2"] = "concept2"
+	results, err := service.ReplayDeadLetters(nil, "tid_replay")
+	assert.Error(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, 2, kc.getSentCount())
+
+	letters, err = service.DeadLetters()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "uuid3", letters[0].UUID)
+	assert.Equal(t, "tid_replay", letters[0].TransactionID)
+	assert.Equal(t, 2, letters[0].Attempts)
+
+	results, err = service.ReplayDeadLetters([]string{"uuid1"}, "tid_replay")
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestService_ForceNotifyRetriesFailedConcepts(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getConceptFunc: func(uuid string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[uuid]++
+			switch {
+			case uuid == "uuid1" && attempts[uuid] < 3:
+				return nil, &smartlogic.Error{Kind: smartlogic.KindUpstream, StatusCode: http.StatusBadGateway}
+			case uuid == "uuid3":
+				return nil, errors.New("smartlogic returned status 500")
+			case uuid == "uuid4":
+				return nil, smartlogic.ErrorConceptDoesNotExist
+			case uuid == "uuid5":
+				return nil, &smartlogic.Error{Kind: smartlogic.KindUnauthorized, StatusCode: http.StatusUnauthorized}
+			}
+			return []byte("concept-" + uuid), nil
+		},
+	}
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: 20 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithRetryPolicy(policy))
+
+	results, err := service.ForceNotify([]string{"uuid1", "uuid2", "uuid3", "uuid4", "uuid5"}, "transactionID", false)
+	assert.Error(t, err)
+	assert.Equal(t, ConceptPublished, results[0].Status)
+	assert.Equal(t, ConceptPublished, results[1].Status)
+	assert.Equal(t, ConceptSmartlogicError, results[2].Status)
+	assert.Equal(t, ConceptNotFound, results[3].Status)
+	assert.Equal(t, ConceptSmartlogicError, results[4].Status)
+	// the concepts which do not exist or are not authorized are not retried
+	assert.Equal(t, map[string]int{"uuid1": 3, "uuid2": 1, "uuid3": 3, "uuid4": 1, "uuid5": 1}, attempts)
+
+	// the concepts are retried by their worker, so with a single worker they are published in order
+	messages := kc.getMessages()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "concept-uuid1", messages[0].Body)
+	assert.Equal(t, "concept-uuid2", messages[1].Body)
+}
+
+func TestService_RetriesKeepToTheConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getConceptFunc: func(uuid string) ([]byte, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return nil, smartlogic.ErrUpstream
+		},
+	}
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithRetryPolicy(policy), WithConcurrency(2))
+
+	var uuids []string
+	for i := 0; i < 20; i++ {
+		uuids = append(uuids, fmt.Sprintf("uuid%d", i))
+	}
+	_, err := service.ForceNotify(uuids, "transactionID", false)
+	assert.Error(t, err)
+	assert.LessOrEqual(t, maxInFlight, 2)
+	assert.Empty(t, kc.getMessages())
+}
+
+func TestService_RetriesStopWithTheContext(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getConceptFunc: func(uuid string) ([]byte, error) {
+			return nil, smartlogic.ErrUpstream
+		},
+	}
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithRetryPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results, err := service.ForceNotifyContext(ctx, []string{"uuid1"}, "transactionID", false)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, results, 1)
+	assert.Equal(t, ConceptSmartlogicError, results[0].Status)
+	assert.ErrorIs(t, err.(ConceptErrors)["uuid1"], smartlogic.ErrUpstream)
+}
+
+func TestService_NotifyStopsWaitingForChangesWithTheContext(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{}, nil
+		},
+	}
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := service.NotifyContext(ctx, time.Now(), "transactionID", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), changesRetryDelay/2)
+	assert.Equal(t, 1, sl.getChangedConceptListCallCount())
+}
+
+func TestService_MessageKeysAndHeaders(t *testing.T) {
+	committed := time.Date(2020, 4, 5, 10, 0, 0, 990000000, time.UTC)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+		},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"uuid1"}, nil
+		},
+		lastCommitted: committed,
+	}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithSmartlogicModel("modelName"))
+
+	err := service.Notify(time.Now(), "tid_parent", nil)
+	require.NoError(t, err)
+	_, err = service.ForceNotify([]string{"uuid1"}, "tid_force", true)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"uuid1", "uuid1"}, kc.getKeys())
+	messages := kc.getMessages()
+	require.Len(t, messages, 2)
+	for _, m := range messages {
+		assert.NotEmpty(t, m.Headers["X-Request-Id"])
+		assert.Equal(t, "http://cmdb.ft.com/systems/smartlogic", m.Headers["Origin-System-Id"])
+		assert.Equal(t, "modelName", m.Headers["Smartlogic-Model"])
+		assert.Equal(t, "application/ld+json", m.Headers["Content-Type"])
+		_, err = time.Parse(messageTimestampFormat, m.Headers["Message-Timestamp"])
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, "tid_parent", messages[0].Headers["Parent-Transaction-Id"])
+	assert.Equal(t, "2020-04-05T10:00:00.990Z", messages[0].Headers["Change-Committed"])
+	assert.Equal(t, "modified", messages[0].Headers["Change-Type"])
+
+	// the change is not known for the concepts which are force notified
+	assert.Equal(t, "tid_force", messages[1].Headers["Parent-Transaction-Id"])
+	assert.NotContains(t, messages[1].Headers, "Change-Committed")
+	assert.NotContains(t, messages[1].Headers, "Change-Type")
+}
+
+func TestService_NotifyDeletedConcepts(t *testing.T) {
+	committed := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	kc := &mockKafkaClient{}
+	var fetched []string
+	sl := &mockSmartlogicClient{
+		getConceptFunc: func(uuid string) ([]byte, error) {
+			fetched = append(fetched, uuid)
+			return []byte("concept " + uuid), nil
+		},
+		changePages: []smartlogic.ConceptChanges{
+			{
+				UUIDs:         []string{"deleted", "merged", "target", "recreated"},
+				LastCommitted: committed.Add(time.Minute),
+				Events: []smartlogic.ChangeEvent{
+					{UUID: "recreated", Type: smartlogic.ChangeDeleted, Committed: committed},
+					{UUID: "deleted", Type: smartlogic.ChangeDeleted, Committed: committed},
+					{UUID: "merged", Type: smartlogic.ChangeMerged, Committed: committed, MergedInto: "target"},
+					{UUID: "target", Type: smartlogic.ChangeModified, Committed: committed},
+					{UUID: "recreated", Type: smartlogic.ChangeCreated, Committed: committed.Add(time.Minute)},
+				},
+			},
+		},
+	}
+	checkpoint := &memoryCheckpoint{}
+	deadLetters := newMemoryDeadLetterStore()
+	require.NoError(t, deadLetters.Add(DeadLetter{UUID: "deleted", Status: ConceptNotFound}))
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithCheckpoint(checkpoint), WithDeadLetters(deadLetters))
+
+	err := service.Notify(time.Now(), "tid_test", nil)
+	require.NoError(t, err)
+
+	// the removed concepts are not fetched from Smartlogic
+	sort.Strings(fetched)
+	assert.Equal(t, []string{"recreated", "target"}, fetched)
+
+	messages := map[string]kafka.FTMessage{}
+	for i, key := range kc.getKeys() {
+		messages[key] = kc.getMessages()[i]
+	}
+	require.Len(t, messages, 4)
+	assert.Equal(t, "deleted", messages["deleted"].Headers["Change-Type"])
+	assert.Empty(t, messages["deleted"].Body)
+	assert.NotContains(t, messages["deleted"].Headers, "Content-Type")
+	assert.Equal(t, "merged", messages["merged"].Headers["Change-Type"])
+	assert.Equal(t, "target", messages["merged"].Headers["Merged-Into-Uuid"])
+	assert.Empty(t, messages["merged"].Body)
+	assert.Equal(t, "modified", messages["target"].Headers["Change-Type"])
+	assert.Equal(t, "concept target", messages["target"].Body)
+	assert.Equal(t, "created", messages["recreated"].Headers["Change-Type"])
+
+	letters, err := deadLetters.List()
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+	lastCommitted, err := checkpoint.Load()
+	require.NoError(t, err)
+	assert.Equal(t, committed.Add(time.Minute), lastCommitted)
+
+	// the delete message is not sent again, unless forced
+	results, err := service.publish(context.Background(), []string{"deleted"}, "tid_again", map[string]smartlogic.ChangeEvent{"deleted": {UUID: "deleted", Type: smartlogic.ChangeDeleted}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, ConceptUnchanged, results[0].Status)
+	results, err = service.publish(context.Background(), []string{"deleted"}, "tid_force", map[string]smartlogic.ChangeEvent{"deleted": {UUID: "deleted", Type: smartlogic.ChangeDeleted}}, true)
+	require.NoError(t, err)
+	assert.Equal(t, ConceptDeleted, results[0].Status)
+	assert.Len(t, kc.getMessages(), 5)
+}
+
+func TestService_SkipsUnchangedConcepts(t *testing.T) {
+	concepts := map[string]string{
+		"uuid1": `{"@graph":[{"@id":"1","skosxl:altLabel":[{"@value":"a"},{"@value":"b"}]}]}`,
+		"uuid2": `{"@graph":[{"@id":"2"}]}`,
+	}
+	var mu sync.Mutex
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getConceptFunc: func(uuid string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return []byte(concepts[uuid]), nil
+		},
+	}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger())
+
+	results, err := service.ForceNotify([]string{"uuid1", "uuid2"}, "tid_first", false)
+	require.NoError(t, err)
+	assert.Equal(t, ConceptPublished, results[0].Status)
+	assert.Equal(t, ConceptPublished, results[1].Status)
+
+	mu.Lock()
+	// semantically identical: different formatting and order of the values
+	concepts["uuid1"] = `{"@graph": [{"skosxl:altLabel": [{"@value": "b"}, {"@value": "a"}], "@id": "1"}]}`
+	concepts["uuid2"] = `{"@graph":[{"@id":"2","skosxl:prefLabel":[{"@value":"new"}]}]}`
+	mu.Unlock()
+
+	results, err = service.ForceNotify([]string{"uuid1", "uuid2"}, "tid_second", false)
+	require.NoError(t, err)
+	assert.Equal(t, ConceptUnchanged, results[0].Status)
+	assert.Empty(t, results[0].TransactionID)
+	assert.Equal(t, ConceptPublished, results[1].Status)
+	assert.Equal(t, 3, kc.getSentCount())
+
+	results, err = service.ForceNotify([]string{"uuid1"}, "tid_forced", true)
+	require.NoError(t, err)
+	assert.Equal(t, ConceptPublished, results[0].Status)
+	assert.Equal(t, 4, kc.getSentCount())
+
+	letters, err := service.DeadLetters()
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestService_ForceNotifyConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	inFlight, maxInFlight := 0, 0
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getConceptFunc: func(uuid string) ([]byte, error) {
+			mu.Lock()
+			calls[uuid]++
+			call := calls[uuid]
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return []byte(fmt.Sprintf("%s:%d", uuid, call)), nil
+		},
+	}
+
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithConcurrency(4))
+
+	var uuids []string
+	for i := 0; i < 20; i++ {
+		uuids = append(uuids, fmt.Sprintf("uuid%d", i%5))
+	}
+	results, err := service.ForceNotify(uuids, "transactionID", false)
+	assert.NoError(t, err)
+	assert.Len(t, results, 20)
+	for i, r := range results {
+		assert.Equal(t, uuids[i], r.UUID)
+		assert.Equal(t, ConceptPublished, r.Status)
+	}
+	assert.Greater(t, maxInFlight, 1)
+
+	// the messages of every concept are sent in the order the concept was fetched
+	lastCall := map[string]int{}
+	for _, m := range kc.getMessages() {
+		var uuid string
+		var call int
+		_, err := fmt.Sscanf(strings.Replace(m.Body, ":", " ", 1), "%s %d", &uuid, &call)
+		assert.NoError(t, err)
+		assert.Greater(t, call, lastCall[uuid])
+		lastCall[uuid] = call
+	}
+}
+
+func TestService_ConceptTransform(t *testing.T) {
+	brand, err := ioutil.ReadFile("../smartlogic/testdata/get-concept.json")
+	require.NoError(t, err)
+	kc := &mockKafkaClient{}
+	transformed := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"brand":   string(brand),
+			"invalid": `{"@graph": [{"@id": "http://www.ft.com/thing/invalid"}]}`,
+		},
+	}
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithConceptTransform(transformed, nil))
+
+	results, err := service.ForceNotify([]string{"brand", "invalid"}, "tid_test", false)
+	var conceptErrors ConceptErrors
+	require.ErrorAs(t, err, &conceptErrors)
+	assert.Contains(t, conceptErrors, "invalid")
+	assert.Equal(t, ConceptPublished, results[0].Status)
+	assert.Equal(t, ConceptTransformError, results[1].Status)
+
+	// the concepts which cannot be transformed are not sent at all
+	require.Len(t, kc.getMessages(), 1)
+	require.Len(t, transformed.getMessages(), 1)
+	raw, upp := kc.getMessages()[0], transformed.getMessages()[0]
+	assert.Equal(t, []string{"brand"}, transformed.getKeys())
+	assert.Equal(t, string(brand), raw.Body)
+	assert.Equal(t, "application/vnd.ft-upp-concept+json", upp.Headers["Content-Type"])
+	assert.Equal(t, raw.Headers["X-Request-Id"], upp.Headers["X-Request-Id"])
+	assert.JSONEq(t, `{
+		"uuid": "2d3e16e0-61cb-4322-8aff-3b01c59f4daa",
+		"type": "Brand",
+		"prefLabel": "Lex",
+		"identifiers": {"TMEIdentifier": ["YzhlNzZkYTctMDJiNy00NTViLTk3NmYtNmJjYTE5NDEyM2Yw-QnJhbmRz"]}
+	}`, upp.Body)
+
+	// the delete messages are sent to both producers
+	results, err = service.publish(context.Background(), []string{"brand"}, "tid_delete", map[string]smartlogic.ChangeEvent{"brand": {UUID: "brand", Type: smartlogic.ChangeDeleted}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, ConceptDeleted, results[0].Status)
+	require.Len(t, transformed.getMessages(), 2)
+	assert.Empty(t, transformed.getMessages()[1].Body)
+	assert.Equal(t, "deleted", transformed.getMessages()[1].Headers["Change-Type"])
+}
+
+func TestService_QuarantinesInvalidConcepts(t *testing.T) {
+	committed := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"valid": `{"@graph": [{"@id": "http://www.ft.com/thing/valid", "@type": ["http://www.ft.com/ontology/Topic"],
+				"skosxl:prefLabel": [{"skosxl:literalForm": [{"@value": "Valid"}]}]}]}`,
+			"invalid": `{"@graph": [{"@id": "http://www.ft.com/thing/other", "@type": ["http://www.ft.com/ontology/Topic"]}]}`,
+		},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"valid", "invalid"}, nil
+		},
+		lastCommitted: committed,
+	}
+	rules, err := NewValidationRules([]string{PrefLabelRule, TypeRule, URIRule}, nil)
+	require.NoError(t, err)
+	registry := metrics.NewRegistry()
+	checkpoint := &memoryCheckpoint{}
+	deadLetters := newMemoryDeadLetterStore()
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(),
+		WithSmartlogicModel("modelName"),
+		WithValidationRules(rules...),
+		WithMetrics(registry),
+		WithCheckpoint(checkpoint),
+		WithDeadLetters(deadLetters),
+	)
+
+	results, err := service.ForceNotify([]string{"valid", "invalid"}, "tid_test", false)
+	var conceptErrors ConceptErrors
+	require.ErrorAs(t, err, &conceptErrors)
+	assert.Contains(t, conceptErrors, "invalid")
+	assert.Equal(t, ConceptPublished, results[0].Status)
+	assert.Equal(t, ConceptQuarantined, results[1].Status)
+	assert.Equal(t, []string{PrefLabelRule, URIRule}, results[1].FailedRules)
+	assert.Equal(t, []string{"valid"}, kc.getKeys())
+
+	letters, err := deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, ConceptQuarantined, letters[0].Status)
+
+	// the quarantined concepts do not hold back the checkpoint
+	err = service.Notify(time.Now(), "tid_notify", nil)
+	require.NoError(t, err)
+	lastCommitted, err := checkpoint.Load()
+	require.NoError(t, err)
+	assert.Equal(t, committed, lastCommitted)
+
+	assert.Equal(t, int64(2), registry.Get("concepts.modelName.quarantined").(metrics.Counter).Count())
+	assert.Equal(t, int64(2), registry.Get("concepts.modelName.validation.prefLabel.failed").(metrics.Counter).Count())
+	assert.Equal(t, int64(2), registry.Get("concepts.modelName.validation.uri.failed").(metrics.Counter).Count())
+	assert.Nil(t, registry.Get("concepts.modelName.validation.type.failed"))
+}
+
+type failingProducer struct {
+	*mockKafkaClient
+}
+
+func (p failingProducer) SendMessage(string, kafka.FTMessage) error {
+	return errors.New("kafka is down")
+}
+
+func TestService_Metrics(t *testing.T) {
+	brand, err := ioutil.ReadFile("../smartlogic/testdata/get-concept.json")
+	require.NoError(t, err)
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{"brand": string(brand)},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"brand"}, nil
+		},
+	}
+	registry := metrics.NewRegistry()
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(),
+		WithSmartlogicModel("modelName"),
+		WithConceptTransform(failingProducer{&mockKafkaClient{}}, nil),
+		WithMetrics(registry),
+	)
+
+	err = service.Notify(time.Now(), "tid_test", nil)
+	var conceptErrors ConceptErrors
+	require.ErrorAs(t, err, &conceptErrors)
+
+	changes := registry.Get("notify.modelName.changes").(metrics.Histogram)
+	assert.Equal(t, int64(1), changes.Count())
+	assert.Equal(t, int64(1), changes.Max())
+	assert.Equal(t, int64(1), registry.Get("kafka.modelName.send").(metrics.Timer).Count())
+	assert.Nil(t, registry.Get("kafka.modelName.send.failures"))
+	assert.Equal(t, int64(1), registry.Get("kafka.modelName.uppConcept.send").(metrics.Timer).Count())
+	assert.Equal(t, int64(1), registry.Get("kafka.modelName.uppConcept.send.failures").(metrics.Counter).Count())
 }
@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Financial-Times/smartlogic-notifier/notifier"
+
+// The attributes of the spans, the transaction ids are the ones in the logs, so that the traces and the logs can be matched.
+const (
+	modelAttribute                = attribute.Key("smartlogic.model")
+	transactionIDAttribute        = attribute.Key("transaction_id")
+	conceptTransactionIDAttribute = attribute.Key("concept_transaction_id")
+	conceptUUIDAttribute          = attribute.Key("concept.uuid")
+	conceptStatusAttribute        = attribute.Key("concept.status")
+	changeTypeAttribute           = attribute.Key("concept.change_type")
+	notifySinceAttribute          = attribute.Key("notify.since")
+	notificationsAttribute        = attribute.Key("notify.notifications")
+	httpMethodAttribute           = attribute.Key("http.request.method")
+	httpRouteAttribute            = attribute.Key("http.route")
+	httpStatusAttribute           = attribute.Key("http.response.status_code")
+	messagingSystemAttribute      = attribute.Key("messaging.system")
+	messagingKeyAttribute         = attribute.Key("messaging.kafka.message.key")
+)
+
+// traceContext is how the trace context is propagated to the requests, the notifications in the queue and the Kafka messages,
+// i.e. in the W3C traceparent and tracestate headers.
+var traceContext = propagation.TraceContext{}
+
+// WithTracerProvider sets the provider of the tracer of the published concepts, instead of the global one.
+func WithTracerProvider(tp trace.TracerProvider) func(*Service) {
+	return func(s *Service) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithHandlerTracerProvider sets the provider of the tracer of the processed notifications, instead of the global one.
+func WithHandlerTracerProvider(tp trace.TracerProvider) func(*Handler) {
+	return func(h *Handler) {
+		h.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// endSpan ends the span, recording the error if there is one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceParent returns the trace context of the given context in the traceparent format, so that it can be stored.
+func traceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// spanContextOf returns the span context stored with traceParent, it is not valid if there is none.
+func spanContextOf(traceparent string) trace.SpanContext {
+	ctx := traceContext.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// statusRecorder keeps the status of the response, for the span of the request.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// traceRequests starts a server span for every request to the given route, continuing the trace of the caller if it sent one.
+func traceRequests(tracer trace.Tracer, route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		ctx := traceContext.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				httpMethodAttribute.String(req.Method),
+				httpRouteAttribute.String(route),
+			),
+		)
+		defer span.End()
+		if tid := req.Header.Get(transactionidutils.TransactionIDHeader); tid != "" {
+			span.SetAttributes(transactionIDAttribute.String(tid))
+		}
+
+		recorder := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		next.ServeHTTP(recorder, req.WithContext(ctx))
+		span.SetAttributes(httpStatusAttribute.Int(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const incomingTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func spansByName(spans []sdktrace.ReadOnlySpan) map[string][]sdktrace.ReadOnlySpan {
+	byName := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range spans {
+		byName[span.Name()] = append(byName[span.Name()], span)
+	}
+	return byName
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracing_NotifyToKafka(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{"uuid1": "concept1"},
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"uuid1"}, nil
+		},
+	}
+	service := NewNotifierService(kc, sl, logger.NewUnstructuredLogger(), WithSmartlogicModel(smartlogicModel), WithTracerProvider(tp))
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(service, smartlogicModel, logger.NewUnstructuredLogger(), WithTicker(tk), WithHandlerTracerProvider(tp))
+	router := NewModelRouter(handler)
+	router.tracer = tp.Tracer(tracerName)
+	m := mux.NewRouter()
+	router.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=%s&modifiedGraphId=%s&lastChangeDate=%s", smartlogicModel, smartlogicModel, time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("X-Request-Id", "tid_traced")
+	req.Header.Set("traceparent", incomingTraceParent)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	require.Eventually(t, func() bool {
+		return len(spansByName(recorder.Ended())["notifier.Notify"]) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	spans := spansByName(recorder.Ended())
+	require.Len(t, spans["GET /notify"], 1)
+	require.Len(t, spans["notifier.PublishConcept"], 1)
+	require.Len(t, spans["kafka.SendMessage"], 1)
+	server, notify := spans["GET /notify"][0], spans["notifier.Notify"][0]
+	publish, send := spans["notifier.PublishConcept"][0], spans["kafka.SendMessage"][0]
+
+	// the whole path is a single trace, continuing the one of the caller
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, span := range []sdktrace.ReadOnlySpan{server, notify, publish, send} {
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String(), span.Name())
+	}
+	assert.Equal(t, server.SpanContext().SpanID(), notify.Parent().SpanID())
+	assert.Equal(t, notify.SpanContext().SpanID(), publish.Parent().SpanID())
+	assert.Equal(t, publish.SpanContext().SpanID(), send.Parent().SpanID())
+
+	assert.Equal(t, "200", spanAttribute(server, httpStatusAttribute))
+	assert.Equal(t, "tid_traced", spanAttribute(notify, transactionIDAttribute))
+	assert.Equal(t, "uuid1", spanAttribute(publish, conceptUUIDAttribute))
+	assert.Equal(t, string(ConceptPublished), spanAttribute(publish, conceptStatusAttribute))
+
+	// the trace is continued by the consumers of the message
+	messages := kc.getMessages()
+	require.Len(t, messages, 1)
+	conceptTransactionID := messages[0].Headers["X-Request-Id"]
+	assert.Equal(t, conceptTransactionID, spanAttribute(publish, conceptTransactionIDAttribute))
+	assert.Equal(t, conceptTransactionID, spanAttribute(send, conceptTransactionIDAttribute))
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", traceID, send.SpanContext().SpanID()), messages[0].Headers["traceparent"])
+}
+
+func TestTracing_CoalescedNotificationsAreLinked(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	h := &Handler{model: smartlogicModel, tracer: tp.Tracer(tracerName)}
+
+	earliest := notificationRequest{id: "1", notifySince: time.Now().Add(-time.Hour), transactionID: "tid_1", traceParent: incomingTraceParent}
+	later := notificationRequest{id: "2", notifySince: time.Now(), transactionID: "tid_2", traceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+	untraced := notificationRequest{id: "3", notifySince: time.Now()}
+
+	_, span := h.startNotifySpan(earliest, []notificationRequest{earliest, later, untraced})
+	span.End()
+
+	require.Len(t, recorder.Ended(), 1)
+	notify := recorder.Ended()[0]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", notify.SpanContext().TraceID().String())
+	require.Len(t, notify.Links(), 1)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", notify.Links()[0].SpanContext.TraceID().String())
+	assert.Equal(t, "3", spanAttribute(notify, notificationsAttribute))
+}
+
+func TestTraceParent(t *testing.T) {
+	assert.Empty(t, traceParent(context.Background()))
+	assert.False(t, spanContextOf("").IsValid())
+
+	sc := spanContextOf(incomingTraceParent)
+	require.True(t, sc.IsValid())
+	assert.Equal(t, incomingTraceParent, traceParent(trace.ContextWithSpanContext(context.Background(), sc)))
+}
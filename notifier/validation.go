@@ -0,0 +1,160 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+)
+
+// The names of the built-in validation rules.
+const (
+	PrefLabelRule = "prefLabel"
+	TypeRule      = "type"
+	URIRule       = "uri"
+)
+
+// ValidationRule checks a concept fetched from Smartlogic before it is published.
+// Validate returns why the concept is invalid, or nil if it is valid.
+type ValidationRule interface {
+	Name() string
+	Validate(uuid string, concept smartlogic.ConceptDocument) error
+}
+
+// NewValidationRules returns the built-in rules with the given names. The known types are the types accepted by the type rule,
+// either as URIs or as the last segment of the URIs, e.g. Organisation. Without known types any type is accepted.
+func NewValidationRules(names []string, knownTypes []string) ([]ValidationRule, error) {
+	var rules []ValidationRule
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case PrefLabelRule:
+			rules = append(rules, prefLabelRule{})
+		case TypeRule:
+			rules = append(rules, newTypeRule(knownTypes))
+		case URIRule:
+			rules = append(rules, uriRule{})
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown validation rule %s, the rules are %s, %s and %s", name, PrefLabelRule, TypeRule, URIRule)
+		}
+	}
+	return rules, nil
+}
+
+// prefLabelRule requires the concept to have a prefLabel.
+type prefLabelRule struct{}
+
+func (prefLabelRule) Name() string {
+	return PrefLabelRule
+}
+
+func (prefLabelRule) Validate(_ string, concept smartlogic.ConceptDocument) error {
+	if len(concept.PrefLabels) == 0 {
+		return errors.New("the concept has no prefLabel")
+	}
+	return nil
+}
+
+// typeRule requires the concept to have a type, which is one of the known types if there are any.
+type typeRule struct {
+	known map[string]bool
+}
+
+func newTypeRule(knownTypes []string) typeRule {
+	r := typeRule{known: map[string]bool{}}
+	for _, t := range knownTypes {
+		if t = strings.TrimSpace(t); t != "" {
+			r.known[t] = true
+		}
+	}
+	return r
+}
+
+func (typeRule) Name() string {
+	return TypeRule
+}
+
+func (r typeRule) Validate(_ string, concept smartlogic.ConceptDocument) error {
+	if len(concept.Types) == 0 {
+		return errors.New("the concept has no @type")
+	}
+	if len(r.known) == 0 {
+		return nil
+	}
+	for _, t := range concept.Types {
+		if r.known[t] || r.known[t[strings.LastIndexAny(t, "/#")+1:]] {
+			return nil
+		}
+	}
+	return fmt.Errorf("the concept has none of the known types, its types are %s", strings.Join(concept.Types, ", "))
+}
+
+// uriRule requires the URI and the sem:guid of the concept to match the requested uuid,
+// so that a concept is not published under the uuid of another one.
+type uriRule struct{}
+
+func (uriRule) Name() string {
+	return URIRule
+}
+
+func (uriRule) Validate(uuid string, concept smartlogic.ConceptDocument) error {
+	if !strings.HasSuffix(concept.ID, "/"+uuid) {
+		return fmt.Errorf("the URI %s of the concept does not match its uuid", concept.ID)
+	}
+	if concept.GUID != "" && concept.GUID != uuid {
+		return fmt.Errorf("the sem:guid %s of the concept does not match its uuid", concept.GUID)
+	}
+	return nil
+}
+
+// RuleFailure is a validation rule a concept failed and why.
+type RuleFailure struct {
+	Rule   string
+	Reason error
+}
+
+// QuarantineError is returned for the concepts which failed validation. They are quarantined instead of being published.
+type QuarantineError struct {
+	Failures []RuleFailure
+}
+
+func (e *QuarantineError) Error() string {
+	reasons := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		reasons = append(reasons, f.Rule+": "+f.Reason.Error())
+	}
+	return "the concept failed validation, " + strings.Join(reasons, "; ")
+}
+
+// rules returns the names of the failed rules.
+func (e *QuarantineError) rules() []string {
+	names := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		names = append(names, f.Rule)
+	}
+	return names
+}
+
+// validate checks the concept with the given uuid against all the rules. It returns a QuarantineError with every rule
+// the concept failed, or nil if it passed all of them.
+func validate(rules []ValidationRule, uuid string, concept []byte) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	doc, err := smartlogic.ParseConceptDocument(concept)
+	if err != nil {
+		return &QuarantineError{Failures: []RuleFailure{{Rule: "json-ld", Reason: err}}}
+	}
+
+	var failures []RuleFailure
+	for _, rule := range rules {
+		if err := rule.Validate(uuid, doc); err != nil {
+			failures = append(failures, RuleFailure{Rule: rule.Name(), Reason: err})
+		}
+	}
+	if len(failures) > 0 {
+		return &QuarantineError{Failures: failures}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationRules(t *testing.T) {
+	const uuid = "2d3e16e0-61cb-4322-8aff-3b01c59f4daa"
+	valid := smartlogic.ConceptDocument{
+		ID:         "http://www.ft.com/thing/" + uuid,
+		GUID:       uuid,
+		Types:      []string{"http://www.ft.com/ontology/product/Brand"},
+		PrefLabels: []string{"Lex"},
+	}
+
+	tests := []struct {
+		name          string
+		knownTypes    []string
+		concept       func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument
+		expectedRules []string
+	}{
+		{
+			name:    "valid",
+			concept: func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument { return c },
+		},
+		{
+			name:       "known type by name",
+			knownTypes: []string{"Organisation", "Brand"},
+			concept:    func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument { return c },
+		},
+		{
+			name:       "known type by URI",
+			knownTypes: []string{"http://www.ft.com/ontology/product/Brand"},
+			concept:    func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument { return c },
+		},
+		{
+			name:          "unknown type",
+			knownTypes:    []string{"Organisation"},
+			concept:       func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument { return c },
+			expectedRules: []string{TypeRule},
+		},
+		{
+			name: "no prefLabel and no type",
+			concept: func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument {
+				c.PrefLabels, c.Types = nil, nil
+				return c
+			},
+			expectedRules: []string{PrefLabelRule, TypeRule},
+		},
+		{
+			name: "URI of another concept",
+			concept: func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument {
+				c.ID = "http://www.ft.com/thing/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"
+				return c
+			},
+			expectedRules: []string{URIRule},
+		},
+		{
+			name: "sem:guid of another concept",
+			concept: func(c smartlogic.ConceptDocument) smartlogic.ConceptDocument {
+				c.GUID = "dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"
+				return c
+			},
+			expectedRules: []string{URIRule},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := NewValidationRules([]string{PrefLabelRule, TypeRule, URIRule}, test.knownTypes)
+			require.NoError(t, err)
+
+			var failed []string
+			for _, rule := range rules {
+				if err := rule.Validate(uuid, test.concept(valid)); err != nil {
+					failed = append(failed, rule.Name())
+				}
+			}
+			assert.Equal(t, test.expectedRules, failed)
+		})
+	}
+}
+
+func TestNewValidationRules_Unknown(t *testing.T) {
+	_, err := NewValidationRules([]string{PrefLabelRule, "image"}, nil)
+	assert.EqualError(t, err, "unknown validation rule image, the rules are prefLabel, type and uri")
+}
+
+func TestValidate(t *testing.T) {
+	rules, err := NewValidationRules([]string{PrefLabelRule, URIRule}, nil)
+	require.NoError(t, err)
+
+	assert.NoError(t, validate(nil, "uuid", []byte("not json-ld")))
+	assert.NoError(t, validate(rules, "uuid", []byte(`{"@graph": [{"@id": "http://www.ft.com/thing/uuid",
+		"skosxl:prefLabel": [{"skosxl:literalForm": [{"@value": "Label"}]}]}]}`)))
+
+	err = validate(rules, "uuid", []byte(`{"@graph": [{"@id": "http://www.ft.com/thing/other"}]}`))
+	var quarantineErr *QuarantineError
+	require.ErrorAs(t, err, &quarantineErr)
+	assert.Equal(t, []string{PrefLabelRule, URIRule}, quarantineErr.rules())
+	assert.EqualError(t, err, "the concept failed validation, prefLabel: the concept has no prefLabel; "+
+		"uri: the URI http://www.ft.com/thing/other of the concept does not match its uuid")
+
+	err = validate(rules, "uuid", []byte("not json-ld"))
+	require.ErrorAs(t, err, &quarantineErr)
+	assert.Equal(t, []string{"json-ld"}, quarantineErr.rules())
+}
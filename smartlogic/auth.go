@@ -0,0 +1,140 @@
+package smartlogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DefaultTokenURL is the token endpoint of Smartlogic cloud.
+const DefaultTokenURL = "https://cloud.smartlogic.com/token"
+
+// The authentication modes supported by NewAuthenticator.
+const (
+	AuthModeAPIKey            = "apikey"
+	AuthModeStaticToken       = "token"
+	AuthModeClientCredentials = "client-credentials"
+)
+
+// Authenticator gets the access tokens used to call the Smartlogic API.
+type Authenticator interface {
+	Token(httpClient httpClient) (TokenResponse, error)
+}
+
+// AuthConfig holds the settings of all the authentication modes, only the ones of the selected mode are used.
+type AuthConfig struct {
+	Mode         string
+	TokenURL     string
+	APIKey       string
+	Token        string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+// NewAuthenticator returns the Authenticator of the mode in the config, which defaults to the API key grant.
+func NewAuthenticator(config AuthConfig) (Authenticator, error) {
+	tokenURL := config.TokenURL
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+
+	switch config.Mode {
+	case AuthModeAPIKey, "":
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("an API key is required for the %s authentication mode", AuthModeAPIKey)
+		}
+		return &APIKeyAuth{TokenURL: tokenURL, APIKey: config.APIKey}, nil
+	case AuthModeStaticToken:
+		if config.Token == "" {
+			return nil, fmt.Errorf("a token is required for the %s authentication mode", AuthModeStaticToken)
+		}
+		return &StaticTokenAuth{AccessToken: config.Token}, nil
+	case AuthModeClientCredentials:
+		if config.ClientID == "" || config.ClientSecret == "" {
+			return nil, fmt.Errorf("a client id and secret are required for the %s authentication mode", AuthModeClientCredentials)
+		}
+		return &ClientCredentialsAuth{
+			TokenURL:     tokenURL,
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Scope:        config.Scope,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown authentication mode %q, it should be one of %s, %s or %s",
+			config.Mode, AuthModeAPIKey, AuthModeStaticToken, AuthModeClientCredentials)
+	}
+}
+
+// APIKeyAuth exchanges a Smartlogic API key for an access token.
+type APIKeyAuth struct {
+	TokenURL string
+	APIKey   string
+}
+
+func (a *APIKeyAuth) Token(httpClient httpClient) (TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "apikey")
+	data.Set("key", a.APIKey)
+	return requestToken(httpClient, a.TokenURL, data, nil)
+}
+
+// StaticTokenAuth uses a bearer token issued outside of the service. The token is never refreshed.
+type StaticTokenAuth struct {
+	AccessToken string
+}
+
+func (a *StaticTokenAuth) Token(httpClient) (TokenResponse, error) {
+	return TokenResponse{AccessToken: a.AccessToken, TokenType: "bearer"}, nil
+}
+
+// ClientCredentialsAuth gets an access token with the OAuth 2 client credentials grant.
+// The client authenticates with HTTP basic authentication.
+type ClientCredentialsAuth struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+func (a *ClientCredentialsAuth) Token(httpClient httpClient) (TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	if a.Scope != "" {
+		data.Set("scope", a.Scope)
+	}
+	return requestToken(httpClient, a.TokenURL, data, func(req *http.Request) {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	})
+}
+
+// requestToken posts the given form to the token endpoint and decodes the token in the response.
+func requestToken(httpClient httpClient, tokenURL string, data url.Values, prepare func(*http.Request)) (TokenResponse, error) {
+	req, err := http.NewRequest("POST", tokenURL, bytes.NewBufferString(data.Encode()))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return TokenResponse{}, withOp(transportError(err), "getting an access token")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return TokenResponse{}, statusError(resp, "getting an access token")
+	}
+
+	var tokenResponse TokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return tokenResponse, nil
+}
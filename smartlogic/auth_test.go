@@ -0,0 +1,198 @@
+package smartlogic
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenServer is a stand-in for a Smartlogic token endpoint, it records the token requests it receives.
+type tokenServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func newTokenServer(t *testing.T, handler http.HandlerFunc) *tokenServer {
+	s := &tokenServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+		handler(w, req)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *tokenServer) getRequests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+func writeToken(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "bearer", "expires_in": 3600}`, token)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	server := newTokenServer(t, writeToken("apikey-token"))
+
+	auth, err := NewAuthenticator(AuthConfig{Mode: AuthModeAPIKey, TokenURL: server.URL + "/token", APIKey: "secret-key"})
+	require.NoError(t, err)
+
+	token, err := auth.Token(server.Client())
+	require.NoError(t, err)
+	assert.Equal(t, "apikey-token", token.AccessToken)
+	assert.Equal(t, 3600, token.ExpiresIn)
+
+	requests := server.getRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "POST", requests[0].Method)
+	assert.Equal(t, "/token", requests[0].URL.Path)
+	assert.Equal(t, "apikey", requests[0].PostForm.Get("grant_type"))
+	assert.Equal(t, "secret-key", requests[0].PostForm.Get("key"))
+}
+
+func TestClientCredentialsAuth(t *testing.T) {
+	server := newTokenServer(t, writeToken("client-token"))
+
+	auth, err := NewAuthenticator(AuthConfig{
+		Mode:         AuthModeClientCredentials,
+		TokenURL:     server.URL + "/oauth/token",
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Scope:        "semaphore",
+	})
+	require.NoError(t, err)
+
+	token, err := auth.Token(server.Client())
+	require.NoError(t, err)
+	assert.Equal(t, "client-token", token.AccessToken)
+
+	requests := server.getRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/oauth/token", requests[0].URL.Path)
+	assert.Equal(t, "client_credentials", requests[0].PostForm.Get("grant_type"))
+	assert.Equal(t, "semaphore", requests[0].PostForm.Get("scope"))
+	id, secret, ok := requests[0].BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "client-id", id)
+	assert.Equal(t, "client-secret", secret)
+}
+
+func TestClientCredentialsAuth_Rejected(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error": "invalid_client"}`)
+	})
+
+	auth := &ClientCredentialsAuth{TokenURL: server.URL, ClientID: "client-id", ClientSecret: "wrong-secret"}
+	_, err := auth.Token(server.Client())
+	assert.EqualError(t, err, "smartlogic returned status 401 getting an access token")
+}
+
+func TestStaticTokenAuth(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{Mode: AuthModeStaticToken, Token: "static-token"})
+	require.NoError(t, err)
+
+	token, err := auth.Token(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "static-token", token.AccessToken)
+	assert.Zero(t, token.ExpiresIn)
+}
+
+func TestNewAuthenticator_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AuthConfig
+	}{
+		{name: "api key missing", config: AuthConfig{Mode: AuthModeAPIKey}},
+		{name: "token missing", config: AuthConfig{Mode: AuthModeStaticToken}},
+		{name: "client secret missing", config: AuthConfig{Mode: AuthModeClientCredentials, ClientID: "client-id"}},
+		{name: "unknown mode", config: AuthConfig{Mode: "saml", APIKey: "key"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewAuthenticator(test.config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewAuthenticator_DefaultTokenURL(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, &APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "key"}, auth)
+}
+
+func TestClient_UsesAuthenticator(t *testing.T) {
+	tests := []struct {
+		name          string
+		auth          func(tokenURL string) Authenticator
+		expectedToken string
+	}{
+		{
+			name: "api key",
+			auth: func(tokenURL string) Authenticator {
+				return &APIKeyAuth{TokenURL: tokenURL, APIKey: "secret-key"}
+			},
+			expectedToken: "issued-token",
+		},
+		{
+			name: "client credentials",
+			auth: func(tokenURL string) Authenticator {
+				return &ClientCredentialsAuth{TokenURL: tokenURL, ClientID: "client-id", ClientSecret: "client-secret"}
+			},
+			expectedToken: "issued-token",
+		},
+		{
+			name: "static token",
+			auth: func(string) Authenticator {
+				return &StaticTokenAuth{AccessToken: "static-token"}
+			},
+			expectedToken: "static-token",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var authorization string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", writeToken("issued-token"))
+			mux.HandleFunc("/api", func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				authorization = req.Header.Get("Authorization")
+				mu.Unlock()
+				fmt.Fprint(w, `{"@graph": []}`)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client, err := NewSmartlogicClient(server.Client(), server.URL+"/api", "modelName", "", "conceptUriPrefix",
+				logger.NewUnstructuredLogger(),
+				WithAuthenticator(test.auth(server.URL+"/token")),
+			)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedToken, client.AccessToken())
+
+			_, err = client.GetChangedConceptList(time.Now())
+			require.NoError(t, err)
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, "Bearer "+test.expectedToken, authorization)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package smartlogic
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuthFailureThreshold = 5
+	defaultAuthCooldown         = time.Minute
+)
+
+// authBreaker stops the requests to Smartlogic after the access token was rejected too many times in a row,
+// e.g. because the API key was revoked, so that Smartlogic is not flooded with requests bound to fail.
+// After the cooldown a request is let through again, if it succeeds the breaker closes.
+type authBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newAuthBreaker() *authBreaker {
+	return &authBreaker{
+		threshold: defaultAuthFailureThreshold,
+		cooldown:  defaultAuthCooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a request can be made, and if not until when the breaker stays open.
+func (b *authBreaker) allow() (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.now().Before(b.openUntil) {
+		return false, b.openUntil
+	}
+	return true, time.Time{}
+}
+
+// failure records that the access token was rejected. The breaker opens once the threshold is reached,
+// and opens again straight away if the request let through after the cooldown fails too.
+func (b *authBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// success records that the access token was accepted, which closes the breaker.
+func (b *authBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
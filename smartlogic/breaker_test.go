@@ -0,0 +1,84 @@
+package smartlogic
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_MakeRequest_RetriesWithNewToken(t *testing.T) {
+	var tokenRequests atomic.Int32
+	sl, err := NewSmartlogicTestClient(funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == DefaultTokenURL {
+			n := tokenRequests.Add(1)
+			return newResponse(http.StatusOK, fmt.Sprintf(`{"access_token": "token%d"}`, n)), nil
+		}
+		if req.Header.Get("Authorization") != "Bearer token1" {
+			return newResponse(http.StatusUnauthorized, ""), nil
+		}
+		return newResponse(http.StatusOK, "response"), nil
+	}), "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+
+	resp, err := sl.makeRequest("GET", "http://a/url")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(1), tokenRequests.Load())
+}
+
+func TestClient_MakeRequest_BreakerRecoversAfterCooldown(t *testing.T) {
+	var authorized, requests atomic.Int32
+	sl, err := NewSmartlogicTestClient(funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == DefaultTokenURL {
+			return newResponse(http.StatusOK, `{"access_token": "token"}`), nil
+		}
+		requests.Add(1)
+		if authorized.Load() == 0 {
+			return newResponse(http.StatusUnauthorized, ""), nil
+		}
+		return newResponse(http.StatusOK, "response"), nil
+	}), "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	sl.auth.now = func() time.Time { return now }
+
+	// every request is retried once, so the breaker opens during the third request
+	for i := 0; i < 3; i++ {
+		_, err = sl.makeRequest("GET", "http://a/url")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	}
+	assert.Equal(t, int32(6), requests.Load())
+
+	// the breaker is open, so the requests fail without reaching Smartlogic
+	_, err = sl.makeRequest("GET", "http://a/url")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.EqualError(t, err, "smartlogic rejected the access token, the requests are stopped until 2020-04-05T10:01:00Z")
+	assert.Equal(t, int32(6), requests.Load())
+
+	// after the cooldown a request is let through, it fails again so the breaker opens again straight away
+	now = now.Add(time.Minute)
+	_, err = sl.makeRequest("GET", "http://a/url")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.Equal(t, int32(8), requests.Load())
+	_, err = sl.makeRequest("GET", "http://a/url")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.Equal(t, int32(8), requests.Load())
+
+	// once the credentials are fixed the first request after the cooldown closes the breaker
+	authorized.Store(1)
+	now = now.Add(time.Minute)
+	resp, err := sl.makeRequest("GET", "http://a/url")
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = sl.makeRequest("GET", "http://a/url")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(10), requests.Load())
+}
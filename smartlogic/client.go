@@ -1,53 +1,170 @@
 package smartlogic
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	slGetCredentialsURL = "https://cloud.smartlogic.com/token"
-	slTimeFormat        = "2006-01-02T15:04:05.000Z"
+	slTimeFormat = "2006-01-02T15:04:05.000Z"
 
-	maxAccessFailureCount = 5
+	// maxAuthAttempts is how many times a request is made with a new access token when Smartlogic rejects the token.
+	maxAuthAttempts = 2
+
+	// defaultChangesPageSize is how many changesets are requested from Smartlogic at once by default.
+	defaultChangesPageSize = 500
+
+	// changesProperties are the properties of the changesets requested from Smartlogic. Only the subject and the predicate
+	// of the added and deleted statements are requested, as they are enough to tell whether a concept was created or deleted.
+	changesProperties = "sem:about,sem:committed,sioc:has_creator,rdfs:comment," +
+		"teamwork:added/teamwork:subject,teamwork:added/teamwork:predicate," +
+		"teamwork:deleted/teamwork:subject,teamwork:deleted/teamwork:predicate"
 
 	thingURIPrefix           = "http://www.ft.com/thing/"
 	managedLocationURIPrefix = "http://www.ft.com/ontology/managedlocation/"
 )
 
+// ErrorConceptDoesNotExist matches the errors of kind KindNotFound.
 var ErrorConceptDoesNotExist = errors.New("concept does not exist")
 
+// ErrUnauthorized matches the errors of kind KindUnauthorized. They are returned when Smartlogic rejects the access token,
+// even after getting a new one, or when the requests are stopped because the token was rejected too many times in a row.
+var ErrUnauthorized = errors.New("smartlogic rejected the access token")
+
 type httpClient interface {
 	Do(req *http.Request) (resp *http.Response, err error)
 }
 
 type Clienter interface {
 	GetConcept(uuid string) ([]byte, error)
+	GetConceptContext(ctx context.Context, uuid string) ([]byte, error)
+	GetConceptWithProperties(uuid string, properties []string) ([]byte, error)
 	GetChangedConceptList(changeDate time.Time) ([]string, error)
+	GetConceptChanges(changeDate time.Time) (ConceptChanges, error)
+	GetConceptChangesAfter(key ChangesKey, limit int) (ConceptChanges, error)
+	StreamConceptChanges(changeDate time.Time, fn func(ConceptChanges) error) error
+	StreamConceptChangesContext(ctx context.Context, changeDate time.Time, fn func(ConceptChanges) error) error
+	GetConceptPage(after string, limit int) (ConceptPage, error)
+	GetConceptPageContext(ctx context.Context, after string, limit int) (ConceptPage, error)
 	AccessToken() string
+	TokenStatus() TokenStatus
 }
 
 type Client struct {
-	baseURL            url.URL
-	model              string
-	conceptURIPrefix   string
-	apiKey             string
-	httpClient         httpClient
-	accessToken        string
-	accessFailureCount int
-	log                *logger.UPPLogger
+	baseURL          url.URL
+	model            string
+	conceptURIPrefix string
+	apiKey           string
+	httpClient       httpClient
+	uris             *URIRegistry
+	properties       []string
+	changesPageSize  int
+	throttle         *throttle
+	retry            *retryPolicy
+	metrics          *clientMetrics
+	registry         metrics.Registry
+	tokens           *tokenManager
+	auth             *authBreaker
+	tracer           trace.Tracer
+	log              *logger.UPPLogger
+}
+
+// WithRateLimit limits the requests to the Smartlogic API to the given number per second.
+func WithRateLimit(requestsPerSecond int) func(*Client) {
+	return func(c *Client) {
+		c.throttle.setRate(requestsPerSecond)
+	}
+}
+
+// WithRateBurst sets how many requests can be sent at once when the rate limit budget is full,
+// instead of the number of requests per second.
+func WithRateBurst(burst int) func(*Client) {
+	return func(c *Client) {
+		c.throttle.setBurst(burst)
+	}
+}
+
+// WithSharedRateLimit paces the requests to the Smartlogic API with the given rate limiter, instead of a limit of the client's own,
+// so that the clients of several models given the same limiter keep to the limit together. They are all paused when
+// Smartlogic asks one of them to slow down.
+func WithSharedRateLimit(limiter *RateLimiter) func(*Client) {
+	return func(c *Client) {
+		c.throttle = limiter.throttle
+	}
+}
+
+// WithRetries sets how many times a request which failed is retried, and the longest Retry-After asked by Smartlogic
+// which is honored. A request which Smartlogic asks to retry later than that fails straight away.
+func WithRetries(maxRetries int, maxRetryAfter time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.retry.maxRetries = maxRetries
+		c.retry.maxRetryAfter = maxRetryAfter
+	}
+}
+
+// WithChangesPageSize sets how many changesets are requested from Smartlogic at once. 0 requests all of them at once.
+func WithChangesPageSize(size int) func(*Client) {
+	return func(c *Client) {
+		c.changesPageSize = size
+	}
+}
+
+// WithConceptProperties sets the properties of the concepts requested from Smartlogic, see ValidateConceptProperties.
+func WithConceptProperties(properties []string) func(*Client) {
+	return func(c *Client) {
+		c.properties = properties
+	}
+}
+
+// WithMetrics adds the metrics of the requests to Smartlogic to the given registry.
+func WithMetrics(r metrics.Registry) func(*Client) {
+	return func(c *Client) {
+		c.registry = r
+	}
+}
+
+// WithURIRegistry sets the namespaces of the concept URIs which are published. The namespace of the concept URI prefix
+// of the client is added to the registry if it is not accepted already.
+func WithURIRegistry(r *URIRegistry) func(*Client) {
+	return func(c *Client) {
+		c.uris = r
+	}
+}
+
+// WithAuthenticator sets how the access tokens are got, instead of exchanging the API key on Smartlogic cloud.
+func WithAuthenticator(auth Authenticator) func(*Client) {
+	return func(c *Client) {
+		c.tokens.auth = auth
+	}
+}
+
+// WithTokenRefreshAhead sets how long before its expiry the access token is refreshed.
+func WithTokenRefreshAhead(d time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.tokens.refreshAhead = d
+	}
 }
 
-func NewSmartlogicClient(httpClient httpClient, baseURL, model, apiKey, conceptURIPrefix string, log *logger.UPPLogger) (Clienter, error) {
+// WithAuthCooldown sets for how long the requests are stopped after the access token was rejected too many times in a row.
+func WithAuthCooldown(d time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.auth.cooldown = d
+	}
+}
+
+func NewSmartlogicClient(httpClient httpClient, baseURL, model, apiKey, conceptURIPrefix string, log *logger.UPPLogger, opts ...func(*Client)) (Clienter, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return &Client{}, err
@@ -59,9 +176,39 @@ func NewSmartlogicClient(httpClient httpClient, baseURL, model, apiKey, conceptU
 		conceptURIPrefix: conceptURIPrefix,
 		apiKey:           apiKey,
 		httpClient:       httpClient,
+		properties:       DefaultConceptProperties(),
+		changesPageSize:  defaultChangesPageSize,
+		throttle:         newThrottle(),
+		retry:            newRetryPolicy(),
+		metrics:          newClientMetrics(),
+		tokens:           newTokenManager(httpClient, &APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: apiKey}, log),
+		auth:             newAuthBreaker(),
+		tracer:           otel.Tracer(tracerName),
 		log:              log,
 	}
 
+	client.tokens.metrics = client.metrics
+
+	for _, opt := range opts {
+		opt(&client)
+	}
+
+	if err = ValidateConceptProperties(client.properties); err != nil {
+		return &Client{}, err
+	}
+
+	if client.registry != nil {
+		if err = client.metrics.register(client.registry, model, client.throttle); err != nil {
+			return &Client{}, err
+		}
+	}
+
+	if client.uris == nil {
+		client.uris, _ = NewURIRegistry(DefaultURINamespaces(), log)
+	}
+	// the concepts are requested with the concept URI prefix, so the same concepts should be accepted in the changes
+	client.uris.AcceptPrefix(conceptURIPrefix)
+
 	err = client.GenerateToken()
 	if err != nil {
 		return &Client{}, err
@@ -69,47 +216,95 @@ func NewSmartlogicClient(httpClient httpClient, baseURL, model, apiKey, conceptU
 	return &client, nil
 }
 
+// AccessToken returns the access token in use, without refreshing it.
 func (c *Client) AccessToken() string {
-	return c.accessToken
+	return c.tokens.Status().Token
+}
+
+// TokenStatus returns the access token in use and when it was issued and expires.
+func (c *Client) TokenStatus() TokenStatus {
+	return c.tokens.Status()
 }
 
 // GetConcept returns the json-ld Smartlogic representation of a concept with the given uuid via calling the Smartlogic API.
+// The concept has the properties the client is configured with.
 func (c *Client) GetConcept(uuid string) ([]byte, error) {
+	return c.getConceptWithProperties(context.Background(), uuid, c.properties)
+}
+
+// GetConceptContext is GetConcept with the request traced as part of the given context.
+func (c *Client) GetConceptContext(ctx context.Context, uuid string) ([]byte, error) {
+	return c.getConceptWithProperties(ctx, uuid, c.properties)
+}
+
+// GetConceptWithProperties returns the json-ld Smartlogic representation of a concept with the given uuid and properties.
+// The properties should be valid, see ValidateConceptProperties.
+func (c *Client) GetConceptWithProperties(uuid string, properties []string) ([]byte, error) {
+	return c.getConceptWithProperties(context.Background(), uuid, properties)
+}
+
+func (c *Client) getConceptWithProperties(ctx context.Context, uuid string, properties []string) ([]byte, error) {
+	ctx, span := c.startSpan(ctx, "smartlogic.GetConcept", uuidAttribute.String(uuid))
+	start := time.Now()
+	concept, err := c.getConcept(ctx, uuid, properties)
+	c.metrics.getConcept.UpdateSince(start)
+	if err != nil {
+		c.metrics.conceptError(err)
+	}
+	endSpan(span, err)
+	return concept, err
+}
+
+// getConcept requests the concept under each of the URIs it can have in turn, until one of them exists.
+func (c *Client) getConcept(ctx context.Context, uuid string, properties []string) ([]byte, error) {
+	var err error
+	for _, uri := range c.conceptURIs(uuid) {
+		var concept []byte
+		concept, err = c.getConceptByURI(ctx, uuid, uri, properties)
+		if !errors.Is(err, ErrorConceptDoesNotExist) {
+			return concept, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) getConceptByURI(ctx context.Context, uuid, uri string, properties []string) ([]byte, error) {
 	reqURL := c.baseURL
-	q := "path=" + c.buildConceptPath(uuid)
+	q := "path=" + c.buildConceptPath(uri, properties)
 	reqURL.RawQuery = q
 
-	entry := c.log.WithField("method", "GetConcept").WithField("uuid", uuid)
+	entry := c.log.WithField("method", "GetConcept").WithField("uuid", uuid).WithField("uri", uri)
 	entry.Debugf("Smartlogic Request URL: %v", reqURL.String())
+	op := fmt.Sprintf("getting concept with uuid %v", uuid)
 
-	resp, err := c.makeRequest("GET", reqURL.String())
+	resp, err := c.makeRequestContext(ctx, "GET", reqURL.String())
 	if err != nil {
 		entry.WithError(err).Error("Error creating the request")
-		return nil, err
+		return nil, withOp(err, op)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("smartlogic returned status %v getting concept with uuid %v", resp.StatusCode, uuid)
-		entry.WithError(err).Error("Error response returned")
-		return nil, err
+		slErr := statusError(resp, op)
+		entry.WithError(slErr).WithField("body", slErr.Body).Error("Error response returned")
+		return nil, slErr
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		entry.WithError(err).Error("Error reading the response body")
-		return nil, err
+		return nil, withOp(transportError(err), op)
 	}
 	// As Smartlogic returns 200 response for non-existing concept with simple representation of the non existing concept,
 	// we additionally validate the response in order to check whether the response is for existing concept.
 	ok, err := c.isExistingConcept(body)
 	if err != nil {
-		errorMsg := fmt.Errorf("invalid concept representation returned for uuid %v", uuid)
-		entry.WithError(err).WithField("body", string(body)).Error(errorMsg)
-		return nil, errorMsg
+		slErr := invalidResponseError(fmt.Sprintf("invalid concept representation returned for uuid %v", uuid), body, err)
+		entry.WithError(err).WithField("body", string(body)).Error(slErr)
+		return nil, slErr
 	}
 	if !ok {
-		return nil, ErrorConceptDoesNotExist
+		return nil, &Error{Kind: KindNotFound, StatusCode: http.StatusOK, Body: bodySnippet(body), Msg: fmt.Sprintf("concept with uuid %v does not exist", uuid)}
 	}
 	return body, nil
 }
@@ -140,156 +335,459 @@ func (c *Client) isExistingConcept(conceptResp []byte) (bool, error) {
 
 // GetChangedConceptList returns a list of uuids of concepts that were changed since specified time.
 func (c *Client) GetChangedConceptList(changeDate time.Time) ([]string, error) {
+	changes, err := c.GetConceptChanges(changeDate)
+	if err != nil {
+		return nil, err
+	}
+	return changes.UUIDs, nil
+}
+
+// GetConceptChanges returns the uuids of concepts that were changed since specified time
+// and the sem:committed time of the latest change, together with the changesets the changes were made in.
+// It fails if Smartlogic does not return a json-ld change list. The changes are requested page by page.
+func (c *Client) GetConceptChanges(changeDate time.Time) (ConceptChanges, error) {
+	changes := ConceptChanges{UUIDs: []string{}, Committed: map[string]time.Time{}, Changesets: []ChangesetMetadata{}}
+	seen := map[string]bool{}
+	err := c.StreamConceptChanges(changeDate, func(page ConceptChanges) error {
+		changes.merge(page, seen)
+		return nil
+	})
+	if err != nil {
+		return ConceptChanges{}, err
+	}
+	return changes, nil
+}
+
+// StreamConceptChanges requests the changes made since the specified time page by page, and calls fn with the changes
+// of every page as it arrives. A concept changed in several pages is in the changes of each of them.
+// It stops at the first error, either of Smartlogic or of fn.
+func (c *Client) StreamConceptChanges(changeDate time.Time, fn func(ConceptChanges) error) error {
+	return c.StreamConceptChangesContext(context.Background(), changeDate, fn)
+}
+
+// StreamConceptChangesContext is StreamConceptChanges with the request of every page traced as part of the given context.
+// The context is passed to fn as well. Every page is requested after the last change of the previous one,
+// so the changes committed while paging are neither skipped nor read twice.
+func (c *Client) StreamConceptChangesContext(ctx context.Context, changeDate time.Time, fn func(ConceptChanges) error) error {
+	key := ChangesKey{Since: changeDate}
+	for {
+		page, err := c.getConceptChangesPage(ctx, key, c.changesPageSize)
+		if err != nil {
+			return err
+		}
+		if err = fn(page); err != nil {
+			return err
+		}
+		if !page.More {
+			return nil
+		}
+		key = page.Next
+	}
+}
+
+// GetConceptChangesAfter returns the changes of the first limit changesets the given key points at, in the order
+// they were committed. A zero limit requests all the changesets at once. The Next key of the changes points at the following page.
+func (c *Client) GetConceptChangesAfter(key ChangesKey, limit int) (ConceptChanges, error) {
+	return c.getConceptChangesPage(context.Background(), key, limit)
+}
+
+func (c *Client) getConceptChangesPage(ctx context.Context, key ChangesKey, limit int) (ConceptChanges, error) {
+	ctx, span := c.startSpan(ctx, "smartlogic.GetConceptChanges", sinceAttribute.String(key.Since.Format(slTimeFormat)), limitAttribute.Int(limit))
+	changes, err := c.getConceptChanges(ctx, key, limit)
+	if err == nil {
+		span.SetAttributes(changesetsAttribute.Int(changes.Size), conceptsAttribute.Int(len(changes.UUIDs)))
+	}
+	endSpan(span, err)
+	return changes, err
+}
+
+func (c *Client) getConceptChanges(ctx context.Context, key ChangesKey, limit int) (ConceptChanges, error) {
 	reqURL := c.baseURL
-	reqURL.RawQuery = c.buildChangesAPIQueryParams(changeDate).Encode()
+	reqURL.RawQuery = c.buildChangesAPIQueryParams(key, limit).Encode()
 
 	c.log.Debugf("Smartlogic Change List Request URL: %v", reqURL.String())
-	resp, err := c.makeRequest("GET", reqURL.String())
+	op := fmt.Sprintf("getting the changes since %v", key.Since.Format(slTimeFormat))
+	resp, err := c.makeRequestContext(ctx, "GET", reqURL.String())
 	if err != nil {
-		c.log.WithError(err).WithField("method", "GetChangedConceptList").Error("Error creating the request")
-		return nil, err
+		c.log.WithError(err).WithField("method", "GetConceptChanges").Error("Error creating the request")
+		return ConceptChanges{}, withOp(err, op)
 	}
+	defer resp.Body.Close()
 
 	var graph Graph
-	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&graph)
-	if err != nil {
-		c.log.WithError(err).WithField("method", "GetChangedConceptList").Error("Error decoding the response body")
-		return nil, err
+	if err = c.decodeGraph(resp, op, &graph); err != nil {
+		c.log.WithError(err).WithField("method", "GetConceptChanges").Error("Error decoding the response body")
+		return ConceptChanges{}, err
+	}
+
+	// the changesets committed at the time of the key which were read already are returned again
+	size := len(graph.Changesets)
+	graph.Changesets = unseenChangesets(graph.Changesets, key.Seen)
+	more := limit > 0 && size >= limit+len(key.Seen)
+	if more && len(graph.Changesets) == 0 {
+		// there would be no end to the pages otherwise
+		return ConceptChanges{}, fmt.Errorf("%s: a full page of changesets were all read already, the changesets are not sorted", op)
+	}
+
+	// every URI is resolved once, so that the dropped ones are counted once
+	uuids := map[string]string{}
+	conceptID := func(uri string) (string, bool) {
+		uuid, ok := uuids[uri]
+		if !ok {
+			uuid, _ = c.conceptID(uri)
+			uuids[uri] = uuid
+		}
+		return uuid, uuid != ""
 	}
 
-	changedURIs := map[string]bool{}
+	var lastCommitted time.Time
+	changedURIs := map[string]time.Time{}
+	changesets := make([]ChangesetMetadata, 0, len(graph.Changesets))
+	events := []ChangeEvent{}
 	for _, changeset := range graph.Changesets {
+		var changesetCommitted time.Time
+		for _, v := range changeset.Committed {
+			committed, err := time.Parse(time.RFC3339Nano, v.Value)
+			if err != nil {
+				c.log.WithError(err).WithField("method", "GetConceptChanges").Warnf("Invalid sem:committed value %q", v.Value)
+				continue
+			}
+			if committed.After(changesetCommitted) {
+				changesetCommitted = committed
+			}
+		}
+		if changesetCommitted.After(lastCommitted) {
+			lastCommitted = changesetCommitted
+		}
+		metadata := ChangesetMetadata{
+			ID:         changeset.ID,
+			Committed:  changesetCommitted,
+			ChangeType: changeset.changeType(),
+			Author:     changeset.author(),
+			UUIDs:      []string{},
+		}
+		var changesetEvents []ChangeEvent
 		for _, v := range changeset.Concepts {
-			changedURIs[v.URI] = true
+			if changesetCommitted.After(changedURIs[v.URI]) {
+				changedURIs[v.URI] = changesetCommitted
+			} else if _, ok := changedURIs[v.URI]; !ok {
+				changedURIs[v.URI] = time.Time{}
+			}
+			if uuid, ok := conceptID(v.URI); ok {
+				metadata.UUIDs = append(metadata.UUIDs, uuid)
+				changesetEvents = append(changesetEvents, ChangeEvent{
+					UUID:      uuid,
+					Type:      changeset.changeTypeOf(v.URI),
+					Changeset: changeset.ID,
+					Author:    metadata.Author,
+					Committed: changesetCommitted,
+				})
+			}
 		}
+		changesets = append(changesets, metadata)
+		events = append(events, withMergeTarget(changesetEvents)...)
 	}
 
-	output := []string{}
-	for k := range changedURIs {
-		if uuid, ok := getUUIDfromValidURI(k); ok {
-			output = append(output, uuid)
+	changes := ConceptChanges{
+		UUIDs:         []string{},
+		LastCommitted: lastCommitted,
+		Committed:     map[string]time.Time{},
+		Changesets:    changesets,
+		Events:        events,
+		Size:          len(graph.Changesets),
+		Next:          key.next(changesets),
+		More:          more,
+	}
+	for uri, committed := range changedURIs {
+		uuid, ok := conceptID(uri)
+		if !ok {
+			continue
+		}
+		changes.UUIDs = append(changes.UUIDs, uuid)
+		if !committed.IsZero() {
+			changes.Committed[uuid] = committed
 		}
 	}
-	return output, nil
+	return changes, nil
 }
 
-func getUUIDfromValidURI(uri string) (string, bool) {
-	if !strings.Contains(uri, "ConceptScheme") {
-		if strings.HasPrefix(uri, thingURIPrefix) {
-			return strings.TrimPrefix(uri, thingURIPrefix), true
-		}
-		if strings.HasPrefix(uri, managedLocationURIPrefix) {
-			return strings.TrimPrefix(uri, managedLocationURIPrefix), true
+// unseenChangesets returns the changesets which are not in the given ids.
+func unseenChangesets(changesets []Changeset, seen []string) []Changeset {
+	if len(seen) == 0 {
+		return changesets
+	}
+	ids := make(map[string]bool, len(seen))
+	for _, id := range seen {
+		ids[id] = true
+	}
+	unseen := make([]Changeset, 0, len(changesets))
+	for _, changeset := range changesets {
+		if !ids[changeset.ID] {
+			unseen = append(unseen, changeset)
 		}
 	}
-	return "", false
+	return unseen
 }
 
-func (c *Client) makeRequest(method, url string) (*http.Response, error) {
-	if c.accessFailureCount >= maxAccessFailureCount {
-		// We've failed to get a valid access token multiple times in a row, so just error out.
-		c.log.WithField("method", "makeRequest").Error("Failed to get a valid access token")
-		return nil, errors.New("failed to get a valid access token")
+// withMergeTarget sets the concept the merged concepts of a changeset were merged into,
+// if exactly one of the concepts of the changeset was not removed.
+func withMergeTarget(events []ChangeEvent) []ChangeEvent {
+	var target string
+	for _, event := range events {
+		if event.Type.Removed() {
+			continue
+		}
+		if target != "" && target != event.UUID {
+			return events
+		}
+		target = event.UUID
 	}
+	for i := range events {
+		if events[i].Type == ChangeMerged {
+			events[i].MergedInto = target
+		}
+	}
+	return events
+}
 
-	req, err := http.NewRequest(method, url, nil)
+// GetConceptPage returns the uuids of a page of all the concepts in the model sorted by guid, starting after the concept
+// with the given guid, or from the first one if it is empty. The concepts are paged by guid rather than by offset,
+// so that the concepts added or removed while paging do not shift the following pages.
+func (c *Client) GetConceptPage(after string, limit int) (ConceptPage, error) {
+	return c.GetConceptPageContext(context.Background(), after, limit)
+}
+
+// GetConceptPageContext is GetConceptPage with the request stopped when the given context is done.
+func (c *Client) GetConceptPageContext(ctx context.Context, after string, limit int) (ConceptPage, error) {
+	reqURL := c.baseURL
+	reqURL.RawQuery = c.buildConceptsAPIQueryParams(after, limit).Encode()
+
+	entry := c.log.WithField("method", "GetConceptPage")
+	entry.Debugf("Smartlogic Concept List Request URL: %v", reqURL.String())
+	op := fmt.Sprintf("getting concepts after guid %q", after)
+	resp, err := c.makeRequestContext(ctx, "GET", reqURL.String())
 	if err != nil {
-		c.log.WithError(err).WithField("method", "makeRequest").Error("Error creating the request")
-		return nil, err
+		entry.WithError(err).Error("Error creating the request")
+		return ConceptPage{}, withOp(err, op)
 	}
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	defer resp.Body.Close()
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		c.log.WithError(err).WithField("method", "makeRequest").Error("Error making the request")
-		return resp, err
+	var graph ConceptGraph
+	if err = c.decodeGraph(resp, op, &graph); err != nil {
+		entry.WithError(err).Error("Error decoding the response body")
+		return ConceptPage{}, err
 	}
 
-	// We're checking if we got a 401, which would be because the token had expired.  If it has, generate a new
-	// one and then make the request again.
-	if resp.StatusCode == http.StatusUnauthorized {
-		resp.Body.Close()
-		c.accessFailureCount++
-		err = c.GenerateToken()
-		if err != nil {
-			// we were not able to generate new token, we will log it and try again to make the request
-			// which will try again to generate new token
-			c.log.Infof("Failed to generate new Smartlogic token: %v", err)
+	page := ConceptPage{UUIDs: []string{}, Size: len(graph.Concepts)}
+	for _, concept := range graph.Concepts {
+		if guid := concept.guid(); guid != "" {
+			page.Last = guid
+		}
+		if uuid, ok := c.conceptID(concept.URI); ok {
+			page.UUIDs = append(page.UUIDs, uuid)
 		}
-		return c.makeRequest(method, url)
 	}
-	c.accessFailureCount = 0
-	return resp, err
+	return page, nil
 }
 
-type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
-	UserName    string `json:"userName"`
-	Issued      string `json:".issued"`
-	Expires     string `json:".expires"`
+// conceptID returns the id in the given concept URI, counting the URIs which are dropped by namespace.
+func (c *Client) conceptID(uri string) (string, bool) {
+	id, dropped, ok := c.uris.conceptID(uri)
+	if dropped != "" {
+		c.metrics.droppedURI(dropped)
+	}
+	return id, ok
 }
 
-// Tokens have a limited life, so to be safe we should generate a new one for each notification received.
-func (c *Client) GenerateToken() error {
-	data := url.Values{}
-	data.Set("grant_type", "apikey")
-	data.Set("key", c.apiKey)
+// conceptURIs returns the URIs the concept with the given id can have, the one under the concept URI prefix first,
+// followed by the ones in the other accepted namespaces with a prefix.
+func (c *Client) conceptURIs(id string) []string {
+	uris := []string{c.conceptURIPrefix + id}
+	for _, uri := range c.uris.uris(id) {
+		if uri != uris[0] {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
 
-	req, err := http.NewRequest("POST", slGetCredentialsURL, bytes.NewBufferString(data.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+// decodeGraph decodes the json-ld graph in the given response, which is expected to be successful.
+func (c *Client) decodeGraph(resp *http.Response, op string, graph interface{}) error {
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, op)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		c.log.WithError(err).WithField("method", "GenerateToken").Error("Error creating the request")
-		return err
+		return withOp(transportError(err), op)
 	}
+	if err = json.Unmarshal(body, graph); err != nil {
+		return invalidResponseError("invalid response returned "+op, body, err)
+	}
+	if v, ok := graph.(interface{ validate() error }); ok {
+		if err = v.validate(); err != nil {
+			return invalidResponseError("invalid json-ld returned "+op, body, err)
+		}
+	}
+	return nil
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		c.log.WithError(err).WithField("method", "GenerateToken").Error("Error making the request")
-		return err
+// makeRequest makes the request with the access token in use. The errors returned are of type *Error,
+// except when the request cannot be created. The requests which fail with a transport error or a 5xx or 429 status
+// are retried, the response of the last attempt is returned if they keep failing.
+func (c *Client) makeRequest(method, url string) (*http.Response, error) {
+	return c.makeRequestContext(context.Background(), method, url)
+}
+
+// makeRequestContext is makeRequest with the request made as part of the given context.
+func (c *Client) makeRequestContext(ctx context.Context, method, url string) (*http.Response, error) {
+	if ok, until := c.auth.allow(); !ok {
+		// The access token was rejected too many times in a row, so the requests are stopped for a while.
+		err := &Error{Kind: KindUnauthorized, Msg: fmt.Sprintf("%v, the requests are stopped until %s", ErrUnauthorized, until.Format(time.RFC3339))}
+		c.log.WithError(err).WithField("method", "makeRequest").Error("Failed to get a valid access token")
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	authAttempts := 0
+	for retry := 0; ; {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			c.log.WithError(err).WithField("method", "makeRequest").Error("Error creating the request")
+			return nil, err
+		}
+		token, err := c.tokens.Token()
+		if err != nil {
+			// the request is made anyway, Smartlogic responds with 401 if the token in use is not valid
+			c.log.Infof("Failed to refresh the Smartlogic token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
 
-	var tokenResponse TokenResponse
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&tokenResponse)
-	if err != nil {
-		c.log.WithError(err).WithField("method", "GenerateToken").Error("Error decoding the response body")
-		return err
+		if err = c.throttle.wait(ctx); err != nil {
+			return nil, &Error{Kind: KindRateLimited, Err: err}
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			delay, ok := c.retry.delay(retry, 0)
+			if !ok {
+				c.log.WithError(err).WithField("method", "makeRequest").Error("Error making the request")
+				return nil, transportError(err)
+			}
+			c.log.WithError(err).WithField("method", "makeRequest").Warnf("Error making the request, retrying in %v", delay)
+			c.metrics.retries.Inc(1)
+			if c.retry.sleep(ctx, delay) != nil {
+				// the request was stopped, it fails with the error of the last attempt
+				return nil, transportError(err)
+			}
+			retry++
+			continue
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			// We got a 401, which would be because the token had expired or was revoked.  The token is invalidated,
+			// so that a new one is generated for the request made again, unless the request was already retried.
+			authAttempts++
+			slErr := statusError(resp, "")
+			resp.Body.Close()
+			c.auth.failure()
+			c.tokens.Invalidate(token)
+			if authAttempts >= maxAuthAttempts {
+				slErr.Msg = fmt.Sprintf("%v after %d attempts", ErrUnauthorized, authAttempts)
+				err = slErr
+				c.log.WithError(err).WithField("method", "makeRequest").Error("Failed to get a valid access token")
+				return nil, err
+			}
+			continue
+		}
+		c.auth.success()
+
+		if !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+
+		var retryAfter time.Duration
+		if throttled(resp.StatusCode) {
+			c.metrics.throttled.Inc(1)
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		delay, ok := c.retry.delay(retry, retryAfter)
+		if !ok {
+			return resp, nil
+		}
+		c.log.WithField("method", "makeRequest").WithField("status", resp.StatusCode).Warnf("Smartlogic request failed, retrying in %v", delay)
+		c.metrics.retries.Inc(1)
+		if throttled(resp.StatusCode) {
+			// Smartlogic asked to slow down, so all the requests wait, not only this one.
+			c.throttle.pause(delay)
+		} else if c.retry.sleep(ctx, delay) != nil {
+			// the request was stopped, the response of the last attempt is the outcome
+			return resp, nil
+		}
+		resp.Body.Close()
+		retry++
 	}
-	c.log.Debug("Setting Smartlogic access token")
-	c.accessToken = tokenResponse.AccessToken
-	return nil
 }
 
-func (c *Client) buildConceptPath(uuid string) string {
+// GenerateToken fetches a new access token. If a refresh of the token is already in progress it waits for it instead.
+func (c *Client) GenerateToken() error {
+	return c.tokens.Refresh()
+}
+
+func (c *Client) buildConceptPath(uri string, properties []string) string {
 	/*
 		Because the API call needs to be made as part of the 'path' query parameter, we need to escape the IRI twice,
 		once to encode the IRI according to how Smartlogic needs it and once to encode it as a query parameter.
 	*/
-	concept := "<" + c.conceptURIPrefix + uuid + ">"
+	concept := "<" + uri + ">"
 	encodedConcept := url.QueryEscape(url.QueryEscape(concept))
 
-	encodedProperties := url.QueryEscape("<http://www.ft.com/ontology/shortLabel>")
-	return "model:" + c.model + "/" + encodedConcept + "&properties=%5B%5D,skosxl:prefLabel/skosxl:literalForm,skosxl:altLabel/skosxl:literalForm," + encodedProperties + "/skosxl:literalForm"
+	if properties == nil {
+		properties = DefaultConceptProperties()
+	}
+	return "model:" + c.model + "/" + encodedConcept + encodeConceptProperties(properties)
 }
 
 // buildChangesAPIQueryParams returns map of type url.Values containing all query params needed to perform request to the Smartlogic API
-// that returns the changes on the model since specified time
-func (c *Client) buildChangesAPIQueryParams(changeDate time.Time) url.Values {
-	// Construct the request query params in such way that only the ids of the concepts affected by the change will be returned.
-	// Example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about&filters=subject(sem:committed%3E%222020-04-05T00:00:00.990Z%22%5E%5Exsd:dateTime)
-	// URL decoded example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about&filters=subject(sem:committed>"2020-04-05T00:00:00.990Z"^^xsd:dateTime)
+// that returns the changes on the model the key points at, in the order they were committed.
+// Unless the limit is zero, a page of the changes is requested.
+func (c *Client) buildChangesAPIQueryParams(key ChangesKey, limit int) url.Values {
+	// Construct the request query params in such way that only the ids of the concepts affected by the change,
+	// the commit time, the author, the comment and the changed statements of the change will be returned.
+	// Example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about,sem:committed,sioc:has_creator,rdfs:comment,teamwork:added/teamwork:subject,...&filters=subject(sem:committed%3E%222020-04-05T00:00:00.990Z%22%5E%5Exsd:dateTime)
+	// URL decoded example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about,sem:committed,sioc:has_creator,rdfs:comment,teamwork:added/teamwork:subject,...&filters=subject(sem:committed>"2020-04-05T00:00:00.990Z"^^xsd:dateTime)
 	queryParams := url.Values{}
 
 	queryParams.Add("path", fmt.Sprintf("tchmodel:%s/teamwork:Change/rdf:instance", c.model))
-	queryParams.Add("properties", "sem:about")
+	queryParams.Add("properties", changesProperties)
 
-	timeFilter := fmt.Sprintf("sem:committed>\"%s\"^^xsd:dateTime", changeDate.Format(slTimeFormat))
+	// the changesets committed at the time of the key are requested again, unless none of them were read
+	operator := ">"
+	if len(key.Seen) > 0 {
+		operator = ">="
+	}
+	timeFilter := fmt.Sprintf("sem:committed%s\"%s\"^^xsd:dateTime", operator, key.Since.Format(slTimeFormat))
 	queryParams.Add("filters", fmt.Sprintf("subject(%s)", timeFilter))
+	queryParams.Add("sort", "sem:committed")
+	if limit > 0 {
+		// the changesets read already do not count towards the limit
+		queryParams.Add("limit", strconv.Itoa(limit+len(key.Seen)))
+	}
+
+	return queryParams
+}
+
+// buildConceptsAPIQueryParams returns the query params needed to get a page of the ids of all the concepts in the model,
+// sorted by guid and starting after the given guid.
+func (c *Client) buildConceptsAPIQueryParams(after string, limit int) url.Values {
+	// URL decoded example: path=tchmodel:MODEL_ID/skos:Concept/meta:transitiveInstance&properties=sem:guid&sort=sem:guid&limit=100&filters=subject(sem:guid>"02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11")
+	queryParams := url.Values{}
+
+	queryParams.Add("path", fmt.Sprintf("tchmodel:%s/skos:Concept/meta:transitiveInstance", c.model))
+	queryParams.Add("properties", "sem:guid")
+	queryParams.Add("sort", "sem:guid")
+	queryParams.Add("limit", strconv.Itoa(limit))
+	if after != "" {
+		queryParams.Add("filters", fmt.Sprintf("subject(sem:guid>%s)", strconv.Quote(after)))
+	}
 
 	return queryParams
 }
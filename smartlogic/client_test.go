@@ -3,30 +3,52 @@ package smartlogic
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
 )
 
-func NewSmartlogicTestClient(httpClient httpClient, baseURL string, model string, apiKey string, conceptURIPrefix string) (Client, error) {
+func NewSmartlogicTestClient(httpClient httpClient, baseURL string, model string, apiKey string, conceptURIPrefix string) (*Client, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
-		return Client{}, err
+		return nil, err
 	}
 
-	client := Client{
+	log := logger.NewUnstructuredLogger()
+	uris, err := NewURIRegistry(DefaultURINamespaces(), log)
+	if err != nil {
+		return nil, err
+	}
+	uris.AcceptPrefix(conceptURIPrefix)
+	tokens := newTokenManager(httpClient, &APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: apiKey}, log)
+	tokens.set("", time.Now(), time.Time{})
+
+	client := &Client{
 		baseURL:          *u,
 		model:            model,
 		conceptURIPrefix: conceptURIPrefix,
 		apiKey:           apiKey,
 		httpClient:       httpClient,
-		log:              logger.NewUnstructuredLogger(),
+		uris:             uris,
+		throttle:         newThrottle(),
+		retry:            &retryPolicy{},
+		metrics:          newClientMetrics(),
+		tokens:           tokens,
+		auth:             newAuthBreaker(),
+		tracer:           otel.Tracer(tracerName),
+		log:              log,
 	}
 
 	return client, nil
@@ -94,8 +116,8 @@ func TestNewSmartlogicClient_BadResponse(t *testing.T) {
 		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
 		logger.NewUnstructuredLogger(),
 	)
-	assert.Error(t, err)
-	assert.EqualValues(t, responseError, err)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, responseError)
 }
 
 func TestNewSmartlogicClient_BadJSON(t *testing.T) {
@@ -144,8 +166,8 @@ func TestClient_MakeRequest_Unauthorized(t *testing.T) {
 	assert.NoError(t, err)
 
 	_, err = sl.makeRequest("GET", "http://a/url")
-	assert.Error(t, err)
-	assert.EqualValues(t, errors.New("failed to get a valid access token"), err)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.EqualError(t, err, "smartlogic rejected the access token after 2 attempts")
 }
 
 func TestClient_MakeRequest_DoError(t *testing.T) {
@@ -159,8 +181,8 @@ func TestClient_MakeRequest_DoError(t *testing.T) {
 	assert.NoError(t, err)
 
 	_, err = sl.makeRequest("GET", "http://a/url")
-	assert.Error(t, err)
-	assert.EqualValues(t, errors.New("Errorfield"), err)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.EqualError(t, err, "smartlogic is unavailable: Errorfield")
 }
 
 func TestClient_MakeRequest_RequestError(t *testing.T) {
@@ -277,6 +299,126 @@ func TestClient_GetChangedConceptList_Success(t *testing.T) {
 	assert.EqualValues(t, expectedResponse, response)
 }
 
+func TestClient_GetConceptChanges_Changesets(t *testing.T) {
+	conceptResponse, err := ioutil.ReadFile("testdata/get-changed-concepts.json")
+	require.NoError(t, err)
+
+	sl, err := NewSmartlogicTestClient(&mockHTTPClient{resp: string(conceptResponse), statusCode: http.StatusOK},
+		"http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+
+	changes, err := sl.GetConceptChanges(time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, []ChangesetMetadata{
+		{
+			ID:         "urn:x-change:2017-06-06T14-36-28.971Zderek.kettlety@ft.com",
+			Committed:  time.Date(2017, 6, 6, 14, 36, 28, 971000000, time.UTC),
+			ChangeType: "model-structure-metadata-deleted",
+			Author:     "derek.kettlety@ft.com",
+			UUIDs:      []string{"testTypeMetadata"},
+		},
+		{
+			ID:         "urn:x-change:2017-06-06T14-42-11.884Zderek.kettlety@ft.com",
+			Committed:  time.Date(2017, 6, 6, 14, 42, 11, 884000000, time.UTC),
+			ChangeType: "metadata-added",
+			Author:     "derek.kettlety@ft.com",
+			UUIDs:      []string{"fd55c1f0-6c5e-4869-aed4-6816836ffdb9"},
+		},
+	}, changes.Changesets)
+}
+
+func TestClient_GetConceptChanges_Events(t *testing.T) {
+	conceptResponse, err := ioutil.ReadFile("testdata/get-change-events.json")
+	require.NoError(t, err)
+
+	sl, err := NewSmartlogicTestClient(&mockHTTPClient{resp: string(conceptResponse), statusCode: http.StatusOK},
+		"http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+
+	changes, err := sl.GetConceptChanges(time.Now())
+	require.NoError(t, err)
+
+	const (
+		created  = "a0b1c2d3-0000-4000-8000-000000000001"
+		modified = "a0b1c2d3-0000-4000-8000-000000000002"
+		deleted  = "a0b1c2d3-0000-4000-8000-000000000003"
+		merged   = "a0b1c2d3-0000-4000-8000-000000000004"
+	)
+	at := func(minute int) time.Time {
+		return time.Date(2020, 4, 5, 10, minute, 0, 0, time.UTC)
+	}
+	assert.Equal(t, []ChangeEvent{
+		{UUID: created, Type: ChangeCreated, Changeset: "urn:x-change:2020-04-05T10-00-00.000Zjane.doe@ft.com", Author: "jane.doe@ft.com", Committed: at(0)},
+		{UUID: modified, Type: ChangeModified, Changeset: "urn:x-change:2020-04-05T10-01-00.000Zjane.doe@ft.com", Author: "jane.doe@ft.com", Committed: at(1)},
+		{UUID: deleted, Type: ChangeDeleted, Changeset: "urn:x-change:2020-04-05T10-02-00.000Zjohn.doe@ft.com", Author: "john.doe@ft.com", Committed: at(2)},
+		{UUID: merged, Type: ChangeMerged, Changeset: "urn:x-change:2020-04-05T10-03-00.000Zjohn.doe@ft.com", Author: "john.doe@ft.com", Committed: at(3), MergedInto: modified},
+		{UUID: modified, Type: ChangeModified, Changeset: "urn:x-change:2020-04-05T10-03-00.000Zjohn.doe@ft.com", Author: "john.doe@ft.com", Committed: at(3)},
+	}, changes.Events)
+
+	latest := changes.LatestEvents()
+	assert.Len(t, latest, 4)
+	assert.Equal(t, at(3), latest[modified].Committed)
+	assert.True(t, latest[deleted].Type.Removed())
+	assert.True(t, latest[merged].Type.Removed())
+	assert.False(t, latest[created].Type.Removed())
+}
+
+func TestClient_GetConceptChanges_InvalidResponses(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		expectedError error
+	}{
+		{name: "error page", status: http.StatusInternalServerError, body: "<html>Internal Server Error</html>", expectedError: ErrUpstream},
+		{name: "auth error", status: http.StatusForbidden, body: `{"error": "insufficient_scope"}`, expectedError: ErrUpstream},
+		{name: "html with 200", status: http.StatusOK, body: "<html>Maintenance</html>", expectedError: ErrInvalidResponse},
+		{name: "json without graph", status: http.StatusOK, body: `{"error": "invalid_token"}`, expectedError: ErrInvalidResponse},
+		{name: "null graph", status: http.StatusOK, body: `{"@graph": null}`, expectedError: ErrInvalidResponse},
+		{name: "changeset without id", status: http.StatusOK, body: `{"@graph": [{"sem:about": [{"@id": "http://www.ft.com/thing/1"}]}]}`, expectedError: ErrInvalidResponse},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sl, err := NewSmartlogicTestClient(&mockHTTPClient{resp: test.body, statusCode: test.status},
+				"http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+			require.NoError(t, err)
+
+			_, err = sl.GetConceptChanges(time.Now())
+			assert.ErrorIs(t, err, test.expectedError)
+			var slErr *Error
+			require.ErrorAs(t, err, &slErr)
+			assert.Equal(t, test.status, slErr.StatusCode)
+			assert.Equal(t, test.body, slErr.Body)
+		})
+	}
+}
+
+func TestClient_GetConceptChanges_LastCommitted(t *testing.T) {
+	conceptResponse, err := ioutil.ReadFile("testdata/get-changed-concepts.json")
+	assert.NoError(t, err)
+
+	sl, err := NewSmartlogicTestClient(
+		&mockHTTPClient{
+			resp:       string(conceptResponse),
+			statusCode: http.StatusOK,
+			err:        nil,
+		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+	)
+	assert.NoError(t, err)
+
+	changes, err := sl.GetConceptChanges(time.Now())
+	assert.NoError(t, err)
+
+	expectedLastCommitted := time.Date(2017, 6, 6, 14, 42, 11, 884000000, time.UTC)
+	assert.True(t, expectedLastCommitted.Equal(changes.LastCommitted), "unexpected last committed time %v", changes.LastCommitted)
+	assert.Len(t, changes.UUIDs, 2)
+
+	assert.Len(t, changes.Committed, 2)
+	assert.True(t, expectedLastCommitted.Equal(changes.Committed["fd55c1f0-6c5e-4869-aed4-6816836ffdb9"]))
+	assert.True(t, time.Date(2017, 6, 6, 14, 36, 28, 971000000, time.UTC).Equal(changes.Committed["testTypeMetadata"]))
+}
+
 func TestClient_GetChangedConceptList_RequestError(t *testing.T) {
 	conceptResponse, err := ioutil.ReadFile("testdata/get-changed-concepts.json")
 	assert.NoError(t, err)
@@ -293,8 +435,8 @@ func TestClient_GetChangedConceptList_RequestError(t *testing.T) {
 	assert.NoError(t, err)
 
 	response, err := sl.GetChangedConceptList(time.Now())
-	assert.Error(t, err)
-	assert.Equal(t, requestError, err)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, requestError)
 	assert.Empty(t, response)
 }
 
@@ -311,8 +453,9 @@ func TestClient_GetChangedConceptList_BadResponseBody(t *testing.T) {
 	assert.NoError(t, err)
 
 	response, err := sl.GetChangedConceptList(time.Now())
-	assert.Error(t, err)
-	assert.IsType(t, &json.SyntaxError{}, err)
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+	var syntaxErr *json.SyntaxError
+	assert.ErrorAs(t, err, &syntaxErr)
 	assert.Empty(t, response)
 }
 
@@ -323,13 +466,248 @@ func TestClient_buildChangesAPIQueryParams(t *testing.T) {
 	client, err := NewSmartlogicTestClient(&mockHTTPClient{}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
 	assert.NoError(t, err)
 
-	queryParams := client.buildChangesAPIQueryParams(changeDate)
+	queryParams := client.buildChangesAPIQueryParams(ChangesKey{Since: changeDate}, 0)
 	assert.Contains(t, queryParams, "path")
 	assert.Equal(t, queryParams.Get("path"), "tchmodel:modelName/teamwork:Change/rdf:instance")
 
 	assert.Contains(t, queryParams, "properties")
-	assert.Equal(t, queryParams.Get("properties"), "sem:about")
+	assert.Equal(t, queryParams.Get("properties"), "sem:about,sem:committed,sioc:has_creator,rdfs:comment,"+
+		"teamwork:added/teamwork:subject,teamwork:added/teamwork:predicate,teamwork:deleted/teamwork:subject,teamwork:deleted/teamwork:predicate")
 
 	assert.Contains(t, queryParams, "filters")
 	assert.Equal(t, queryParams.Get("filters"), "subject(sem:committed>\"2020-04-27T00:00:00.000Z\"^^xsd:dateTime)")
+	assert.Equal(t, "sem:committed", queryParams.Get("sort"))
+	assert.NotContains(t, queryParams, "limit")
+	assert.NotContains(t, queryParams, "offset")
+
+	// the changesets committed at the time of the key are requested again when some of them were read
+	queryParams = client.buildChangesAPIQueryParams(ChangesKey{Since: changeDate, Seen: []string{"urn:x-change:1"}}, 100)
+	assert.Equal(t, "subject(sem:committed>=\"2020-04-27T00:00:00.000Z\"^^xsd:dateTime)", queryParams.Get("filters"))
+	assert.Equal(t, "101", queryParams.Get("limit"))
+	assert.NotContains(t, queryParams, "offset")
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	sl, err := NewSmartlogicClient(
+		&mockHTTPClient{
+			resp:       "{\"access_token\": \"1234567890\", \"@graph\": []}",
+			statusCode: http.StatusOK,
+		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+		logger.NewUnstructuredLogger(),
+		WithRateLimit(10),
+	)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		_, err = sl.GetChangedConceptList(time.Now())
+		assert.NoError(t, err)
+	}
+	// the first 10 requests use up the burst, the following 5 are spread over half a second
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestClient_GetConceptPage(t *testing.T) {
+	client, err := NewSmartlogicTestClient(&mockHTTPClient{
+		resp: `{"@graph":[
+			{"@id":"http://www.ft.com/thing/02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11", "sem:guid": [{"@value": "02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11"}]},
+			{"@id":"http://www.ft.com/ontology/managedlocation/9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f", "sem:guid": [{"@value": "9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f"}]},
+			{"@id":"http://www.ft.com/thing/ConceptScheme/a8a8a8a8-0000-0000-0000-000000000000", "sem:guid": [{"@value": "a8a8a8a8-0000-0000-0000-000000000000"}]}
+		]}`,
+		statusCode: http.StatusOK,
+	}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	assert.NoError(t, err)
+
+	page, err := client.GetConceptPage("", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Size)
+	assert.Equal(t, []string{"02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11", "9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f"}, page.UUIDs)
+	// the next page starts after the last entry, even if it is not an FT concept
+	assert.Equal(t, "a8a8a8a8-0000-0000-0000-000000000000", page.Last)
+}
+
+func TestClient_GetConceptPage_ErrorStatus(t *testing.T) {
+	client, err := NewSmartlogicTestClient(&mockHTTPClient{
+		resp:       "",
+		statusCode: http.StatusInternalServerError,
+	}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	assert.NoError(t, err)
+
+	_, err = client.GetConceptPage("", 3)
+	assert.Error(t, err)
+}
+
+func TestClient_buildConceptsAPIQueryParams(t *testing.T) {
+	client, err := NewSmartlogicTestClient(&mockHTTPClient{}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	assert.NoError(t, err)
+
+	queryParams := client.buildConceptsAPIQueryParams("", 100)
+	assert.Equal(t, "tchmodel:modelName/skos:Concept/meta:transitiveInstance", queryParams.Get("path"))
+	assert.Equal(t, "sem:guid", queryParams.Get("properties"))
+	assert.Equal(t, "sem:guid", queryParams.Get("sort"))
+	assert.Equal(t, "100", queryParams.Get("limit"))
+	assert.Empty(t, queryParams.Get("filters"))
+	assert.Empty(t, queryParams.Get("offset"))
+
+	queryParams = client.buildConceptsAPIQueryParams("02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11", 100)
+	assert.Equal(t, `subject(sem:guid>"02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11")`, queryParams.Get("filters"))
+}
+
+// changesetsServer serves the changesets, like Smartlogic with the sem:committed filter, the sort and the limit parameters.
+// The changesets can be changed between the requests, like when editors commit changes while paging.
+type changesetsServer struct {
+	changesets []testChangeset
+	filters    []string
+}
+
+type testChangeset struct {
+	uuid      string
+	committed time.Time
+}
+
+var filterPattern = regexp.MustCompile(`^subject\(sem:committed(>=?)"([^"]+)"\^\^xsd:dateTime\)$`)
+
+func (s *changesetsServer) Do(req *http.Request) (*http.Response, error) {
+	q := req.URL.Query()
+	s.filters = append(s.filters, q.Get("filters"))
+	match := filterPattern.FindStringSubmatch(q.Get("filters"))
+	if match == nil {
+		return newResponse(http.StatusBadRequest, ""), nil
+	}
+	since, err := time.Parse(slTimeFormat, match[2])
+	if err != nil {
+		return newResponse(http.StatusBadRequest, ""), nil
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		return newResponse(http.StatusBadRequest, ""), nil
+	}
+
+	var ids []int
+	for i, c := range s.changesets {
+		if c.committed.After(since) || (match[1] == ">=" && c.committed.Equal(since)) {
+			ids = append(ids, i)
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return s.changesets[ids[i]].committed.Before(s.changesets[ids[j]].committed)
+	})
+	var changesets []string
+	for _, i := range ids {
+		if len(changesets) == limit {
+			break
+		}
+		changesets = append(changesets, fmt.Sprintf(`{"@id": "urn:x-change:%d", "sem:about": [{"@id": "http://www.ft.com/thing/%s"}],
+			"sem:committed": [{"@value": "%s"}]}`, i, s.changesets[i].uuid, s.changesets[i].committed.Format(slTimeFormat)))
+	}
+	return newResponse(http.StatusOK, `{"@graph": [`+strings.Join(changesets, ",")+`]}`), nil
+}
+
+// changesPages serves a changeset for every given concept uuid, committed a second apart.
+func changesPages(uuids ...string) *changesetsServer {
+	server := &changesetsServer{}
+	for i, uuid := range uuids {
+		server.changesets = append(server.changesets, testChangeset{uuid: uuid, committed: changesStart.Add(time.Duration(i) * time.Second)})
+	}
+	return server
+}
+
+var changesStart = time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+
+func TestClient_StreamConceptChanges(t *testing.T) {
+	server := changesPages("1", "2", "3", "1", "4")
+	sl, err := NewSmartlogicTestClient(server, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+	sl.changesPageSize = 2
+
+	var pages [][]string
+	err = sl.StreamConceptChanges(changesStart.Add(-time.Second), func(page ConceptChanges) error {
+		sort.Strings(page.UUIDs)
+		pages = append(pages, page.UUIDs)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"1", "2"}, {"1", "3"}, {"4"}}, pages)
+	// every page is requested from the last change of the previous one
+	assert.Equal(t, []string{
+		`subject(sem:committed>"2020-04-05T09:59:59.000Z"^^xsd:dateTime)`,
+		`subject(sem:committed>="2020-04-05T10:00:01.000Z"^^xsd:dateTime)`,
+		`subject(sem:committed>="2020-04-05T10:00:03.000Z"^^xsd:dateTime)`,
+	}, server.filters)
+}
+
+func TestClient_StreamConceptChanges_ChangesCommittedWhilePaging(t *testing.T) {
+	server := changesPages("1", "2", "3")
+	sl, err := NewSmartlogicTestClient(server, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+	sl.changesPageSize = 2
+
+	var changed []string
+	err = sl.StreamConceptChanges(changesStart.Add(-time.Second), func(page ConceptChanges) error {
+		for _, changeset := range page.Changesets {
+			changed = append(changed, changeset.UUIDs...)
+		}
+		if len(server.filters) == 1 {
+			// a change committed while paging is read once, after the ones committed before it
+			server.changesets = append(server.changesets, testChangeset{uuid: "4", committed: changesStart.Add(time.Minute)})
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, changed)
+}
+
+func TestClient_StreamConceptChanges_ChangesCommittedAtTheSameTime(t *testing.T) {
+	server := changesPages("1")
+	for _, uuid := range []string{"2", "3", "4", "5"} {
+		server.changesets = append(server.changesets, testChangeset{uuid: uuid, committed: changesStart.Add(time.Second)})
+	}
+	sl, err := NewSmartlogicTestClient(server, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+	sl.changesPageSize = 2
+
+	var changed []string
+	err = sl.StreamConceptChanges(changesStart.Add(-time.Second), func(page ConceptChanges) error {
+		for _, changeset := range page.Changesets {
+			changed = append(changed, changeset.UUIDs...)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	// the changesets committed at the time the page ends are requested again, the ones read already are skipped
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, changed)
+}
+
+func TestClient_GetConceptChanges_MergesPages(t *testing.T) {
+	server := changesPages("1", "2", "3", "1")
+	sl, err := NewSmartlogicTestClient(server, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+	sl.changesPageSize = 2
+
+	changes, err := sl.GetConceptChanges(changesStart.Add(-time.Second))
+	require.NoError(t, err)
+	// the last page is full, so an empty page is requested to find out that there are no more changes
+	assert.Len(t, server.filters, 3)
+
+	sort.Strings(changes.UUIDs)
+	assert.Equal(t, []string{"1", "2", "3"}, changes.UUIDs)
+	assert.Equal(t, 4, changes.Size)
+	assert.Len(t, changes.Changesets, 4)
+	assert.Equal(t, time.Date(2020, 4, 5, 10, 0, 3, 0, time.UTC), changes.LastCommitted)
+	assert.Equal(t, time.Date(2020, 4, 5, 10, 0, 3, 0, time.UTC), changes.Committed["1"])
+	assert.Equal(t, time.Date(2020, 4, 5, 10, 0, 1, 0, time.UTC), changes.Committed["2"])
+}
+
+func TestClient_StreamConceptChanges_StopsAtError(t *testing.T) {
+	server := changesPages("1", "2", "3", "4", "5")
+	sl, err := NewSmartlogicTestClient(server, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+	sl.changesPageSize = 2
+
+	stop := errors.New("stop")
+	err = sl.StreamConceptChanges(changesStart.Add(-time.Second), func(page ConceptChanges) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Len(t, server.filters, 1)
 }
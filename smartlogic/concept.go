@@ -0,0 +1,233 @@
+package smartlogic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The properties of the json-ld concepts which are mapped to the UPP concept model.
+const (
+	guidProperty       = "sem:guid"
+	prefLabelProperty  = "skosxl:prefLabel"
+	altLabelProperty   = "skosxl:altLabel"
+	shortLabelProperty = "http://www.ft.com/ontology/shortLabel"
+	literalFormKey     = "skosxl:literalForm"
+	broaderProperty    = "skos:broader"
+	narrowerProperty   = "skos:narrower"
+	relatedProperty    = "skos:related"
+
+	ftOntologyPrefix = "http://www.ft.com/ontology/"
+	identifierSuffix = "Identifier"
+)
+
+// Concept is a Smartlogic concept in the UPP concept model, so that the consumers do not have to parse the json-ld.
+// Type is the name of the class of the concept, e.g. Organisation. Aliases are the alternative labels of the concept.
+// The broader, narrower and related concepts are referred to by their uuid, the ones outside of the published
+// namespaces are left out. Identifiers holds the values of the identifier properties by their name, e.g. TMEIdentifier.
+type Concept struct {
+	UUID          string              `json:"uuid"`
+	Type          string              `json:"type"`
+	PrefLabel     string              `json:"prefLabel"`
+	ShortLabel    string              `json:"shortLabel,omitempty"`
+	Aliases       []string            `json:"aliases,omitempty"`
+	BroaderUUIDs  []string            `json:"broaderUUIDs,omitempty"`
+	NarrowerUUIDs []string            `json:"narrowerUUIDs,omitempty"`
+	RelatedUUIDs  []string            `json:"relatedUUIDs,omitempty"`
+	Identifiers   map[string][]string `json:"identifiers,omitempty"`
+}
+
+// jsonldNode is a node of a json-ld graph, by property.
+type jsonldNode map[string]json.RawMessage
+
+// jsonldValue is a value of a json-ld property, either a literal or a reference to another node.
+// The labels returned by Smartlogic are references which embed their literal form.
+type jsonldValue struct {
+	ID          string        `json:"@id"`
+	Value       string        `json:"@value"`
+	Language    string        `json:"@language"`
+	LiteralForm []jsonldValue `json:"skosxl:literalForm"`
+}
+
+func (n jsonldNode) id() string {
+	var id string
+	_ = json.Unmarshal(n["@id"], &id)
+	return id
+}
+
+// values returns the values of the given property, a property which is not a list of values has none.
+func (n jsonldNode) values(property string) []jsonldValue {
+	var values []jsonldValue
+	if raw, ok := n[property]; ok {
+		_ = json.Unmarshal(raw, &values)
+	}
+	return values
+}
+
+// ConceptDocument is the json-ld representation of a concept returned by GetConcept, with its labels resolved.
+// ID is the URI of the concept and GUID its sem:guid, Types are the URIs of its classes.
+type ConceptDocument struct {
+	ID         string
+	GUID       string
+	Types      []string
+	PrefLabels []string
+}
+
+// ParseConceptDocument reads the first node of the json-ld graph of a concept, i.e. the concept itself.
+func ParseConceptDocument(body []byte) (ConceptDocument, error) {
+	node, nodes, err := parseConceptGraph(body)
+	if err != nil {
+		return ConceptDocument{}, err
+	}
+
+	doc := ConceptDocument{ID: node.id()}
+	for _, guid := range node.values(guidProperty) {
+		doc.GUID = guid.Value
+	}
+	_ = json.Unmarshal(node["@type"], &doc.Types)
+	for _, label := range labels(node.values(prefLabelProperty), nodes) {
+		if label.Value != "" {
+			doc.PrefLabels = append(doc.PrefLabels, label.Value)
+		}
+	}
+	return doc, nil
+}
+
+// parseConceptGraph returns the concept node of the json-ld graph of a concept together with all the nodes by id,
+// as the labels may be separate nodes of the graph instead of being embedded in the concept.
+func parseConceptGraph(body []byte) (jsonldNode, map[string]jsonldNode, error) {
+	var graph struct {
+		Nodes []jsonldNode `json:"@graph"`
+	}
+	if err := json.Unmarshal(body, &graph); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the concept: %w", err)
+	}
+	if len(graph.Nodes) == 0 {
+		return nil, nil, errors.New("the concept has no @graph")
+	}
+
+	nodes := make(map[string]jsonldNode, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		nodes[node.id()] = node
+	}
+	return graph.Nodes[0], nodes, nil
+}
+
+// ParseConcept maps the json-ld representation of a concept returned by GetConcept to the UPP concept model.
+// The uris are used to get the uuids of the related concepts, a nil registry accepts the FT things and managed locations.
+func ParseConcept(body []byte, uris *URIRegistry) (Concept, error) {
+	if uris == nil {
+		uris, _ = NewURIRegistry(DefaultURINamespaces(), nil)
+	}
+
+	node, nodes, err := parseConceptGraph(body)
+	if err != nil {
+		return Concept{}, err
+	}
+
+	concept := Concept{}
+	for _, guid := range node.values(guidProperty) {
+		concept.UUID = guid.Value
+	}
+	if concept.UUID == "" {
+		if id, ok := uris.Resolve(node.id()); ok {
+			concept.UUID = id.ID
+		}
+	}
+	if concept.UUID == "" {
+		return Concept{}, fmt.Errorf("the concept %v has no uuid", node.id())
+	}
+
+	var types []string
+	_ = json.Unmarshal(node["@type"], &types)
+	if len(types) > 0 {
+		concept.Type = localName(types[0])
+	}
+
+	concept.PrefLabel = preferredLiteral(labels(node.values(prefLabelProperty), nodes))
+	if concept.PrefLabel == "" {
+		return Concept{}, fmt.Errorf("the concept %v has no prefLabel", concept.UUID)
+	}
+	concept.ShortLabel = preferredLiteral(labels(node.values(shortLabelProperty), nodes))
+	for _, alias := range labels(node.values(altLabelProperty), nodes) {
+		concept.Aliases = append(concept.Aliases, alias.Value)
+	}
+
+	concept.BroaderUUIDs = relatedUUIDs(node.values(broaderProperty), uris)
+	concept.NarrowerUUIDs = relatedUUIDs(node.values(narrowerProperty), uris)
+	concept.RelatedUUIDs = relatedUUIDs(node.values(relatedProperty), uris)
+
+	for property := range node {
+		if !strings.HasPrefix(property, ftOntologyPrefix) || !strings.HasSuffix(property, identifierSuffix) {
+			continue
+		}
+		for _, v := range node.values(property) {
+			if v.Value == "" {
+				continue
+			}
+			if concept.Identifiers == nil {
+				concept.Identifiers = map[string][]string{}
+			}
+			name := localName(property)
+			concept.Identifiers[name] = append(concept.Identifiers[name], v.Value)
+		}
+	}
+	return concept, nil
+}
+
+// labels returns the literal forms of the given labels, looking up the labels which are not embedded in the graph.
+func labels(values []jsonldValue, nodes map[string]jsonldNode) []jsonldValue {
+	var literals []jsonldValue
+	for _, v := range values {
+		forms := v.LiteralForm
+		if len(forms) == 0 && v.ID != "" {
+			if node, ok := nodes[v.ID]; ok {
+				forms = node.values(literalFormKey)
+			}
+		}
+		if len(forms) == 0 && v.Value != "" {
+			forms = []jsonldValue{v}
+		}
+		literals = append(literals, forms...)
+	}
+	return literals
+}
+
+// preferredLiteral returns the English literal, or the first one if none is in English.
+func preferredLiteral(literals []jsonldValue) string {
+	for _, l := range literals {
+		if l.Language == "en" {
+			return l.Value
+		}
+	}
+	if len(literals) > 0 {
+		return literals[0].Value
+	}
+	return ""
+}
+
+// relatedUUIDs returns the sorted ids of the referenced concepts which are in the accepted namespaces.
+// The concept schemes are not concepts, so they are left out.
+func relatedUUIDs(values []jsonldValue, uris *URIRegistry) []string {
+	var uuids []string
+	for _, v := range values {
+		if strings.Contains(v.ID, "ConceptScheme") {
+			continue
+		}
+		if id, ok := uris.Resolve(v.ID); ok {
+			uuids = append(uuids, id.ID)
+		}
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+// localName returns the last segment of the given URI, e.g. Organisation for http://www.ft.com/ontology/organisation/Organisation.
+func localName(uri string) string {
+	if i := strings.LastIndexAny(uri, "/#:"); i >= 0 {
+		return uri[i+1:]
+	}
+	return uri
+}
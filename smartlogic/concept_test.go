@@ -0,0 +1,94 @@
+package smartlogic
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConcept(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		expected Concept
+	}{
+		{
+			name:    "brand",
+			fixture: "testdata/get-concept.json",
+			expected: Concept{
+				UUID:        "2d3e16e0-61cb-4322-8aff-3b01c59f4daa",
+				Type:        "Brand",
+				PrefLabel:   "Lex",
+				Identifiers: map[string][]string{"TMEIdentifier": {"YzhlNzZkYTctMDJiNy00NTViLTk3NmYtNmJjYTE5NDEyM2Yw-QnJhbmRz"}},
+			},
+		},
+		{
+			name:    "labels, relations and identifiers",
+			fixture: "testdata/rich-concept.json",
+			expected: Concept{
+				UUID:          "6a2a0170-6afa-4bcc-b427-430268d2ac50",
+				Type:          "Topic",
+				PrefLabel:     "Brexit negotiations",
+				ShortLabel:    "Brexit",
+				Aliases:       []string{"UK exit from the EU", "British exit"},
+				BroaderUUIDs:  []string{"c91b1fad-1097-468b-be82-9a8ff717d54c"},
+				NarrowerUUIDs: []string{"0e4c8a3c-0b1a-4d4c-9f5f-7c3d3e9c7a11", "f5b1e1d6-6f4d-4e1e-a4c5-0d62e7a2e3f0"},
+				RelatedUUIDs:  []string{"GB"},
+				Identifiers: map[string][]string{
+					"TMEIdentifier":      {"Mzk1ODk5-VG9waWNz", "NTI0NDk5-VG9waWNz"},
+					"wikidataIdentifier": {"Q5885"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := ioutil.ReadFile(test.fixture)
+			require.NoError(t, err)
+
+			concept, err := ParseConcept(body, nil)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, concept)
+		})
+	}
+}
+
+func TestParseConcept_Invalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		expectedError string
+	}{
+		{name: "not json", body: "<html></html>", expectedError: "failed to parse the concept"},
+		{name: "empty graph", body: `{"@graph": []}`, expectedError: "the concept has no @graph"},
+		{name: "no uuid", body: `{"@graph": [{"@id": "http://unknown.example.com/thing/1"}]}`, expectedError: "has no uuid"},
+		{name: "no prefLabel", body: `{"@graph": [{"@id": "http://www.ft.com/thing/1", "sem:guid": [{"@value": "1"}]}]}`, expectedError: "the concept 1 has no prefLabel"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseConcept([]byte(test.body), nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedError)
+		})
+	}
+}
+
+func TestParseConceptDocument(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/rich-concept.json")
+	require.NoError(t, err)
+
+	doc, err := ParseConceptDocument(body)
+	require.NoError(t, err)
+	assert.Equal(t, ConceptDocument{
+		ID:         "http://www.ft.com/thing/6a2a0170-6afa-4bcc-b427-430268d2ac50",
+		GUID:       "6a2a0170-6afa-4bcc-b427-430268d2ac50",
+		Types:      []string{"http://www.ft.com/ontology/Topic"},
+		PrefLabels: []string{"Le Brexit", "Brexit negotiations"},
+	}, doc)
+
+	_, err = ParseConceptDocument([]byte(`{"@graph": []}`))
+	assert.EqualError(t, err, "the concept has no @graph")
+}
@@ -0,0 +1,179 @@
+package smartlogic
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBodySnippet is how much of the body of a failed response is kept in the error.
+const maxBodySnippet = 512
+
+// ErrorKind classifies the failures of the requests to Smartlogic.
+type ErrorKind string
+
+const (
+	// KindUnauthorized is Smartlogic rejecting the access token.
+	KindUnauthorized ErrorKind = "unauthorized"
+	// KindRateLimited is Smartlogic rejecting the request because too many requests were made.
+	KindRateLimited ErrorKind = "rate_limited"
+	// KindUpstream is Smartlogic failing with a 5xx status other than the gateway ones or with a status which is not expected.
+	KindUpstream ErrorKind = "upstream"
+	// KindTimeout is Smartlogic not responding in time.
+	KindTimeout ErrorKind = "timeout"
+	// KindUnavailable is Smartlogic not being reachable, or responding with 502, 503 or 504.
+	KindUnavailable ErrorKind = "unavailable"
+	// KindInvalidResponse is Smartlogic responding with a body which is not the expected json-ld.
+	KindInvalidResponse ErrorKind = "invalid_response"
+	// KindNotFound is the requested concept not existing in Smartlogic.
+	KindNotFound ErrorKind = "not_found"
+)
+
+// The sentinel errors matching the kinds of Error with errors.Is. ErrUnauthorized and ErrorConceptDoesNotExist are declared with the client.
+var (
+	ErrRateLimited     = errors.New("smartlogic rate limited the request")
+	ErrUpstream        = errors.New("smartlogic failed")
+	ErrTimeout         = errors.New("smartlogic timed out")
+	ErrUnavailable     = errors.New("smartlogic is unavailable")
+	ErrInvalidResponse = errors.New("smartlogic returned an invalid response")
+)
+
+var kindSentinels = map[ErrorKind]error{
+	KindUnauthorized:    ErrUnauthorized,
+	KindRateLimited:     ErrRateLimited,
+	KindUpstream:        ErrUpstream,
+	KindTimeout:         ErrTimeout,
+	KindUnavailable:     ErrUnavailable,
+	KindInvalidResponse: ErrInvalidResponse,
+	KindNotFound:        ErrorConceptDoesNotExist,
+}
+
+// Error is a failed request to Smartlogic. StatusCode and Body are the status and the beginning of the body
+// of the Smartlogic response, if there was one. RetryAfter is how long Smartlogic asked to wait before retrying, if it did.
+type Error struct {
+	Kind       ErrorKind
+	Op         string
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+	Msg        string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	var msg string
+	switch {
+	case e.Msg != "":
+		msg = e.Msg
+	case e.StatusCode != 0:
+		msg = fmt.Sprintf("smartlogic returned status %v", e.StatusCode)
+	case kindSentinels[e.Kind] != nil:
+		msg = kindSentinels[e.Kind].Error()
+	default:
+		msg = "smartlogic request failed"
+	}
+	if e.Op != "" {
+		msg += " " + e.Op
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error of the kind of the error.
+func (e *Error) Is(target error) bool {
+	sentinel, ok := kindSentinels[e.Kind]
+	return ok && sentinel == target
+}
+
+// errorKind returns the kind of the given error, or nothing if it is not an Error.
+func errorKind(err error) ErrorKind {
+	var slErr *Error
+	if errors.As(err, &slErr) {
+		return slErr.Kind
+	}
+	return ""
+}
+
+// withOp sets the operation which failed on the given error, if it is an Error without one.
+func withOp(err error, op string) error {
+	var slErr *Error
+	if errors.As(err, &slErr) && slErr.Op == "" {
+		withOp := *slErr
+		withOp.Op = op
+		return &withOp
+	}
+	return err
+}
+
+// statusError returns the error for the given unsuccessful Smartlogic response. The body of the response is read.
+func statusError(resp *http.Response, op string) *Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySnippet))
+	e := &Error{
+		Kind:       KindUpstream,
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		Body:       bodySnippet(body),
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		e.Kind = KindUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		e.Kind = KindNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = KindRateLimited
+	case resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		e.Kind = KindUnavailable
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return e
+}
+
+// transportError returns the error for a request to Smartlogic which got no response.
+func transportError(err error) *Error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &Error{Kind: KindTimeout, Err: err}
+	}
+	return &Error{Kind: KindUnavailable, Err: err}
+}
+
+// invalidResponseError returns the error for a Smartlogic response which is not the expected json-ld.
+func invalidResponseError(msg string, body []byte, err error) *Error {
+	return &Error{Kind: KindInvalidResponse, StatusCode: http.StatusOK, Body: bodySnippet(body), Msg: msg, Err: err}
+}
+
+func bodySnippet(body []byte) string {
+	if len(body) > maxBodySnippet {
+		body = body[:maxBodySnippet]
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or a date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
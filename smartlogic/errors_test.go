@@ -0,0 +1,188 @@
+package smartlogic
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClient_GetConcept_TypedErrors(t *testing.T) {
+	tests := []struct {
+		name               string
+		httpClient         httpClient
+		expectedKind       ErrorKind
+		expectedSentinel   error
+		expectedStatus     int
+		expectedBody       string
+		expectedRetryAfter time.Duration
+		expectedError      string
+	}{
+		{
+			name: "rate limited",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				resp := newResponse(http.StatusTooManyRequests, "slow down")
+				resp.Header = http.Header{"Retry-After": []string{"30"}}
+				return resp, nil
+			}),
+			expectedKind:       KindRateLimited,
+			expectedSentinel:   ErrRateLimited,
+			expectedStatus:     http.StatusTooManyRequests,
+			expectedBody:       "slow down",
+			expectedRetryAfter: 30 * time.Second,
+			expectedError:      "smartlogic returned status 429 getting concept with uuid test-uuid",
+		},
+		{
+			name: "upstream failure",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return newResponse(http.StatusInternalServerError, "<html>internal server error</html>"), nil
+			}),
+			expectedKind:     KindUpstream,
+			expectedSentinel: ErrUpstream,
+			expectedStatus:   http.StatusInternalServerError,
+			expectedBody:     "<html>internal server error</html>",
+			expectedError:    "smartlogic returned status 500 getting concept with uuid test-uuid",
+		},
+		{
+			name: "gateway failure",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return newResponse(http.StatusBadGateway, "<html>bad gateway</html>"), nil
+			}),
+			expectedKind:     KindUnavailable,
+			expectedSentinel: ErrUnavailable,
+			expectedStatus:   http.StatusBadGateway,
+			expectedBody:     "<html>bad gateway</html>",
+			expectedError:    "smartlogic returned status 502 getting concept with uuid test-uuid",
+		},
+		{
+			name: "service unavailable",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				resp := newResponse(http.StatusServiceUnavailable, "down for maintenance")
+				resp.Header = http.Header{"Retry-After": []string{"120"}}
+				return resp, nil
+			}),
+			expectedKind:       KindUnavailable,
+			expectedSentinel:   ErrUnavailable,
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedBody:       "down for maintenance",
+			expectedRetryAfter: 2 * time.Minute,
+			expectedError:      "smartlogic returned status 503 getting concept with uuid test-uuid",
+		},
+		{
+			name: "gateway timeout",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return newResponse(http.StatusGatewayTimeout, "upstream timed out"), nil
+			}),
+			expectedKind:     KindUnavailable,
+			expectedSentinel: ErrUnavailable,
+			expectedStatus:   http.StatusGatewayTimeout,
+			expectedBody:     "upstream timed out",
+			expectedError:    "smartlogic returned status 504 getting concept with uuid test-uuid",
+		},
+		{
+			name: "not found",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return newResponse(http.StatusNotFound, "no such model"), nil
+			}),
+			expectedKind:     KindNotFound,
+			expectedSentinel: ErrorConceptDoesNotExist,
+			expectedStatus:   http.StatusNotFound,
+			expectedBody:     "no such model",
+			expectedError:    "smartlogic returned status 404 getting concept with uuid test-uuid",
+		},
+		{
+			name: "timeout",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return nil, timeoutError{}
+			}),
+			expectedKind:     KindTimeout,
+			expectedSentinel: ErrTimeout,
+			expectedError:    "smartlogic timed out getting concept with uuid test-uuid: i/o timeout",
+		},
+		{
+			name: "unavailable",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			}),
+			expectedKind:     KindUnavailable,
+			expectedSentinel: ErrUnavailable,
+			expectedError:    "smartlogic is unavailable getting concept with uuid test-uuid: connection refused",
+		},
+		{
+			name: "invalid json-ld",
+			httpClient: funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return newResponse(http.StatusOK, `{"@graph": "not a graph"}`), nil
+			}),
+			expectedKind:     KindInvalidResponse,
+			expectedSentinel: ErrInvalidResponse,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     `{"@graph": "not a graph"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sl, err := NewSmartlogicTestClient(test.httpClient, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+			require.NoError(t, err)
+
+			_, err = sl.GetConcept("test-uuid")
+			var slErr *Error
+			require.ErrorAs(t, err, &slErr)
+			assert.Equal(t, test.expectedKind, slErr.Kind)
+			assert.ErrorIs(t, err, test.expectedSentinel)
+			assert.Equal(t, test.expectedStatus, slErr.StatusCode)
+			assert.Equal(t, test.expectedBody, slErr.Body)
+			assert.Equal(t, test.expectedRetryAfter, slErr.RetryAfter)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestClient_GetConcept_NonExistingConcept(t *testing.T) {
+	slResponse, err := ioutil.ReadFile("testdata/non-existing-concept.json")
+	require.NoError(t, err)
+	sl, err := NewSmartlogicTestClient(&mockHTTPClient{resp: string(slResponse), statusCode: http.StatusOK},
+		"http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+
+	_, err = sl.GetConcept("test-uuid")
+	assert.ErrorIs(t, err, ErrorConceptDoesNotExist)
+	assert.EqualError(t, err, "concept with uuid test-uuid does not exist")
+}
+
+func TestStatusError_BodySnippet(t *testing.T) {
+	err := statusError(newResponse(http.StatusInternalServerError, strings.Repeat("a", 2*maxBodySnippet)), "")
+	assert.Len(t, err.Body, maxBodySnippet)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "120", expected: 2 * time.Minute},
+		{value: "Sun, 05 Apr 2020 10:00:45 GMT", expected: 45 * time.Second},
+		{value: "Sun, 05 Apr 2020 09:00:00 GMT", expected: 0},
+		{value: "soon", expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseRetryAfter(test.value, now))
+		})
+	}
+}
@@ -16,3 +16,14 @@ func (c mockHTTPClient) Do(req *http.Request) (resp *http.Response, err error) {
 	cb := ioutil.NopCloser(bytes.NewReader([]byte(c.resp)))
 	return &http.Response{Body: cb, StatusCode: c.statusCode}, c.err
 }
+
+// funcHTTPClient answers the requests with the given function.
+type funcHTTPClient func(req *http.Request) (*http.Response, error)
+
+func (f funcHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newResponse(statusCode int, body string) *http.Response {
+	return &http.Response{Body: ioutil.NopCloser(bytes.NewBufferString(body)), StatusCode: statusCode}
+}
@@ -1,13 +1,273 @@
 package smartlogic
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
 type Graph struct {
 	Changesets []Changeset `json:"@graph"`
 }
 
+// validate checks that the graph is a json-ld change list, so that an error body is not taken for an empty list.
+func (g *Graph) validate() error {
+	if g.Changesets == nil {
+		return errors.New("the response has no @graph")
+	}
+	for i, changeset := range g.Changesets {
+		if changeset.ID == "" {
+			return fmt.Errorf("the changeset at index %d has no @id", i)
+		}
+	}
+	return nil
+}
+
 type Changeset struct {
-	Concepts []ChangedConcept `json:"sem:about"`
+	ID        string           `json:"@id"`
+	Concepts  []ChangedConcept `json:"sem:about"`
+	Committed []DateTimeValue  `json:"sem:committed"`
+	Creators  []ChangedConcept `json:"sioc:has_creator"`
+	Comments  []DateTimeValue  `json:"rdfs:comment"`
+	Added     []Statement      `json:"teamwork:added"`
+	Deleted   []Statement      `json:"teamwork:deleted"`
+}
+
+// Statement is a triple added or deleted by a changeset. The object is not requested from Smartlogic.
+type Statement struct {
+	Subject   []ChangedConcept `json:"teamwork:subject"`
+	Predicate []ChangedConcept `json:"teamwork:predicate"`
+}
+
+// guidPredicates are the forms of the sem:guid predicate. Smartlogic adds the sem:guid of a concept when it is created
+// and deletes it when the concept is deleted.
+var guidPredicates = map[string]bool{
+	"sem:guid": true,
+	"http://www.smartlogic.com/2014/08/semaphore-core#guid": true,
+}
+
+// changesGUID tells whether one of the statements is about the sem:guid of the concept with the given URI.
+func changesGUID(statements []Statement, uri string) bool {
+	for _, statement := range statements {
+		if len(statement.Subject) == 0 || statement.Subject[0].URI != uri {
+			continue
+		}
+		for _, predicate := range statement.Predicate {
+			if guidPredicates[predicate.URI] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changeTypeOf returns what the changeset did to the concept with the given URI.
+// A concept which loses its sem:guid in a changeset with a merge template was merged into another concept.
+func (c Changeset) changeTypeOf(uri string) ChangeType {
+	added, deleted := changesGUID(c.Added, uri), changesGUID(c.Deleted, uri)
+	switch {
+	case deleted && !added && strings.Contains(c.changeType(), "merge"):
+		return ChangeMerged
+	case deleted && !added:
+		return ChangeDeleted
+	case added && !deleted:
+		return ChangeCreated
+	default:
+		return ChangeModified
+	}
+}
+
+// changeType returns the type of the change, which Smartlogic keeps as the template key of the comment of the changeset,
+// e.g. metadata-added.
+func (c Changeset) changeType() string {
+	for _, comment := range c.Comments {
+		var template struct {
+			TemplateKey string `json:"templateKey"`
+		}
+		if err := json.Unmarshal([]byte(comment.Value), &template); err == nil && template.TemplateKey != "" {
+			return template.TemplateKey
+		}
+	}
+	return ""
+}
+
+// author returns the user who made the change. Smartlogic identifies the users as user:<escaped email>.
+func (c Changeset) author() string {
+	if len(c.Creators) == 0 {
+		return ""
+	}
+	author := strings.TrimPrefix(c.Creators[0].URI, "user:")
+	if unescaped, err := url.PathUnescape(author); err == nil {
+		author = unescaped
+	}
+	return author
 }
 
 type ChangedConcept struct {
 	URI string `json:"@id"`
 }
+
+type DateTimeValue struct {
+	Value string `json:"@value"`
+}
+
+// ConceptChanges holds the uuids of the concepts changed since a point in time
+// together with the commit time of the latest of those changes.
+// Committed holds the commit time of the latest change of every concept, if Smartlogic returned one.
+// Changesets holds the changesets the changes were made in, in the order Smartlogic returned them.
+// Events holds a change event for every concept of every changeset, in the same order.
+// Size is the number of changesets Smartlogic returned, including the ones which are not about published concepts
+// and not counting the ones which were read already.
+// Next points at the changes which follow these ones and More tells whether there may be any.
+type ConceptChanges struct {
+	UUIDs         []string
+	LastCommitted time.Time
+	Committed     map[string]time.Time
+	Changesets    []ChangesetMetadata
+	Events        []ChangeEvent
+	Size          int
+	Next          ChangesKey
+	More          bool
+}
+
+// ChangesKey points at the changes which follow the ones already read, so that the changes can be paged through
+// while new ones are committed: the changes are the ones committed after Since, and the ones committed at Since
+// which are not Seen. Unlike an offset, the key is not shifted by the changes committed while paging.
+type ChangesKey struct {
+	Since time.Time `json:"since"`
+	// Seen are the ids of the changesets committed at Since which were already read
+	Seen []string `json:"seen,omitempty"`
+}
+
+// next returns the key of the changes following the given changesets, which follow the ones of the key.
+// The commit times are compared to the millisecond, which is the precision of the requests to Smartlogic.
+func (k ChangesKey) next(changesets []ChangesetMetadata) ChangesKey {
+	next := ChangesKey{Since: k.Since}
+	for _, changeset := range changesets {
+		if committed := changeset.Committed.Truncate(time.Millisecond); committed.After(next.Since) {
+			next.Since = committed
+		}
+	}
+	if next.Since.Equal(k.Since) {
+		next.Seen = append(next.Seen, k.Seen...)
+	}
+	for _, changeset := range changesets {
+		if changeset.Committed.Truncate(time.Millisecond).Equal(next.Since) {
+			next.Seen = append(next.Seen, changeset.ID)
+		}
+	}
+	return next
+}
+
+// LatestEvents returns the latest change event of every concept. Of the events committed at the same time,
+// the one Smartlogic returned last wins.
+func (c ConceptChanges) LatestEvents() map[string]ChangeEvent {
+	latest := make(map[string]ChangeEvent, len(c.UUIDs))
+	for _, event := range c.Events {
+		if previous, ok := latest[event.UUID]; ok && previous.Committed.After(event.Committed) {
+			continue
+		}
+		latest[event.UUID] = event
+	}
+	return latest
+}
+
+// merge adds the changes of the given page to the changes. Seen holds the uuids already in the changes.
+func (c *ConceptChanges) merge(page ConceptChanges, seen map[string]bool) {
+	for _, uuid := range page.UUIDs {
+		if !seen[uuid] {
+			seen[uuid] = true
+			c.UUIDs = append(c.UUIDs, uuid)
+		}
+		if committed, ok := page.Committed[uuid]; ok && committed.After(c.Committed[uuid]) {
+			c.Committed[uuid] = committed
+		}
+	}
+	if page.LastCommitted.After(c.LastCommitted) {
+		c.LastCommitted = page.LastCommitted
+	}
+	c.Changesets = append(c.Changesets, page.Changesets...)
+	c.Events = append(c.Events, page.Events...)
+	c.Size += page.Size
+	c.Next = page.Next
+}
+
+// ChangesetMetadata describes a changeset of the model. ChangeType and Author are empty if Smartlogic did not return them.
+// UUIDs holds the uuids of the concepts the changeset is about, without the ones which are not published.
+type ChangesetMetadata struct {
+	ID         string
+	Committed  time.Time
+	ChangeType string
+	Author     string
+	UUIDs      []string
+}
+
+// ChangeType is what a change did to a concept.
+type ChangeType string
+
+const (
+	ChangeCreated  ChangeType = "created"
+	ChangeModified ChangeType = "modified"
+	ChangeDeleted  ChangeType = "deleted"
+	ChangeMerged   ChangeType = "merged"
+)
+
+// Removed tells whether the concept no longer exists after the change.
+func (t ChangeType) Removed() bool {
+	return t == ChangeDeleted || t == ChangeMerged
+}
+
+// ChangeEvent is a change made to a concept in a changeset. Author is empty if Smartlogic did not return it.
+// MergedInto is the uuid of the concept a merged concept was merged into, if the changeset kept a single published concept.
+type ChangeEvent struct {
+	UUID       string
+	Type       ChangeType
+	Changeset  string
+	Author     string
+	Committed  time.Time
+	MergedInto string
+}
+
+type ConceptGraph struct {
+	Concepts []ModelConcept `json:"@graph"`
+}
+
+// ModelConcept is an entry of the list of the concepts in the model, with the guid the list is sorted by.
+type ModelConcept struct {
+	URI  string `json:"@id"`
+	GUID []struct {
+		Value string `json:"@value"`
+	} `json:"sem:guid"`
+}
+
+func (c ModelConcept) guid() string {
+	if len(c.GUID) == 0 {
+		return ""
+	}
+	return c.GUID[0].Value
+}
+
+// validate checks that the graph is a json-ld list of concepts, so that an error body is not taken for an empty page.
+func (g *ConceptGraph) validate() error {
+	if g.Concepts == nil {
+		return errors.New("the response has no @graph")
+	}
+	for i, concept := range g.Concepts {
+		if concept.URI == "" {
+			return fmt.Errorf("the concept at index %d has no @id", i)
+		}
+	}
+	return nil
+}
+
+// ConceptPage holds the uuids of a page of the concepts in the model.
+// Size is the number of entries Smartlogic returned for the page, including the ones which are not FT concepts.
+// Last is the guid of the last entry of the page, the next page starts after it.
+type ConceptPage struct {
+	UUIDs []string
+	Size  int
+	Last  string
+}
@@ -0,0 +1,178 @@
+package smartlogic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+// The types of the ids extracted from the concept URIs.
+const (
+	// IDTypeUUID is an id which has to be a UUID, the URIs with any other id are dropped.
+	IDTypeUUID = "uuid"
+	// IDTypeString is an id which can be any non-empty string.
+	IDTypeString = "string"
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// URINamespace is a namespace of the concept URIs which are published. A URI is in the namespace if it starts with
+// Prefix, in which case the id is the rest of the URI, or if it matches Pattern, in which case the id is the first
+// capture group of the pattern. Only one of Prefix and Pattern should be set.
+type URINamespace struct {
+	Prefix  string `json:"prefix,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	IDType  string `json:"idType,omitempty"`
+}
+
+// DefaultURINamespaces returns the namespaces of the FT things and managed locations.
+func DefaultURINamespaces() []URINamespace {
+	return []URINamespace{
+		{Prefix: thingURIPrefix, IDType: IDTypeString},
+		{Prefix: managedLocationURIPrefix, IDType: IDTypeString},
+	}
+}
+
+// ConceptID is the id extracted from a concept URI.
+type ConceptID struct {
+	ID   string
+	Type string
+}
+
+type uriExtractor struct {
+	namespace URINamespace
+	re        *regexp.Regexp
+}
+
+// URIRegistry extracts the concept ids from the URIs in the accepted namespaces.
+// The URIs which are not in any of the namespaces are dropped, logged and counted by namespace,
+// so that new namespaces in the model can be noticed.
+type URIRegistry struct {
+	extractors []uriExtractor
+	log        *logger.UPPLogger
+
+	mu      sync.Mutex
+	dropped map[string]int
+}
+
+// NewURIRegistry validates the given namespaces and returns a registry accepting them.
+func NewURIRegistry(namespaces []URINamespace, log *logger.UPPLogger) (*URIRegistry, error) {
+	r := &URIRegistry{log: log, dropped: map[string]int{}}
+	for _, ns := range namespaces {
+		if err := r.add(ns); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *URIRegistry) add(ns URINamespace) error {
+	if ns.IDType == "" {
+		ns.IDType = IDTypeString
+	}
+	if ns.IDType != IDTypeUUID && ns.IDType != IDTypeString {
+		return fmt.Errorf("unknown id type %q, it should be %s or %s", ns.IDType, IDTypeUUID, IDTypeString)
+	}
+
+	var pattern string
+	switch {
+	case ns.Prefix != "" && ns.Pattern != "":
+		return fmt.Errorf("namespace %s has both a prefix and a pattern", ns.Prefix)
+	case ns.Prefix != "":
+		pattern = "^" + regexp.QuoteMeta(ns.Prefix) + "(.+)$"
+	case ns.Pattern != "":
+		pattern = ns.Pattern
+	default:
+		return fmt.Errorf("namespace has neither a prefix nor a pattern")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid namespace pattern %q: %w", pattern, err)
+	}
+	if re.NumSubexp() < 1 {
+		return fmt.Errorf("namespace pattern %q has no capture group for the id", pattern)
+	}
+	r.extractors = append(r.extractors, uriExtractor{namespace: ns, re: re})
+	return nil
+}
+
+// Resolve returns the id in the given URI if the URI is in one of the accepted namespaces.
+func (r *URIRegistry) Resolve(uri string) (ConceptID, bool) {
+	for _, e := range r.extractors {
+		m := e.re.FindStringSubmatch(uri)
+		if m == nil || m[1] == "" {
+			continue
+		}
+		if e.namespace.IDType == IDTypeUUID && !uuidRegexp.MatchString(m[1]) {
+			continue
+		}
+		return ConceptID{ID: m[1], Type: e.namespace.IDType}, true
+	}
+	return ConceptID{}, false
+}
+
+// uris returns the URIs with the given id in the accepted namespaces which have a prefix.
+// The namespaces with a pattern are left out, as a URI can not be built from a pattern.
+func (r *URIRegistry) uris(id string) []string {
+	var uris []string
+	for _, e := range r.extractors {
+		if e.namespace.Prefix == "" || (e.namespace.IDType == IDTypeUUID && !uuidRegexp.MatchString(id)) {
+			continue
+		}
+		uris = append(uris, e.namespace.Prefix+id)
+	}
+	return uris
+}
+
+// Accepts reports whether a UUID with the given prefix is in one of the accepted namespaces.
+func (r *URIRegistry) Accepts(prefix string) bool {
+	_, ok := r.Resolve(prefix + "00000000-0000-0000-0000-000000000000")
+	return ok
+}
+
+// AcceptPrefix adds a namespace for the given prefix, unless the UUIDs with the prefix are already accepted.
+func (r *URIRegistry) AcceptPrefix(prefix string) {
+	if prefix == "" || r.Accepts(prefix) {
+		return
+	}
+	_ = r.add(URINamespace{Prefix: prefix, IDType: IDTypeString})
+}
+
+// Dropped returns the number of URIs dropped so far by namespace, which is the URI up to its last path segment.
+func (r *URIRegistry) Dropped() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dropped := make(map[string]int, len(r.dropped))
+	for ns, count := range r.dropped {
+		dropped[ns] = count
+	}
+	return dropped
+}
+
+// conceptID returns the id in the given URI. The URIs which are not in any of the accepted namespaces are dropped,
+// in which case their namespace is returned. Concept schemes are not published, so their URIs are not counted as dropped.
+func (r *URIRegistry) conceptID(uri string) (id string, droppedNamespace string, ok bool) {
+	if strings.Contains(uri, "ConceptScheme") {
+		return "", "", false
+	}
+	if id, ok := r.Resolve(uri); ok {
+		return id.ID, "", true
+	}
+
+	ns := uri
+	if i := strings.LastIndex(uri, "/"); i >= 0 {
+		ns = uri[:i+1]
+	}
+	r.mu.Lock()
+	r.dropped[ns]++
+	count := r.dropped[ns]
+	r.mu.Unlock()
+
+	r.log.WithField("uri", uri).WithField("namespace", ns).WithField("droppedCount", count).
+		Warn("Dropping concept URI which is not in any of the accepted namespaces")
+	return "", ns, false
+}
@@ -0,0 +1,178 @@
+package smartlogic
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURIRegistry_Resolve(t *testing.T) {
+	r, err := NewURIRegistry([]URINamespace{
+		{Prefix: "http://www.ft.com/thing/", IDType: IDTypeUUID},
+		{Pattern: `^http://www\.ft\.com/ontology/[a-z]+/([^/]+)$`, IDType: IDTypeString},
+	}, logger.NewUnstructuredLogger())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		uri        string
+		expectedID ConceptID
+		expectedOK bool
+	}{
+		{
+			name:       "prefix with uuid",
+			uri:        "http://www.ft.com/thing/02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11",
+			expectedID: ConceptID{ID: "02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11", Type: IDTypeUUID},
+			expectedOK: true,
+		},
+		{
+			name: "prefix with an id which is not a uuid",
+			uri:  "http://www.ft.com/thing/testTypeMetadata",
+		},
+		{
+			name:       "pattern",
+			uri:        "http://www.ft.com/ontology/managedlocation/GB-LND",
+			expectedID: ConceptID{ID: "GB-LND", Type: IDTypeString},
+			expectedOK: true,
+		},
+		{
+			name: "unknown namespace",
+			uri:  "http://www.example.com/thing/02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, ok := r.Resolve(test.uri)
+			assert.Equal(t, test.expectedOK, ok)
+			assert.Equal(t, test.expectedID, id)
+		})
+	}
+}
+
+func TestNewURIRegistry_InvalidNamespaces(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace URINamespace
+	}{
+		{name: "empty", namespace: URINamespace{}},
+		{name: "prefix and pattern", namespace: URINamespace{Prefix: "http://www.ft.com/thing/", Pattern: "^(.+)$"}},
+		{name: "invalid pattern", namespace: URINamespace{Pattern: "^(.+$"}},
+		{name: "no capture group", namespace: URINamespace{Pattern: "^http://www.ft.com/thing/.+$"}},
+		{name: "unknown id type", namespace: URINamespace{Prefix: "http://www.ft.com/thing/", IDType: "tme"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewURIRegistry([]URINamespace{test.namespace}, logger.NewUnstructuredLogger())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestURIRegistry_AcceptPrefix(t *testing.T) {
+	r, err := NewURIRegistry(DefaultURINamespaces(), logger.NewUnstructuredLogger())
+	require.NoError(t, err)
+
+	r.AcceptPrefix(thingURIPrefix)
+	assert.Len(t, r.extractors, 2)
+
+	r.AcceptPrefix("http://www.ft.com/ontology/person/")
+	assert.Len(t, r.extractors, 3)
+	assert.True(t, r.Accepts("http://www.ft.com/ontology/person/"))
+}
+
+func TestClient_GetConceptPage_CountsDroppedURIs(t *testing.T) {
+	client, err := NewSmartlogicTestClient(&mockHTTPClient{
+		resp: `{"@graph":[
+			{"@id":"http://www.ft.com/thing/02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11"},
+			{"@id":"http://www.ft.com/ontology/newnamespace/9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f"},
+			{"@id":"http://www.ft.com/ontology/newnamespace/1d2e3f4a-0000-0000-0000-000000000000"},
+			{"@id":"http://www.ft.com/thing/ConceptScheme/a8a8a8a8-0000-0000-0000-000000000000"}
+		]}`,
+		statusCode: http.StatusOK,
+	}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+
+	page, err := client.GetConceptPage("", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11"}, page.UUIDs)
+	assert.Equal(t, 4, page.Size)
+	assert.Equal(t, map[string]int{"http://www.ft.com/ontology/newnamespace/": 2}, client.uris.Dropped())
+}
+
+func TestClient_DroppedURIsMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	sl, err := NewSmartlogicClient(&mockHTTPClient{
+		resp: `{"access_token": "token", "@graph":[
+			{"@id":"http://www.ft.com/thing/02d6b1e3-9b5f-4a4d-8f1a-3c1b1d0c2f11"},
+			{"@id":"http://www.ft.com/ontology/newnamespace/9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f"},
+			{"@id":"http://www.ft.com/ontology/newnamespace/1d2e3f4a-0000-0000-0000-000000000000"}
+		]}`,
+		statusCode: http.StatusOK,
+	}, "http://base/url", "modelName", "apiKey", "http://www.ft.com/thing/", logger.NewUnstructuredLogger(), WithMetrics(registry))
+	require.NoError(t, err)
+
+	_, err = sl.GetConceptPage("", 10)
+	require.NoError(t, err)
+	dropped, ok := registry.Get("smartlogic.modelName.droppedURIs.http://www.ft.com/ontology/newnamespace/").(metrics.Counter)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), dropped.Count())
+
+	_, err = sl.GetConceptPage("", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), dropped.Count())
+}
+
+func TestClient_GetConceptInAnotherNamespace(t *testing.T) {
+	const id = "9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f"
+	const uri = "http://www.ft.com/ontology/managedlocation/" + id
+	var paths []string
+	httpClient := funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+		path := req.URL.Query().Get("path")
+		paths = append(paths, path)
+		if strings.Contains(path, url.QueryEscape("<"+uri+">")) {
+			return newResponse(http.StatusOK, `{"@graph": [{"@id": "`+uri+`", "sem:guid": [{"@value": "`+id+`"}]}]}`), nil
+		}
+		// Smartlogic answers with the bare URI for the concepts which do not exist
+		return newResponse(http.StatusOK, `{"@graph": [{"@id": "http://www.ft.com/thing/`+id+`"}]}`), nil
+	})
+	sl, err := NewSmartlogicTestClient(httpClient, "http://base/url", "modelName", "apiKey", "http://www.ft.com/thing/")
+	require.NoError(t, err)
+	sl.uris, err = NewURIRegistry(DefaultURINamespaces(), logger.NewUnstructuredLogger())
+	require.NoError(t, err)
+
+	// the concept is looked up under the concept URI prefix first, then in the other namespaces
+	concept, err := sl.GetConcept(id)
+	require.NoError(t, err)
+	assert.Contains(t, string(concept), uri)
+	require.Len(t, paths, 2)
+	assert.Contains(t, paths[0], url.QueryEscape("<http://www.ft.com/thing/"+id+">"))
+	assert.Contains(t, paths[1], url.QueryEscape("<"+uri+">"))
+
+	// the concept which is in none of the namespaces does not exist
+	paths = nil
+	_, err = sl.GetConcept("2d3e16e0-61cb-4322-8aff-3b01c59f4daa")
+	assert.ErrorIs(t, err, ErrorConceptDoesNotExist)
+	assert.Len(t, paths, 2)
+}
+
+func TestURIRegistry_URIs(t *testing.T) {
+	r, err := NewURIRegistry([]URINamespace{
+		{Prefix: "http://www.ft.com/thing/", IDType: IDTypeUUID},
+		{Prefix: "http://www.ft.com/ontology/managedlocation/"},
+		{Pattern: `^http://www\.ft\.com/ontology/[a-z]+/([^/]+)$`},
+	}, logger.NewUnstructuredLogger())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"http://www.ft.com/thing/9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f",
+		"http://www.ft.com/ontology/managedlocation/9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f",
+	}, r.uris("9c1f6b2e-3f0a-4b8e-9d5c-7e2a1b4c6d8f"))
+	// the namespaces of UUIDs are left out for the other ids
+	assert.Equal(t, []string{"http://www.ft.com/ontology/managedlocation/london"}, r.uris("london"))
+}
@@ -0,0 +1,128 @@
+package smartlogic
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// AllConceptProperties requests the concepts with all their properties, instead of a projection of them.
+	AllConceptProperties = "*"
+
+	// directProperties is the projection of all the direct properties of a concept.
+	directProperties = "[]"
+)
+
+var prefixedNameRegexp = regexp.MustCompile(`^[A-Za-z][\w.-]*:[\w.-]+$`)
+
+// DefaultConceptProperties returns the properties of the concepts requested from Smartlogic by default:
+// all the direct properties, together with the literal forms of the labels.
+func DefaultConceptProperties() []string {
+	return []string{
+		directProperties,
+		"skosxl:prefLabel/skosxl:literalForm",
+		"skosxl:altLabel/skosxl:literalForm",
+		"<http://www.ft.com/ontology/shortLabel>/skosxl:literalForm",
+	}
+}
+
+// ParseConceptProperties reads a comma separated list of the properties of the concepts to request from Smartlogic.
+// See ValidateConceptProperties.
+func ParseConceptProperties(raw string) ([]string, error) {
+	var properties []string
+	for _, p := range strings.Split(raw, ",") {
+		properties = append(properties, strings.TrimSpace(p))
+	}
+	if err := ValidateConceptProperties(properties); err != nil {
+		return nil, err
+	}
+	return properties, nil
+}
+
+// ValidateConceptProperties checks the properties of the concepts to request from Smartlogic. Every property is either
+// [], which stands for all the direct properties, or a path of properties separated by /, e.g. skosxl:prefLabel/skosxl:literalForm.
+// The properties in a path are either prefixed names or IRIs in angle brackets. The properties should include []
+// or sem:guid, which tells whether a concept exists. A single * requests all the properties.
+func ValidateConceptProperties(properties []string) error {
+	if len(properties) == 0 {
+		return errors.New("no concept properties are given")
+	}
+	if len(properties) == 1 && properties[0] == AllConceptProperties {
+		return nil
+	}
+
+	var identified bool
+	for _, p := range properties {
+		if p == directProperties || p == guidProperty {
+			identified = true
+			continue
+		}
+		if p == "" {
+			return errors.New("the concept properties have an empty property")
+		}
+		for _, segment := range splitPropertyPath(p) {
+			if err := validatePropertySegment(segment); err != nil {
+				return fmt.Errorf("concept property %s is invalid: %w", p, err)
+			}
+		}
+	}
+	if !identified {
+		return fmt.Errorf("the concept properties should include %s or %s", directProperties, guidProperty)
+	}
+	return nil
+}
+
+// splitPropertyPath returns the properties in the given path, the / in the IRIs do not separate properties.
+func splitPropertyPath(path string) []string {
+	var segments []string
+	var inIRI bool
+	start := 0
+	for i, r := range path {
+		switch {
+		case r == '<':
+			inIRI = true
+		case r == '>':
+			inIRI = false
+		case r == '/' && !inIRI:
+			segments = append(segments, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, path[start:])
+}
+
+func validatePropertySegment(segment string) error {
+	if strings.HasPrefix(segment, "<") && strings.HasSuffix(segment, ">") {
+		iri, err := url.Parse(segment[1 : len(segment)-1])
+		if err != nil || iri.Scheme == "" || iri.Host == "" {
+			return fmt.Errorf("%s is not an absolute IRI", segment)
+		}
+		return nil
+	}
+	if !prefixedNameRegexp.MatchString(segment) {
+		return fmt.Errorf("%s is neither a prefixed name nor an IRI in angle brackets", segment)
+	}
+	return nil
+}
+
+// encodeConceptProperties returns the properties query parameter of the request of a concept, or nothing if all
+// the properties are requested. The IRIs are escaped, as they are part of the path query parameter.
+func encodeConceptProperties(properties []string) string {
+	if len(properties) == 1 && properties[0] == AllConceptProperties {
+		return ""
+	}
+	encoded := make([]string, 0, len(properties))
+	for _, p := range properties {
+		segments := splitPropertyPath(p)
+		for i, segment := range segments {
+			if segment == directProperties || strings.HasPrefix(segment, "<") {
+				segments[i] = url.QueryEscape(segment)
+			}
+		}
+		encoded = append(encoded, strings.Join(segments, "/"))
+	}
+	return "&properties=" + strings.Join(encoded, ",")
+}
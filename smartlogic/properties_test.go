@@ -0,0 +1,89 @@
+package smartlogic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeConceptProperties(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties []string
+		expected   string
+	}{
+		{
+			name:       "default",
+			properties: DefaultConceptProperties(),
+			expected:   "&properties=%5B%5D,skosxl:prefLabel/skosxl:literalForm,skosxl:altLabel/skosxl:literalForm,%3Chttp%3A%2F%2Fwww.ft.com%2Fontology%2FshortLabel%3E/skosxl:literalForm",
+		},
+		{
+			name:       "image",
+			properties: []string{"sem:guid", "skosxl:prefLabel/skosxl:literalForm", "<http://www.ft.com/ontology/imageURL>"},
+			expected:   "&properties=sem:guid,skosxl:prefLabel/skosxl:literalForm,%3Chttp%3A%2F%2Fwww.ft.com%2Fontology%2FimageURL%3E",
+		},
+		{
+			name:       "all",
+			properties: []string{AllConceptProperties},
+			expected:   "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, encodeConceptProperties(test.properties))
+		})
+	}
+}
+
+func TestParseConceptProperties(t *testing.T) {
+	properties, err := ParseConceptProperties("[], skosxl:prefLabel/skosxl:literalForm,<http://www.ft.com/ontology/shortLabel>/skosxl:literalForm")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"[]", "skosxl:prefLabel/skosxl:literalForm", "<http://www.ft.com/ontology/shortLabel>/skosxl:literalForm"}, properties)
+
+	properties, err = ParseConceptProperties("*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{AllConceptProperties}, properties)
+
+	invalid := []struct {
+		raw           string
+		expectedError string
+	}{
+		{raw: "", expectedError: "the concept properties have an empty property"},
+		{raw: "[],,sem:guid", expectedError: "the concept properties have an empty property"},
+		{raw: "skosxl:prefLabel/skosxl:literalForm", expectedError: "the concept properties should include [] or sem:guid"},
+		{raw: "[],prefLabel", expectedError: "concept property prefLabel is invalid"},
+		{raw: "[],skosxl:prefLabel//skosxl:literalForm", expectedError: "concept property skosxl:prefLabel//skosxl:literalForm is invalid"},
+		{raw: "[],<ontology/shortLabel>", expectedError: "<ontology/shortLabel> is not an absolute IRI"},
+		{raw: "[],*", expectedError: "concept property * is invalid"},
+	}
+	for _, test := range invalid {
+		t.Run(test.raw, func(t *testing.T) {
+			_, err := ParseConceptProperties(test.raw)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedError)
+		})
+	}
+}
+
+func TestClient_GetConceptWithProperties(t *testing.T) {
+	var requests []string
+	httpClient := funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.RawQuery)
+		return newResponse(http.StatusOK, `{"@graph": [{"@id": "http://www.ft.com/thing/uuid", "sem:guid": [{"@value": "uuid"}]}]}`), nil
+	})
+	sl, err := NewSmartlogicTestClient(httpClient, "http://base/url", "modelName", "apiKey", "http://www.ft.com/thing/")
+	require.NoError(t, err)
+	sl.properties = []string{"sem:guid", "skosxl:prefLabel/skosxl:literalForm"}
+
+	_, err = sl.GetConcept("uuid")
+	require.NoError(t, err)
+	_, err = sl.GetConceptWithProperties("uuid", []string{AllConceptProperties})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"path=model:modelName/%253Chttp%253A%252F%252Fwww.ft.com%252Fthing%252Fuuid%253E&properties=sem:guid,skosxl:prefLabel/skosxl:literalForm",
+		"path=model:modelName/%253Chttp%253A%252F%252Fwww.ft.com%252Fthing%252Fuuid%253E",
+	}, requests)
+}
@@ -0,0 +1,266 @@
+package smartlogic
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultMaxRetries    = 5
+	defaultMaxRetryAfter = time.Minute
+)
+
+// throttle paces the requests to Smartlogic. The requests take a token from a token bucket, and all of them
+// are paused when Smartlogic asks to slow down with a 429 or a 503 response.
+type throttle struct {
+	limiter *rate.Limiter
+	now     func() time.Time
+	after   func(time.Duration) <-chan time.Time
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// newThrottle returns a throttle which does not limit the requests until a rate is set.
+func newThrottle() *throttle {
+	return &throttle{
+		limiter: rate.NewLimiter(rate.Inf, 0),
+		now:     time.Now,
+		after:   time.After,
+	}
+}
+
+// RateLimiter is a limit of the requests to Smartlogic which can be shared by several clients with WithSharedRateLimit.
+type RateLimiter struct {
+	throttle *throttle
+}
+
+// NewRateLimiter returns a limit of the given number of requests per second, with the given number of requests
+// which can be sent at once. The number of requests at once defaults to the rate when it is not set.
+func NewRateLimiter(requestsPerSecond, burst int) *RateLimiter {
+	t := newThrottle()
+	t.setRate(requestsPerSecond)
+	t.setBurst(burst)
+	return &RateLimiter{throttle: t}
+}
+
+// setRate limits the requests to the given number per second. The size of the bucket defaults to the rate.
+// The bucket starts full.
+func (t *throttle) setRate(requestsPerSecond int) {
+	if requestsPerSecond <= 0 {
+		return
+	}
+	burst := t.limiter.Burst()
+	if burst == 0 {
+		burst = requestsPerSecond
+	}
+	t.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+}
+
+// setBurst sets how many requests can be made at once after none were made for a while.
+func (t *throttle) setBurst(burst int) {
+	if burst > 0 {
+		t.limiter = rate.NewLimiter(t.limiter.Limit(), burst)
+	}
+}
+
+// wait blocks until the pause asked by Smartlogic is over and a token is available.
+func (t *throttle) wait(ctx context.Context) error {
+	for {
+		d := t.pausedFor()
+		if d <= 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.after(d):
+		}
+	}
+	return t.limiter.Wait(ctx)
+}
+
+// pause stops all the requests for the given duration, unless they are already paused for longer.
+func (t *throttle) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until := t.now().Add(d)
+	if until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+}
+
+// pausedFor returns how long the requests remain paused for.
+func (t *throttle) pausedFor() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pausedUntil.Sub(t.now())
+}
+
+// tokens returns the number of requests which can be made straight away, i.e. the remaining budget.
+func (t *throttle) tokens() float64 {
+	if t.limiter.Limit() == rate.Inf {
+		return float64(t.limiter.Burst())
+	}
+	return t.limiter.Tokens()
+}
+
+// retryPolicy decides whether the requests which failed with a transport error or a 5xx or 429 status are retried,
+// and when. The Retry-After header of the 429 and 503 responses is honored, up to maxRetryAfter.
+type retryPolicy struct {
+	maxRetries    int
+	maxRetryAfter time.Duration
+	backoff       func(retry int) time.Duration
+	sleep         func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryPolicy() *retryPolicy {
+	return &retryPolicy{
+		maxRetries:    defaultMaxRetries,
+		maxRetryAfter: defaultMaxRetryAfter,
+		backoff:       exponentialBackoff,
+		sleep:         sleepContext,
+	}
+}
+
+// exponentialBackoff waits 1s, 2s, 4s... before the retries.
+func exponentialBackoff(retry int) time.Duration {
+	return time.Duration(1<<uint(retry)) * time.Second
+}
+
+// sleepContext waits for the given duration, unless the context is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryable reports whether a response with the given status is worth retrying.
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// throttled reports whether a response with the given status asks to slow down all the requests.
+func throttled(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// delay returns how long to wait before the given retry, and false if the request should not be retried.
+func (p *retryPolicy) delay(retry int, retryAfter time.Duration) (time.Duration, bool) {
+	if retry >= p.maxRetries {
+		return 0, false
+	}
+	if retryAfter > p.maxRetryAfter {
+		// Smartlogic asked to wait for longer than it is worth holding the request for.
+		return 0, false
+	}
+	if retryAfter > 0 {
+		return retryAfter, true
+	}
+	return p.backoff(retry), true
+}
+
+// clientMetrics are the metrics of the requests made by a Smartlogic client.
+type clientMetrics struct {
+	retries              metrics.Counter
+	throttled            metrics.Counter
+	getConcept           metrics.Timer
+	getConceptErrors     map[ErrorKind]metrics.Counter
+	tokenRefreshes       metrics.Counter
+	tokenRefreshFailures metrics.Counter
+
+	// the counters of the dropped URIs are registered as new namespaces are dropped
+	mu          sync.Mutex
+	registry    metrics.Registry
+	prefix      string
+	droppedURIs map[string]metrics.Counter
+}
+
+// otherErrors counts the failures which are not an Error of a known kind.
+const otherErrors ErrorKind = "other"
+
+func newClientMetrics() *clientMetrics {
+	m := &clientMetrics{
+		retries:              metrics.NewCounter(),
+		throttled:            metrics.NewCounter(),
+		getConcept:           metrics.NewTimer(),
+		getConceptErrors:     map[ErrorKind]metrics.Counter{otherErrors: metrics.NewCounter()},
+		tokenRefreshes:       metrics.NewCounter(),
+		tokenRefreshFailures: metrics.NewCounter(),
+		droppedURIs:          map[string]metrics.Counter{},
+	}
+	for kind := range kindSentinels {
+		m.getConceptErrors[kind] = metrics.NewCounter()
+	}
+	return m
+}
+
+// conceptError counts the failure of getting a concept by its kind.
+func (m *clientMetrics) conceptError(err error) {
+	if counter, ok := m.getConceptErrors[errorKind(err)]; ok {
+		counter.Inc(1)
+		return
+	}
+	m.getConceptErrors[otherErrors].Inc(1)
+}
+
+// droppedURI counts a concept URI which was dropped because it is not in any of the accepted namespaces.
+// The URIs are counted by namespace, so that new namespaces in the model can be noticed.
+func (m *clientMetrics) droppedURI(namespace string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counter, ok := m.droppedURIs[namespace]
+	if !ok {
+		counter = metrics.NewCounter()
+		m.droppedURIs[namespace] = counter
+		if m.registry != nil {
+			name := m.prefix + "droppedURIs." + namespace
+			m.registry.Unregister(name)
+			_ = m.registry.Register(name, counter)
+		}
+	}
+	counter.Inc(1)
+}
+
+// register adds the metrics of the client of the given model to the registry.
+func (m *clientMetrics) register(r metrics.Registry, model string, t *throttle) error {
+	prefix := "smartlogic." + model + "."
+	m.mu.Lock()
+	m.registry = r
+	m.prefix = prefix
+	m.mu.Unlock()
+	toRegister := map[string]interface{}{
+		prefix + "retries":          m.retries,
+		prefix + "throttled":        m.throttled,
+		prefix + "ratelimit.tokens": metrics.NewFunctionalGaugeFloat64(t.tokens),
+		prefix + "ratelimit.pausedMs": metrics.NewFunctionalGauge(func() int64 {
+			if d := t.pausedFor(); d > 0 {
+				return d.Milliseconds()
+			}
+			return 0
+		}),
+		prefix + "getConcept":            m.getConcept,
+		prefix + "token.refreshes":       m.tokenRefreshes,
+		prefix + "token.refreshFailures": m.tokenRefreshFailures,
+	}
+	for kind, counter := range m.getConceptErrors {
+		toRegister[prefix+"getConcept.errors."+string(kind)] = counter
+	}
+	for name, metric := range toRegister {
+		r.Unregister(name)
+		if err := r.Register(name, metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
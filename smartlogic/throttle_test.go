@@ -0,0 +1,243 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRetryingTestClient returns a test client which retries the requests, recording the waits instead of sleeping.
+func newRetryingTestClient(t *testing.T, httpClient httpClient) (*Client, *[]time.Duration) {
+	sl, err := NewSmartlogicTestClient(httpClient, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+
+	var waits []time.Duration
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	sl.retry = newRetryPolicy()
+	sl.retry.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	sl.throttle.now = func() time.Time { return now }
+	sl.throttle.after = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		now = now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- now
+		return ch
+	}
+	return sl, &waits
+}
+
+// responses answers the requests with the given responses in turn, the last one is repeated.
+func responses(t *testing.T, calls *int, resps ...func() (*http.Response, error)) httpClient {
+	return funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+		require.NotEmpty(t, resps)
+		i := *calls
+		if i >= len(resps) {
+			i = len(resps) - 1
+		}
+		*calls++
+		return resps[i]()
+	})
+}
+
+func status(statusCode int, retryAfter string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		resp := newResponse(statusCode, `{"@graph": []}`)
+		resp.Header = http.Header{}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp, nil
+	}
+}
+
+func TestClient_MakeRequest_HonorsRetryAfter(t *testing.T) {
+	for _, statusCode := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(statusCode), func(t *testing.T) {
+			var calls int
+			sl, waits := newRetryingTestClient(t, responses(t, &calls, status(statusCode, "7"), status(http.StatusOK, "")))
+
+			_, err := sl.GetChangedConceptList(time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, 2, calls)
+			assert.Equal(t, []time.Duration{7 * time.Second}, *waits)
+			assert.Equal(t, int64(1), sl.metrics.throttled.Count())
+			assert.Equal(t, int64(1), sl.metrics.retries.Count())
+		})
+	}
+}
+
+func TestClient_MakeRequest_ThrottledWithoutRetryAfter(t *testing.T) {
+	var calls int
+	sl, waits := newRetryingTestClient(t, responses(t, &calls, status(http.StatusTooManyRequests, ""), status(http.StatusOK, "")))
+
+	_, err := sl.GetChangedConceptList(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Second}, *waits)
+}
+
+func TestClient_MakeRequest_RetryAfterTooLong(t *testing.T) {
+	var calls int
+	sl, waits := newRetryingTestClient(t, responses(t, &calls, status(http.StatusTooManyRequests, "3600")))
+
+	_, err := sl.GetConcept("test-uuid")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	var slErr *Error
+	require.ErrorAs(t, err, &slErr)
+	assert.Equal(t, time.Hour, slErr.RetryAfter)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, *waits)
+}
+
+func TestClient_MakeRequest_RetriesWithBackoff(t *testing.T) {
+	var calls int
+	sl, waits := newRetryingTestClient(t, responses(t, &calls,
+		func() (*http.Response, error) { return nil, errors.New("connection reset") },
+		status(http.StatusInternalServerError, ""),
+		status(http.StatusOK, ""),
+	))
+
+	_, err := sl.GetChangedConceptList(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *waits)
+	assert.Equal(t, int64(0), sl.metrics.throttled.Count())
+}
+
+func TestClient_MakeRequest_StopsRetryingWithTheContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		resp         func() (*http.Response, error)
+		expectedKind ErrorKind
+	}{
+		{name: "transport error", resp: func() (*http.Response, error) { return nil, errors.New("connection reset") }, expectedKind: KindUnavailable},
+		{name: "server error", resp: status(http.StatusInternalServerError, ""), expectedKind: KindUpstream},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			sl, err := NewSmartlogicTestClient(responses(t, &calls, test.resp), "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+			require.NoError(t, err)
+			// the first retry waits for 1s
+			sl.retry = newRetryPolicy()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err = sl.GetConceptContext(ctx, "2d3e16e0-61cb-4322-8aff-3b01c59f4daa")
+			assert.Less(t, time.Since(start), 500*time.Millisecond, "the backoff should stop with the context")
+			assert.Equal(t, 1, calls)
+			var slErr *Error
+			require.ErrorAs(t, err, &slErr)
+			assert.Equal(t, test.expectedKind, slErr.Kind)
+		})
+	}
+}
+
+func TestClient_MakeRequest_GivesUpAfterMaxRetries(t *testing.T) {
+	var calls int
+	sl, waits := newRetryingTestClient(t, responses(t, &calls, status(http.StatusBadGateway, "")))
+	sl.retry.maxRetries = 2
+
+	_, err := sl.GetChangedConceptList(time.Now())
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, 3, calls)
+	assert.Len(t, *waits, 2)
+}
+
+func TestClient_MakeRequest_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int
+	sl, _ := newRetryingTestClient(t, responses(t, &calls, status(http.StatusBadRequest, "")))
+
+	_, err := sl.GetChangedConceptList(time.Now())
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestThrottle_PauseIsShared(t *testing.T) {
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	th := newThrottle()
+	th.now = func() time.Time { return now }
+
+	th.pause(10 * time.Second)
+	th.pause(5 * time.Second)
+	assert.Equal(t, 10*time.Second, th.pausedFor())
+
+	now = now.Add(4 * time.Second)
+	assert.Equal(t, 6*time.Second, th.pausedFor())
+}
+
+func TestThrottle_RateAndBurst(t *testing.T) {
+	th := newThrottle()
+	assert.Equal(t, float64(0), th.tokens())
+
+	th.setRate(10)
+	assert.InDelta(t, 10, th.tokens(), 0.1)
+
+	th = newThrottle()
+	th.setBurst(50)
+	th.setRate(10)
+	assert.InDelta(t, 50, th.tokens(), 0.1)
+}
+
+func TestClient_SharedRateLimit(t *testing.T) {
+	limiter := NewRateLimiter(5, 20)
+	registries := []metrics.Registry{metrics.NewRegistry(), metrics.NewRegistry()}
+	for i, model := range []string{"modelName", "otherModel"} {
+		sl, err := NewSmartlogicClient(&mockHTTPClient{resp: `{"access_token": "token", "@graph": []}`, statusCode: http.StatusOK},
+			"http://base/url", model, "apiKey", "conceptUriPrefix", logger.NewUnstructuredLogger(),
+			WithSharedRateLimit(limiter),
+			WithMetrics(registries[i]),
+		)
+		require.NoError(t, err)
+
+		_, err = sl.GetChangedConceptList(time.Now())
+		require.NoError(t, err)
+	}
+
+	// the requests of both clients are taken from the same budget
+	tokens, ok := registries[0].Get("smartlogic.modelName.ratelimit.tokens").(metrics.GaugeFloat64)
+	require.True(t, ok)
+	assert.InDelta(t, 18, tokens.Value(), 0.1)
+}
+
+func TestClient_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	sl, err := NewSmartlogicClient(&mockHTTPClient{resp: `{"access_token": "token", "@graph": []}`, statusCode: http.StatusOK},
+		"http://base/url", "modelName", "apiKey", "conceptUriPrefix", logger.NewUnstructuredLogger(),
+		WithRateLimit(5),
+		WithRateBurst(20),
+		WithMetrics(registry),
+	)
+	require.NoError(t, err)
+
+	tokens, ok := registry.Get("smartlogic.modelName.ratelimit.tokens").(metrics.GaugeFloat64)
+	require.True(t, ok)
+	assert.InDelta(t, 20, tokens.Value(), 0.1)
+
+	_, err = sl.GetChangedConceptList(time.Now())
+	require.NoError(t, err)
+	assert.InDelta(t, 19, tokens.Value(), 0.1)
+
+	for _, name := range []string{"smartlogic.modelName.retries", "smartlogic.modelName.throttled", "smartlogic.modelName.ratelimit.pausedMs"} {
+		assert.NotNil(t, registry.Get(name), name)
+	}
+
+	assert.Equal(t, int64(1), registry.Get("smartlogic.modelName.token.refreshes").(metrics.Counter).Count())
+	assert.Equal(t, int64(0), registry.Get("smartlogic.modelName.token.refreshFailures").(metrics.Counter).Count())
+
+	_, err = sl.GetConcept("2d3e16e0-61cb-4322-8aff-3b01c59f4daa")
+	require.ErrorIs(t, err, ErrInvalidResponse)
+	assert.Equal(t, int64(1), registry.Get("smartlogic.modelName.getConcept").(metrics.Timer).Count())
+	assert.Equal(t, int64(1), registry.Get("smartlogic.modelName.getConcept.errors.invalid_response").(metrics.Counter).Count())
+	assert.Equal(t, int64(0), registry.Get("smartlogic.modelName.getConcept.errors.not_found").(metrics.Counter).Count())
+}
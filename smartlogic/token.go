@@ -0,0 +1,162 @@
+package smartlogic
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const defaultTokenRefreshAhead = time.Minute
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	UserName    string `json:"userName"`
+	Issued      string `json:".issued"`
+	Expires     string `json:".expires"`
+}
+
+// TokenStatus describes the access token in use. ExpiresAt is zero if Smartlogic did not say when the token expires.
+type TokenStatus struct {
+	Token     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// tokenRefresh is a refresh of the access token in progress, done is closed when it completes.
+type tokenRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// tokenManager keeps the Smartlogic access token. The token is refreshed ahead of its expiry in the background
+// while it is still used, and the callers which need a new token wait for a single refresh.
+type tokenManager struct {
+	httpClient   httpClient
+	auth         Authenticator
+	refreshAhead time.Duration
+	now          func() time.Time
+	metrics      *clientMetrics
+	log          *logger.UPPLogger
+
+	mu         sync.Mutex
+	status     TokenStatus
+	fetched    bool
+	invalid    bool
+	refreshing *tokenRefresh
+}
+
+func newTokenManager(httpClient httpClient, auth Authenticator, log *logger.UPPLogger) *tokenManager {
+	return &tokenManager{
+		httpClient:   httpClient,
+		auth:         auth,
+		refreshAhead: defaultTokenRefreshAhead,
+		now:          time.Now,
+		metrics:      newClientMetrics(),
+		log:          log,
+	}
+}
+
+// Token returns a valid access token, refreshing it if needed. If the refresh fails the error is returned
+// together with the token in use, as Smartlogic may still accept it.
+func (m *tokenManager) Token() (string, error) {
+	m.mu.Lock()
+	now := m.now()
+	usable := m.fetched && !m.invalid && (m.status.ExpiresAt.IsZero() || now.Before(m.status.ExpiresAt))
+	if usable {
+		token := m.status.Token
+		if !m.status.ExpiresAt.IsZero() && !now.Before(m.status.ExpiresAt.Add(-m.refreshAhead)) && m.refreshing == nil {
+			// the token is about to expire, it is refreshed in the background while it can still be used
+			m.startRefresh()
+			go m.fetch(m.refreshing)
+		}
+		m.mu.Unlock()
+		return token, nil
+	}
+	m.mu.Unlock()
+
+	err := m.Refresh()
+	return m.Status().Token, err
+}
+
+// Refresh fetches a new access token. If a refresh is already in progress it waits for it instead.
+func (m *tokenManager) Refresh() error {
+	m.mu.Lock()
+	if r := m.refreshing; r != nil {
+		m.mu.Unlock()
+		<-r.done
+		return r.err
+	}
+	r := m.startRefresh()
+	m.mu.Unlock()
+
+	m.fetch(r)
+	return r.err
+}
+
+// Invalidate marks the given token as rejected by Smartlogic, so that the next caller refreshes it.
+// A token which was already replaced is ignored.
+func (m *tokenManager) Invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status.Token == token {
+		m.invalid = true
+	}
+}
+
+// Status returns the access token in use and when it was issued and expires.
+func (m *tokenManager) Status() TokenStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// set replaces the token in use. A zero expiresAt means that the expiry of the token is unknown.
+func (m *tokenManager) set(token string, issuedAt time.Time, expiresAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = TokenStatus{Token: token, IssuedAt: issuedAt, ExpiresAt: expiresAt}
+	m.fetched = true
+	m.invalid = false
+}
+
+// startRefresh records a new refresh in progress, it should be called with the lock held.
+func (m *tokenManager) startRefresh() *tokenRefresh {
+	m.refreshing = &tokenRefresh{done: make(chan struct{})}
+	return m.refreshing
+}
+
+func (m *tokenManager) fetch(r *tokenRefresh) {
+	defer func() {
+		m.mu.Lock()
+		m.refreshing = nil
+		m.mu.Unlock()
+		close(r.done)
+	}()
+
+	var tokenResponse TokenResponse
+	m.metrics.tokenRefreshes.Inc(1)
+	tokenResponse, r.err = m.auth.Token(m.httpClient)
+	if r.err != nil {
+		m.metrics.tokenRefreshFailures.Inc(1)
+		m.log.WithError(r.err).WithField("method", "GenerateToken").Error("Error getting an access token")
+		return
+	}
+
+	issuedAt := m.now()
+	if issued, err := http.ParseTime(tokenResponse.Issued); err == nil {
+		issuedAt = issued
+	}
+	var expiresAt time.Time
+	if tokenResponse.ExpiresIn > 0 {
+		expiresAt = issuedAt.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+	} else if expires, err := http.ParseTime(tokenResponse.Expires); err == nil {
+		expiresAt = expires
+	}
+
+	m.log.Debug("Setting Smartlogic access token")
+	m.set(tokenResponse.AccessToken, issuedAt, expiresAt)
+}
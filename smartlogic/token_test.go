@@ -0,0 +1,168 @@
+package smartlogic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenHTTPClient issues the tokens token1, token2... which expire after expiresIn seconds.
+type tokenHTTPClient struct {
+	expiresIn int
+	delay     time.Duration
+	fail      atomic.Bool
+	calls     atomic.Int32
+}
+
+func (c *tokenHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	n := c.calls.Add(1)
+	time.Sleep(c.delay)
+	if c.fail.Load() {
+		return nil, errors.New("token endpoint is down")
+	}
+	body := fmt.Sprintf(`{"access_token": "token%d", "expires_in": %d}`, n, c.expiresIn)
+	return &http.Response{Body: ioutil.NopCloser(bytes.NewBufferString(body)), StatusCode: http.StatusOK}, nil
+}
+
+func newTestTokenManager(httpClient httpClient, now *time.Time) *tokenManager {
+	m := newTokenManager(httpClient, &APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, logger.NewUnstructuredLogger())
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestTokenManager_Expiry(t *testing.T) {
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		response          string
+		expectedIssuedAt  time.Time
+		expectedExpiresAt time.Time
+	}{
+		{
+			name:              "expires_in",
+			response:          `{"access_token": "token", "expires_in": 3600}`,
+			expectedIssuedAt:  now,
+			expectedExpiresAt: now.Add(time.Hour),
+		},
+		{
+			name:              "issued and expires",
+			response:          `{"access_token": "token", ".issued": "Sun, 05 Apr 2020 09:50:00 GMT", ".expires": "Sun, 05 Apr 2020 10:50:00 GMT"}`,
+			expectedIssuedAt:  time.Date(2020, 4, 5, 9, 50, 0, 0, time.UTC),
+			expectedExpiresAt: time.Date(2020, 4, 5, 10, 50, 0, 0, time.UTC),
+		},
+		{
+			name:             "unknown expiry",
+			response:         `{"access_token": "token"}`,
+			expectedIssuedAt: now,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestTokenManager(&mockHTTPClient{resp: test.response, statusCode: http.StatusOK}, &now)
+			require.NoError(t, m.Refresh())
+
+			status := m.Status()
+			assert.Equal(t, "token", status.Token)
+			assert.True(t, test.expectedIssuedAt.Equal(status.IssuedAt), "unexpected issued at %v", status.IssuedAt)
+			assert.True(t, test.expectedExpiresAt.Equal(status.ExpiresAt), "unexpected expires at %v", status.ExpiresAt)
+		})
+	}
+}
+
+func TestTokenManager_RefreshesAheadOfExpiry(t *testing.T) {
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	httpClient := &tokenHTTPClient{expiresIn: 3600}
+	m := newTestTokenManager(httpClient, &now)
+
+	token, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token1", token)
+
+	token, err = m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token1", token)
+	assert.Equal(t, int32(1), httpClient.calls.Load())
+
+	// within the refresh window the token in use is returned while a new one is fetched in the background
+	now = now.Add(time.Hour - 30*time.Second)
+	token, err = m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token1", token)
+
+	assert.Eventually(t, func() bool {
+		return m.Status().Token == "token2"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), httpClient.calls.Load())
+}
+
+func TestTokenManager_ExpiredTokenIsRefreshed(t *testing.T) {
+	now := time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)
+	httpClient := &tokenHTTPClient{expiresIn: 3600}
+	m := newTestTokenManager(httpClient, &now)
+	require.NoError(t, m.Refresh())
+
+	now = now.Add(2 * time.Hour)
+	token, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token2", token)
+}
+
+func TestTokenManager_ConcurrentCallersWaitForOneRefresh(t *testing.T) {
+	httpClient := &tokenHTTPClient{expiresIn: 3600, delay: 50 * time.Millisecond}
+	m := newTokenManager(httpClient, &APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, logger.NewUnstructuredLogger())
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = m.Token()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), httpClient.calls.Load())
+	for _, token := range tokens {
+		assert.Equal(t, "token1", token)
+	}
+}
+
+func TestTokenManager_Invalidate(t *testing.T) {
+	httpClient := &tokenHTTPClient{}
+	m := newTokenManager(httpClient, &APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, logger.NewUnstructuredLogger())
+	require.NoError(t, m.Refresh())
+
+	// a token which was already replaced is ignored
+	m.Invalidate("token0")
+	token, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token1", token)
+
+	m.Invalidate("token1")
+	token, err = m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token2", token)
+}
+
+func TestTokenManager_FailedRefreshReturnsTokenInUse(t *testing.T) {
+	httpClient := &tokenHTTPClient{}
+	m := newTokenManager(httpClient, &APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, logger.NewUnstructuredLogger())
+	require.NoError(t, m.Refresh())
+
+	httpClient.fail.Store(true)
+	m.Invalidate("token1")
+	token, err := m.Token()
+	assert.Error(t, err)
+	assert.Equal(t, "token1", token)
+}
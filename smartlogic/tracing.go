@@ -0,0 +1,46 @@
+package smartlogic
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Financial-Times/smartlogic-notifier/smartlogic"
+
+// The attributes of the spans of the requests to Smartlogic.
+const (
+	modelAttribute      = attribute.Key("smartlogic.model")
+	uuidAttribute       = attribute.Key("concept.uuid")
+	sinceAttribute      = attribute.Key("smartlogic.changes.since")
+	limitAttribute      = attribute.Key("smartlogic.changes.limit")
+	changesetsAttribute = attribute.Key("smartlogic.changes.changesets")
+	conceptsAttribute   = attribute.Key("smartlogic.changes.concepts")
+	errorKindAttribute  = attribute.Key("smartlogic.error.kind")
+)
+
+// WithTracerProvider sets the provider of the tracer of the requests to Smartlogic, instead of the global one.
+func WithTracerProvider(tp trace.TracerProvider) func(*Client) {
+	return func(c *Client) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+func (c *Client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, modelAttribute.String(c.model))
+	return c.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span of a request to Smartlogic, recording the error and its kind if the request failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if kind := errorKind(err); kind != "" {
+			span.SetAttributes(errorKindAttribute.String(string(kind)))
+		}
+	}
+	span.End()
+}
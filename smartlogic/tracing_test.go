@@ -0,0 +1,83 @@
+package smartlogic
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = attr.Value.Emit()
+	}
+	return attrs
+}
+
+func TestClient_TracesGetConcept(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	var requestSpan trace.SpanContext
+	httpClient := funcHTTPClient(func(req *http.Request) (*http.Response, error) {
+		requestSpan = trace.SpanContextFromContext(req.Context())
+		return newResponse(http.StatusOK, `{"access_token": "token", "@graph": []}`), nil
+	})
+	sl, err := NewSmartlogicClient(httpClient, "http://base/url", "modelName", "apiKey", "conceptUriPrefix", logger.NewUnstructuredLogger(),
+		WithTracerProvider(tp),
+	)
+	require.NoError(t, err)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, err = sl.GetConceptContext(ctx, "2d3e16e0-61cb-4322-8aff-3b01c59f4daa")
+	parent.End()
+	require.ErrorIs(t, err, ErrInvalidResponse)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "smartlogic.GetConcept", span.Name())
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, span.SpanContext(), requestSpan, "the request is made in the span")
+	assert.Equal(t, codes.Error, span.Status().Code)
+	attrs := spanAttributes(span)
+	assert.Equal(t, "modelName", attrs[modelAttribute])
+	assert.Equal(t, "2d3e16e0-61cb-4322-8aff-3b01c59f4daa", attrs[uuidAttribute])
+	assert.Equal(t, "invalid_response", attrs[errorKindAttribute])
+}
+
+func TestClient_TracesConceptChanges(t *testing.T) {
+	changes, err := ioutil.ReadFile("testdata/get-change-events.json")
+	require.NoError(t, err)
+	sl, err := NewSmartlogicTestClient(&mockHTTPClient{resp: string(changes), statusCode: http.StatusOK},
+		"http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	require.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	sl.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(tracerName)
+	sl.changesPageSize = 100
+
+	err = sl.StreamConceptChangesContext(context.Background(), time.Now(), func(ConceptChanges) error { return nil })
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "smartlogic.GetConceptChanges", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	attrs := spanAttributes(spans[0])
+	assert.NotEmpty(t, attrs[sinceAttribute])
+	assert.Equal(t, "100", attrs[limitAttribute])
+	assert.Equal(t, "4", attrs[changesetsAttribute])
+	assert.Equal(t, "4", attrs[conceptsAttribute])
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// The exporters of the traces.
+const (
+	noTracing      = ""
+	otlpTracing    = "otlp"
+	stdoutTracing  = "stdout"
+	serviceNameKey = attribute.Key("service.name")
+	// otlpTracesPath is where the spans are sent on an OTLP http endpoint
+	otlpTracesPath = "/v1/traces"
+)
+
+// newTracerProvider returns the provider of the tracers which export the spans with the given exporter, or nothing if tracing is disabled.
+// The otlp exporter sends the spans over http to the given endpoint, or to the one of the OTEL_EXPORTER_OTLP_ENDPOINT environment
+// variable if none is given. As with that variable, the spans are sent to the /v1/traces path of an endpoint without a path.
+// The stdout exporter prints them, for local testing.
+func newTracerProvider(exporter, otlpEndpoint, serviceName string) (*sdktrace.TracerProvider, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case noTracing:
+		return nil, nil
+	case otlpTracing:
+		var opts []otlptracehttp.Option
+		if otlpEndpoint != "" {
+			endpointURL, urlErr := otlpTracesURL(otlpEndpoint)
+			if urlErr != nil {
+				return nil, urlErr
+			}
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpointURL))
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), opts...)
+	case stdoutTracing:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %s, it should be %s or %s", exporter, otlpTracing, stdoutTracing)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the %s exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(serviceNameKey.String(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the tracing resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res)), nil
+}
+
+// otlpTracesURL returns the URL the spans are sent to for the given OTLP endpoint, i.e. its /v1/traces path
+// unless it has a path of its own.
+func otlpTracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid OTLP endpoint %s: %w", endpoint, err)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = otlpTracesPath
+	}
+	return u.String(), nil
+}
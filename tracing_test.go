@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTracerProvider_OTLPTracesPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "endpoint without a path", path: "", expected: "/v1/traces"},
+		{name: "endpoint with a trailing slash", path: "/", expected: "/v1/traces"},
+		{name: "endpoint with a path", path: "/custom/traces", expected: "/custom/traces"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var paths []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				paths = append(paths, r.URL.Path)
+				mu.Unlock()
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			tp, err := newTracerProvider(otlpTracing, srv.URL+test.path, "smartlogic-notifier")
+			require.NoError(t, err)
+
+			_, span := tp.Tracer("test").Start(context.Background(), "span")
+			span.End()
+			require.NoError(t, tp.Shutdown(context.Background()))
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.NotEmpty(t, paths, "the span should have been exported")
+			assert.Equal(t, test.expected, paths[0])
+		})
+	}
+}
+
+func TestNewTracerProvider_Disabled(t *testing.T) {
+	tp, err := newTracerProvider(noTracing, "", "smartlogic-notifier")
+	require.NoError(t, err)
+	assert.Nil(t, tp)
+}